@@ -0,0 +1,132 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: detection.proto
+
+package detectionpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// DetectionStreamClient is the client API for DetectionStream service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type DetectionStreamClient interface {
+	Stream(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (DetectionStream_StreamClient, error)
+}
+
+type detectionStreamClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDetectionStreamClient(cc grpc.ClientConnInterface) DetectionStreamClient {
+	return &detectionStreamClient{cc}
+}
+
+func (c *detectionStreamClient) Stream(ctx context.Context, in *StreamRequest, opts ...grpc.CallOption) (DetectionStream_StreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &DetectionStream_ServiceDesc.Streams[0], "/homesecurity.DetectionStream/Stream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &detectionStreamStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type DetectionStream_StreamClient interface {
+	Recv() (*DetectionSet, error)
+	grpc.ClientStream
+}
+
+type detectionStreamStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *detectionStreamStreamClient) Recv() (*DetectionSet, error) {
+	m := new(DetectionSet)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// DetectionStreamServer is the server API for DetectionStream service.
+// All implementations must embed UnimplementedDetectionStreamServer
+// for forward compatibility
+type DetectionStreamServer interface {
+	Stream(*StreamRequest, DetectionStream_StreamServer) error
+	mustEmbedUnimplementedDetectionStreamServer()
+}
+
+// UnimplementedDetectionStreamServer must be embedded to have forward compatible implementations.
+type UnimplementedDetectionStreamServer struct {
+}
+
+func (UnimplementedDetectionStreamServer) Stream(*StreamRequest, DetectionStream_StreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method Stream not implemented")
+}
+func (UnimplementedDetectionStreamServer) mustEmbedUnimplementedDetectionStreamServer() {}
+
+// UnsafeDetectionStreamServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DetectionStreamServer will
+// result in compilation errors.
+type UnsafeDetectionStreamServer interface {
+	mustEmbedUnimplementedDetectionStreamServer()
+}
+
+func RegisterDetectionStreamServer(s grpc.ServiceRegistrar, srv DetectionStreamServer) {
+	s.RegisterService(&DetectionStream_ServiceDesc, srv)
+}
+
+func _DetectionStream_Stream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(StreamRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DetectionStreamServer).Stream(m, &detectionStreamStreamServer{stream})
+}
+
+type DetectionStream_StreamServer interface {
+	Send(*DetectionSet) error
+	grpc.ServerStream
+}
+
+type detectionStreamStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *detectionStreamStreamServer) Send(m *DetectionSet) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// DetectionStream_ServiceDesc is the grpc.ServiceDesc for DetectionStream service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var DetectionStream_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "homesecurity.DetectionStream",
+	HandlerType: (*DetectionStreamServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Stream",
+			Handler:       _DetectionStream_Stream_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "detection.proto",
+}
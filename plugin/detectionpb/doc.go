@@ -0,0 +1,5 @@
+// Package detectionpb holds the messages and the gRPC service defined in
+// detection.proto, generated with protoc-gen-go and protoc-gen-go-grpc.
+package detectionpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative detection.proto
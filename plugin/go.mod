@@ -4,7 +4,20 @@ go 1.17
 
 require (
 	github.com/falcosecurity/plugin-sdk-go v0.0.0-20211130120943-659105b47036
+	github.com/mattn/go-sqlite3 v1.14.19
 	gocv.io/x/gocv v0.29.0
 )
 
-require github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
+require (
+	github.com/nfnt/resize v0.0.0-20180221191011-83c6a9932646
+	google.golang.org/grpc v1.50.1
+	google.golang.org/protobuf v1.27.1
+)
+
+require (
+	github.com/golang/protobuf v1.5.2 // indirect
+	golang.org/x/net v0.0.0-20201021035429-f5854403a974 // indirect
+	golang.org/x/sys v0.0.0-20210119212857-b64e53b001e4 // indirect
+	golang.org/x/text v0.3.3 // indirect
+	google.golang.org/genproto v0.0.0-20200526211855-cb27e3aa2013 // indirect
+)
@@ -0,0 +1,57 @@
+package homesecurity
+
+import (
+	"sort"
+	"strings"
+)
+
+// countAlerter notices when the number of blobs of a category rises to
+// its CountAlerts threshold. Alerts are edge-triggered: a category alerts
+// again only after its count has dropped below the threshold.
+type countAlerter struct {
+	thresholds map[CategoryID]int
+	above      map[CategoryID]bool
+
+	// categories with a threshold, in alerting order
+	categories []CategoryID
+}
+
+type countAlert struct {
+	category CategoryID
+	count    int
+}
+
+func newCountAlerter(cfg *DetectionConfig) *countAlerter {
+	a := &countAlerter{
+		thresholds: make(map[CategoryID]int),
+		above:      make(map[CategoryID]bool),
+	}
+	for name, threshold := range cfg.CountAlerts {
+		for c, n := range Categories {
+			if strings.EqualFold(n, name) {
+				a.thresholds[c] = threshold
+				a.categories = append(a.categories, c)
+			}
+		}
+	}
+	sort.Slice(a.categories, func(i, j int) bool { return a.categories[i] < a.categories[j] })
+	return a
+}
+
+// Check returns the categories whose count rose to the threshold
+func (a *countAlerter) Check(blobs []Blob) []countAlert {
+	counts := make(map[CategoryID]int)
+	for _, blob := range blobs {
+		counts[blob.Category]++
+	}
+	var alerts []countAlert
+	for _, c := range a.categories {
+		if counts[c] < a.thresholds[c] {
+			a.above[c] = false
+		} else if !a.above[c] {
+			a.above[c] = true
+			alerts = append(alerts, countAlert{category: c, count: counts[c]})
+		}
+	}
+	return alerts
+}
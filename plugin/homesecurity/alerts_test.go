@@ -0,0 +1,35 @@
+package homesecurity
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCountAlerter(t *testing.T) {
+	a := newCountAlerter(&DetectionConfig{CountAlerts: map[string]int{"human": 2, "Animal": 1}})
+	tests := []struct {
+		humans, animals int
+		want            []countAlert
+	}{
+		{1, 0, nil},
+		{2, 1, []countAlert{{Human, 2}, {Animal, 1}}},
+		// still above: no new alert
+		{3, 1, nil},
+		{1, 1, nil},
+		// crossing again
+		{2, 0, []countAlert{{Human, 2}}},
+		{0, 2, []countAlert{{Animal, 2}}},
+	}
+	for i, tt := range tests {
+		var blobs []Blob
+		for n := 0; n < tt.humans; n++ {
+			blobs = append(blobs, testBlob(Human, 100*n, 0, 0.9))
+		}
+		for n := 0; n < tt.animals; n++ {
+			blobs = append(blobs, testBlob(Animal, 100*n, 200, 0.9))
+		}
+		if got := a.Check(blobs); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("step %d: got alerts %v, want %v", i, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package homesecurity
+
+import (
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// bestFrame keeps the highest-confidence event, and a copy of its frame,
+// among the ones offered over a time window.
+type bestFrame struct {
+	window time.Duration
+	start  time.Time
+	open   bool
+	event  VideoEvent
+	frame  gocv.Mat
+	score  float64
+}
+
+func newBestFrame(window time.Duration) *bestFrame {
+	return &bestFrame{window: window, frame: gocv.NewMat()}
+}
+
+// Open returns true if a window has been started by a first offer
+func (b *bestFrame) Open() bool {
+	return b != nil && b.open
+}
+
+// Offer proposes an event and its frame, starting a new window if needed.
+// The frame is copied only if the event is the best one so far.
+func (b *bestFrame) Offer(evt VideoEvent, frame *gocv.Mat, now time.Time) {
+	score := 0.0
+	for _, blob := range evt.Blobs {
+		score += blob.Confidence
+	}
+	if b.open && score <= b.score {
+		return
+	}
+	if !b.open {
+		b.open = true
+		b.start = now
+	}
+	b.score = score
+	b.event = evt
+	frame.CopyTo(&b.frame)
+}
+
+// Due returns true if the current window has elapsed
+func (b *bestFrame) Due(now time.Time) bool {
+	return b.Open() && now.Sub(b.start) >= b.window
+}
+
+// Take returns the best event of the current window and its frame,
+// which is only valid until the next Offer, and closes the window
+func (b *bestFrame) Take() (VideoEvent, *gocv.Mat) {
+	b.open = false
+	return b.event, &b.frame
+}
+
+func (b *bestFrame) Close() {
+	b.frame.Close()
+}
@@ -0,0 +1,39 @@
+package homesecurity
+
+import (
+	"testing"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+func TestBestFrame(t *testing.T) {
+	b := newBestFrame(time.Second)
+	defer b.Close()
+	start := time.Unix(1000, 0)
+
+	// each frame is filled with its index, to tell which one is kept
+	confidences := []float64{0.5, 0.9, 0.7, 0.6}
+	for i, c := range confidences {
+		frame := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(float64(i), 0, 0, 0), 10, 10, gocv.MatTypeCV8UC3)
+		evt := VideoEvent{CorrelationID: string(rune('a' + i)), Blobs: []Blob{testBlob(Human, 0, 0, c)}}
+		b.Offer(evt, &frame, start.Add(time.Duration(i)*200*time.Millisecond))
+		frame.Close()
+	}
+	if b.Due(start.Add(900 * time.Millisecond)) {
+		t.Error("window due before it elapsed")
+	}
+	if !b.Due(start.Add(time.Second)) {
+		t.Fatal("window not due once elapsed")
+	}
+	evt, frame := b.Take()
+	if evt.CorrelationID != "b" {
+		t.Errorf("got event %s, want the highest-confidence one", evt.CorrelationID)
+	}
+	if v := frame.GetVecbAt(0, 0)[0]; v != 1 {
+		t.Errorf("got frame %d, want 1", v)
+	}
+	if b.Open() || b.Due(start.Add(2*time.Second)) {
+		t.Error("window still open after being taken")
+	}
+}
@@ -0,0 +1,76 @@
+package homesecurity
+
+// CenterXY returns the center of the box. Odd sizes are rounded
+// down, as in Center.
+func (b BlobPosition) CenterXY() (int, int) {
+	c := b.Center()
+	return c.x, c.y
+}
+
+// Size returns the width and the height of the box
+func (b BlobPosition) Size() (int, int) {
+	return b.Right - b.Left, b.Bottom - b.Top
+}
+
+// CenterBox is a box described by its center and size, in pixels
+type CenterBox struct {
+	CenterX int
+	CenterY int
+	Width   int
+	Height  int
+}
+
+// ToCenterBox returns the box described by its center and size
+func (b BlobPosition) ToCenterBox() CenterBox {
+	cx, cy := b.CenterXY()
+	w, h := b.Size()
+	return CenterBox{CenterX: cx, CenterY: cy, Width: w, Height: h}
+}
+
+// the types below mirror the event and its blobs, with the positions
+// replaced by center boxes, as encoded in the JSON outputs with the
+// center box format: the outer fields hide the embedded ones
+
+type blobFields Blob
+
+type centerBlob struct {
+	blobFields
+	Position CenterBox
+}
+
+type eventFields VideoEvent
+
+type centerEvent struct {
+	eventFields
+	Blobs     []centerBlob
+	DeltaBlob centerBlob
+	Added     []centerBlob
+	Removed   []centerBlob
+	Updated   []centerBlob
+}
+
+func toCenterBlob(blob Blob) centerBlob {
+	return centerBlob{blobFields: blobFields(blob), Position: blob.Position.ToCenterBox()}
+}
+
+func toCenterBlobs(blobs []Blob) []centerBlob {
+	if blobs == nil {
+		return nil
+	}
+	centered := make([]centerBlob, len(blobs))
+	for i, blob := range blobs {
+		centered[i] = toCenterBlob(blob)
+	}
+	return centered
+}
+
+func toCenterEvent(evt *VideoEvent) *centerEvent {
+	return &centerEvent{
+		eventFields: eventFields(*evt),
+		Blobs:       toCenterBlobs(evt.Blobs),
+		DeltaBlob:   toCenterBlob(evt.DeltaBlob),
+		Added:       toCenterBlobs(evt.Added),
+		Removed:     toCenterBlobs(evt.Removed),
+		Updated:     toCenterBlobs(evt.Updated),
+	}
+}
@@ -0,0 +1,68 @@
+package homesecurity
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCenterBox(t *testing.T) {
+	tests := []struct {
+		name string
+		box  BlobPosition
+		want CenterBox
+	}{
+		{"even", BlobPosition{Left: 10, Top: 20, Right: 30, Bottom: 60}, CenterBox{CenterX: 20, CenterY: 40, Width: 20, Height: 40}},
+		// the center is rounded down
+		{"odd", BlobPosition{Left: 10, Top: 20, Right: 21, Bottom: 23}, CenterBox{CenterX: 15, CenterY: 21, Width: 11, Height: 3}},
+		{"single pixel", BlobPosition{Left: 5, Top: 5, Right: 6, Bottom: 6}, CenterBox{CenterX: 5, CenterY: 5, Width: 1, Height: 1}},
+		{"empty", BlobPosition{}, CenterBox{}},
+	}
+	for _, tt := range tests {
+		if got := tt.box.ToCenterBox(); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCenterBoxLine(t *testing.T) {
+	blob := Blob{ID: 1, Category: Human, Position: BlobPosition{Left: 10, Top: 20, Right: 21, Bottom: 23}}
+	evt := &VideoEvent{VideoSource: "cam", Blobs: []Blob{blob}, Added: []Blob{blob}}
+	tests := []struct {
+		name        string
+		centerBoxes bool
+		want        map[string]int
+	}{
+		{"corners", false, map[string]int{"Left": 10, "Top": 20, "Right": 21, "Bottom": 23}},
+		{"center", true, map[string]int{"CenterX": 15, "CenterY": 21, "Width": 11, "Height": 3}},
+	}
+	for _, tt := range tests {
+		line, err := encodeEventLine(evt, lineFormat{centerBoxes: tt.centerBoxes})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded struct {
+			VideoSource string
+			Blobs       []struct {
+				ID       uint64
+				Position map[string]int
+			}
+			Added []struct{ Position map[string]int }
+		}
+		if err := json.Unmarshal(line, &decoded); err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if decoded.VideoSource != "cam" || len(decoded.Blobs) != 1 || decoded.Blobs[0].ID != 1 || len(decoded.Added) != 1 {
+			t.Fatalf("%s: got %s", tt.name, line)
+		}
+		for _, position := range []map[string]int{decoded.Blobs[0].Position, decoded.Added[0].Position} {
+			if len(position) != len(tt.want) {
+				t.Errorf("%s: got position %v, want %v", tt.name, position, tt.want)
+			}
+			for field, v := range tt.want {
+				if position[field] != v {
+					t.Errorf("%s: got position %v, want %v", tt.name, position, tt.want)
+				}
+			}
+		}
+	}
+}
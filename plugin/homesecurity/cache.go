@@ -0,0 +1,57 @@
+package homesecurity
+
+import (
+	"container/list"
+
+	"gocv.io/x/gocv"
+)
+
+// cachingDetector reuses the detections of recently seen frames, keyed by
+// their hash, as looped videos and static scenes repeat the same frames.
+// The least recently used frames are evicted beyond the cache size.
+type cachingDetector struct {
+	det  detector
+	size int
+
+	// most recently used first, with the elements of the frames by hash
+	lru     *list.List
+	entries map[uint64]*list.Element
+}
+
+type cacheEntry struct {
+	hash  uint64
+	blobs []Blob
+}
+
+func newCachingDetector(det detector, size int) *cachingDetector {
+	return &cachingDetector{
+		det:     det,
+		size:    size,
+		lru:     list.New(),
+		entries: make(map[uint64]*list.Element),
+	}
+}
+
+func (d *cachingDetector) Detect(img *gocv.Mat) ([]Blob, error) {
+	hash := frameHash(img)
+	if e, ok := d.entries[hash]; ok {
+		d.lru.MoveToFront(e)
+		return append([]Blob(nil), e.Value.(*cacheEntry).blobs...), nil
+	}
+
+	blobs, err := d.det.Detect(img)
+	if err != nil {
+		return nil, err
+	}
+	d.entries[hash] = d.lru.PushFront(&cacheEntry{hash: hash, blobs: append([]Blob(nil), blobs...)})
+	if d.lru.Len() > d.size {
+		oldest := d.lru.Back()
+		d.lru.Remove(oldest)
+		delete(d.entries, oldest.Value.(*cacheEntry).hash)
+	}
+	return blobs, nil
+}
+
+func (d *cachingDetector) Close() error {
+	return d.det.Close()
+}
@@ -0,0 +1,60 @@
+package homesecurity
+
+import (
+	"reflect"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+func TestCachingDetector(t *testing.T) {
+	pattern, err := newTestPattern(testPatternSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pattern.Close()
+	var frames []gocv.Mat
+	for i := 0; i < 3; i++ {
+		img := gocv.NewMat()
+		defer img.Close()
+		pattern.Read(&img)
+		frames = append(frames, img)
+	}
+	scratch := gocv.NewMat()
+	defer scratch.Close()
+
+	counter := &countingDetector{detector: &testPatternDetector{pattern: pattern}}
+	d := newCachingDetector(counter, 2)
+	defer d.Close()
+	tests := []struct {
+		frame int
+		hit   bool
+	}{
+		{0, false},
+		{1, false},
+		{0, true},
+		// evicts frame 1, the least recently used
+		{2, false},
+		{0, true},
+		{1, false},
+	}
+	detected := make(map[int][]Blob)
+	for i, tt := range tests {
+		// the stub finds the box of the last frame read: moving it
+		// tells apart cached detections from new ones
+		pattern.Read(&scratch)
+		calls := counter.calls
+		blobs, err := d.Detect(&frames[tt.frame])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hit := counter.calls == calls; hit != tt.hit {
+			t.Errorf("step %d: got cache hit %v, want %v", i, hit, tt.hit)
+		}
+		if !tt.hit {
+			detected[tt.frame] = blobs
+		} else if !reflect.DeepEqual(blobs, detected[tt.frame]) {
+			t.Errorf("step %d: got %+v, want the cached %+v", i, blobs, detected[tt.frame])
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package homesecurity
+
+// CameraCalibration holds what is needed to estimate the distance of an
+// entity from the camera, following the pinhole model: an object of height
+// H meters, at D meters, is f*H/D pixels tall in the frame.
+type CameraCalibration struct {
+	// Focal length of the camera, in pixels
+	FocalLengthPixels float64 `json:"focalLengthPixels"`
+
+	// Real height of the entities measured, in meters, eg: 1.7 for humans
+	ReferenceHeightMeters float64 `json:"referenceHeightMeters"`
+}
+
+// Distance estimates the distance, in meters, of an entity of the
+// reference height whose box is at the given position. It returns 0
+// for empty boxes.
+func (c *CameraCalibration) Distance(pos BlobPosition) float64 {
+	height := pos.Bottom - pos.Top
+	if height <= 0 {
+		return 0
+	}
+	return c.FocalLengthPixels * c.ReferenceHeightMeters / float64(height)
+}
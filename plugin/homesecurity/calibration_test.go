@@ -0,0 +1,22 @@
+package homesecurity
+
+import "testing"
+
+func TestCalibrationDistance(t *testing.T) {
+	c := &CameraCalibration{FocalLengthPixels: 1000, ReferenceHeightMeters: 1.7}
+	tests := []struct {
+		height int
+		want   float64
+	}{
+		{340, 5},
+		{170, 10},
+		{1700, 1},
+		{0, 0},
+	}
+	for _, tt := range tests {
+		pos := BlobPosition{Left: 10, Top: 20, Right: 110, Bottom: 20 + tt.height}
+		if got := c.Distance(pos); got != tt.want {
+			t.Errorf("height %d: got %v meters, want %v", tt.height, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package homesecurity
+
+import (
+	"image"
+
+	"gocv.io/x/gocv"
+)
+
+// side of the square the blob region is downscaled to, before sampling
+const colorSampleSize = 16
+
+type hueRange struct {
+	max  uint8
+	name string
+}
+
+// Named hue ranges, in the 0-180 OpenCV scale, sorted by upper bound
+var hueNames = []hueRange{
+	{10, "red"},
+	{22, "orange"},
+	{35, "yellow"},
+	{85, "green"},
+	{100, "cyan"},
+	{130, "blue"},
+	{150, "purple"},
+	{170, "pink"},
+	{180, "red"},
+}
+
+// colorName maps an HSV pixel to a color name
+func colorName(h, s, v uint8) string {
+	switch {
+	case v < 50:
+		return "black"
+	case s < 40 && v > 200:
+		return "white"
+	case s < 40:
+		return "gray"
+	}
+	for _, r := range hueNames {
+		if h < r.max {
+			return r.name
+		}
+	}
+	return "red"
+}
+
+// DominantColor returns the name of the most frequent color
+// inside the given region of a BGR frame
+func DominantColor(frame *gocv.Mat, pos BlobPosition) string {
+	if frame.Channels() != 3 {
+		return ""
+	}
+	rect := image.Rect(pos.Left, pos.Top, pos.Right, pos.Bottom).Intersect(image.Rect(0, 0, frame.Cols(), frame.Rows()))
+	if rect.Empty() {
+		return ""
+	}
+
+	region := frame.Region(rect)
+	defer region.Close()
+	small := gocv.NewMat()
+	defer small.Close()
+	gocv.Resize(region, &small, image.Pt(colorSampleSize, colorSampleSize), 0, 0, gocv.InterpolationArea)
+	gocv.CvtColor(small, &small, gocv.ColorBGRToHSV)
+
+	counts := make(map[string]int)
+	best := ""
+	for row := 0; row < small.Rows(); row++ {
+		for col := 0; col < small.Cols(); col++ {
+			px := small.GetVecbAt(row, col)
+			name := colorName(px[0], px[1], px[2])
+			counts[name]++
+			if counts[name] > counts[best] {
+				best = name
+			}
+		}
+	}
+	return best
+}
@@ -0,0 +1,51 @@
+package homesecurity
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+func TestDominantColor(t *testing.T) {
+	// a gray frame, with a red shirt inside the blob
+	frame := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(128, 128, 128, 0), 300, 400, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+	gocv.Rectangle(&frame, image.Rect(110, 50, 190, 250), color.RGBA{R: 220, G: 20, B: 20, A: 255}, -1)
+
+	tests := []struct {
+		name string
+		pos  BlobPosition
+		want string
+	}{
+		{"shirt", BlobPosition{Left: 100, Top: 40, Right: 200, Bottom: 260}, "red"},
+		{"background", BlobPosition{Left: 250, Top: 40, Right: 350, Bottom: 260}, "gray"},
+		{"outside", BlobPosition{Left: 500, Top: 400, Right: 600, Bottom: 500}, ""},
+	}
+	for _, tt := range tests {
+		if got := DominantColor(&frame, tt.pos); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestColorName(t *testing.T) {
+	tests := []struct {
+		h, s, v uint8
+		want    string
+	}{
+		{0, 0, 20, "black"},
+		{0, 10, 250, "white"},
+		{0, 10, 128, "gray"},
+		{5, 200, 200, "red"},
+		{60, 200, 200, "green"},
+		{120, 200, 200, "blue"},
+		{175, 200, 200, "red"},
+	}
+	for _, tt := range tests {
+		if got := colorName(tt.h, tt.s, tt.v); got != tt.want {
+			t.Errorf("HSV %d,%d,%d: got %q, want %q", tt.h, tt.s, tt.v, got, tt.want)
+		}
+	}
+}
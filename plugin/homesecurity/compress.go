@@ -0,0 +1,22 @@
+package homesecurity
+
+import (
+	"bytes"
+	"compress/gzip"
+)
+
+// compressLine gzips a JSON line as a standalone gzip member. Concatenated
+// members are still a valid gzip stream, so a compressed event log or socket
+// stream decompresses to the original JSON lines. Readers can tell compressed
+// streams apart by the gzip magic bytes 0x1f 0x8b, which can't start a JSON line.
+func compressLine(line []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(line); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,62 @@
+package homesecurity
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCompressedEventLines(t *testing.T) {
+	events := []VideoEvent{
+		{VideoSource: "cam", SnapshotData: strings.Repeat("A", 4096), Blobs: []Blob{testBlob(Human, 10, 20, 0.9)}},
+		{VideoSource: "cam", Idle: true},
+	}
+	var stream bytes.Buffer
+	for i := range events {
+		line, err := encodeEventLine(&events[i], lineFormat{compress: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(line, []byte{0x1f, 0x8b}) {
+			t.Fatalf("event %d: no gzip magic bytes", i)
+		}
+		stream.Write(line)
+	}
+
+	// concatenated members decompress to the JSON lines; categories are
+	// written by name, and read back as such
+	type decoded struct {
+		SnapshotData string
+		Idle         bool
+		Blobs        []struct{ Category string }
+	}
+	r, err := gzip.NewReader(&stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	var got []decoded
+	for scanner.Scan() {
+		var evt decoded
+		if err := json.Unmarshal(scanner.Bytes(), &evt); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, evt)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(events) {
+		t.Fatalf("got %d events, want %d", len(got), len(events))
+	}
+	if got[0].SnapshotData != events[0].SnapshotData || len(got[0].Blobs) != 1 || got[0].Blobs[0].Category != "Human" {
+		t.Errorf("got %+v, want %+v", got[0], events[0])
+	}
+	if !got[1].Idle {
+		t.Errorf("got %+v, want an idle event", got[1])
+	}
+}
@@ -0,0 +1,289 @@
+package homesecurity
+
+// OpenConfig holds the parameters of a detection session,
+// that is of a single video source
+type OpenConfig struct {
+	VideoSource string `json:"videoSource"`
+
+	// (optional) File listing the video sources, one per line, each one
+	// optionally followed by its label. Replaces VideoSource, opening all
+	// the sources with the same parameters.
+	SourcesFile string `json:"sourcesFile"`
+	ShowWindow  bool   `json:"showWindow"`
+
+	// (optional) Backend used to open VideoSource, one of v4l2, ffmpeg,
+	// gstreamer or any. Defaults to any, letting OpenCV choose.
+	CaptureAPI string `json:"captureAPI"`
+
+	// (optional) Resolution, frame rate and 4-character codec requested to
+	// the capture device. Devices may pick the closest ones they support.
+	CaptureWidth  int     `json:"captureWidth"`
+	CaptureHeight int     `json:"captureHeight"`
+	CaptureFPS    float64 `json:"captureFPS"`
+	CaptureFourcc string  `json:"captureFourcc"`
+
+	// (optional) Folder where snapshots are stored. It can contain the
+	// {source}, {date}, {class} and {id} tokens, expanded for each snapshot.
+	SnapshotPath string `json:"snapshotPath"`
+
+	// (optional) File name of the snapshots, which can contain the same
+	// tokens as SnapshotPath, plus {time}, and must contain {id}. The
+	// extension picks the image format. Defaults to
+	// Falco-{time}-{source}-{id}.png.
+	SnapshotName string `json:"snapshotName"`
+
+	// (optional) Writes snapshots as 8-bit paletted PNGs, quantized to
+	// SnapshotPaletteSize colors, to save storage.
+	SnapshotPalette bool `json:"snapshotPalette"`
+
+	// (optional) Number of colors of paletted snapshots, from 2 to 256.
+	// Defaults to 256.
+	SnapshotPaletteSize int `json:"snapshotPaletteSize"`
+
+	// (optional) Blurs the head region of humans in snapshots, for privacy.
+	BlurHumans bool `json:"blurHumans"`
+
+	// (optional) Stores snapshots in a subfolder of SnapshotPath named
+	// after the category of the highest-confidence blob.
+	SnapshotByCategory bool `json:"snapshotByCategory"`
+
+	// (optional) Minimum time between two snapshots, independently of
+	// DebounceMillis: events in the meantime have no snapshot.
+	MinSnapshotIntervalMillis int `json:"minSnapshotIntervalMillis"`
+
+	// (optional) Number of snapshots taken for each event, spaced by
+	// SnapshotBurstSpacingMillis and ending with the usual one.
+	SnapshotBurstCount int `json:"snapshotBurstCount"`
+
+	// (optional) Time between the snapshots of a burst.
+	SnapshotBurstSpacingMillis int `json:"snapshotBurstSpacingMillis"`
+
+	// (optional) If set, instead of an event for each change, only the
+	// highest-confidence event of each window of this many seconds,
+	// starting at a change, is emitted along with its snapshot.
+	BestFrameWindowSeconds float64 `json:"bestFrameWindowSeconds"`
+
+	// (optional) Crops snapshots to the area containing all the blobs,
+	// each one padded by CropPaddingByClass, or CropPadding.
+	CropSnapshots bool `json:"cropSnapshots"`
+
+	// (optional) Pixels added around each blob when cropping snapshots.
+	// Defaults to 20.
+	CropPadding int `json:"cropPadding"`
+
+	// (optional) Overrides CropPadding for specific categories,
+	// eg: { "Human": 10 }.
+	CropPaddingByClass map[string]int `json:"cropPaddingByClass"`
+
+	// (optional) For video files, start reading from this offset.
+	StartOffsetSeconds float64 `json:"startOffsetSeconds"`
+
+	// (optional) For video files, stop reading at this offset.
+	EndOffsetSeconds float64 `json:"endOffsetSeconds"`
+
+	// (optional) Number of frames read and discarded when the video source
+	// is opened, as many cameras produce garbage while adjusting exposure.
+	WarmupFrames int `json:"warmupFrames"`
+
+	// (optional) No event is emitted for this many seconds after the first
+	// frame is read, while the stream stabilizes. Entities are still tracked.
+	StartupGraceSeconds float64 `json:"startupGraceSeconds"`
+
+	// (optional) Low-power mode: if set, only this many frames are processed,
+	// then the video source is released for PollIntervalMillis before being
+	// reopened for the next burst.
+	BurstFrames int `json:"burstFrames"`
+
+	// (optional) Time the video source is released between bursts.
+	PollIntervalMillis int `json:"pollIntervalMillis"`
+
+	// (optional) If set, frames are captured in a separate goroutine and
+	// queued up to this depth, dropping the oldest ones when inference
+	// can't keep up.
+	FrameQueueDepth int `json:"frameQueueDepth"`
+
+	// (optional) If set, the snapshot is taken from the frame read this
+	// many milliseconds before the detection, to capture the approach.
+	SnapshotPreRollMillis int `json:"snapshotPreRollMillis"`
+
+	// (optional) File where each event is appended as a JSON line.
+	EventLogPath string `json:"eventLogPath"`
+
+	// (optional) The event log file is rotated when exceeding this size.
+	EventLogMaxBytes int `json:"eventLogMaxBytes"`
+
+	// (optional) Whether to include the ASCII image in the event log.
+	EventLogAscii bool `json:"eventLogAscii"`
+
+	// (optional) CSV file where a row is appended for each entity
+	// of each event, with its class, confidence and box.
+	CsvLogPath string `json:"csvLogPath"`
+
+	// (optional) SQLite database where a row is inserted for each entity
+	// of each event. Requires building with the sqlite tag.
+	SqlitePath string `json:"sqlitePath"`
+
+	// (optional) Whether to generate the ASCII image of the frame and
+	// include it in the events. Defaults to true.
+	IncludeAsciiImage bool `json:"includeAsciiImage"`
+
+	// (optional) Colors each character of the ASCII image as its pixel,
+	// with ANSI truecolor escape sequences, for terminals.
+	AsciiColor bool `json:"asciiColor"`
+
+	// (optional) Skips the detection on frames identical to the previous
+	// one, as delivered by some cameras and looped files.
+	SkipDuplicateFrames bool `json:"skipDuplicateFrames"`
+
+	// (optional) Logs diagnostic messages to stderr.
+	Debug bool `json:"debug"`
+
+	// (optional) Number of times the detection is restarted after a panic,
+	// with an increasing delay. Each restart is notified by an event with
+	// the Error set. Defaults to 0, failing at the first panic.
+	MaxRestarts int `json:"maxRestarts"`
+
+	// (optional) Whether to include the snapshot path in the events.
+	// Defaults to true.
+	IncludeSnapshotPath bool `json:"includeSnapshotPath"`
+
+	// (optional) Embeds the snapshot in the events as a base64 image, for
+	// consumers not sharing the filesystem with the plugin. Snapshots too
+	// big to fit in an event are only stored in SnapshotPath, if set.
+	EmbedSnapshot bool `json:"embedSnapshot"`
+
+	// (optional) Format of the embedded snapshot, between { jpeg, png }.
+	// Defaults to jpeg.
+	EmbedFormat string `json:"embedFormat"`
+
+	// (optional) Quality of the embedded JPEG snapshot, from 1 to 100.
+	// Defaults to 95.
+	EmbedQuality int `json:"embedQuality"`
+
+	// (optional) Minimum time between two events triggered by the same
+	// category; its changes happening in the meantime are held back.
+	DebounceMillis int `json:"debounceMillis"`
+
+	// (optional) If positive, the debounce interval is divided by
+	// 1 + ChangeSensitivity * (N - 1), where N is the number of blobs
+	// added or removed since the last event.
+	ChangeSensitivity float64 `json:"changeSensitivity"`
+
+	// (optional) With a positive ChangeSensitivity, number of blobs added
+	// or removed since the last event from which the event is sent right
+	// away, ignoring the debounce interval. Defaults to 5.
+	ImmediateChangeMagnitude int `json:"immediateChangeMagnitude"`
+
+	// (optional) Between { snapshot, per-blob }. With per-blob, instead of
+	// an event for each change, an event is sent for each blob added or
+	// removed; other changes are still sent as a single event. Defaults to
+	// snapshot.
+	EventGranularity string `json:"eventGranularity"`
+
+	// (optional) Whether to attach to each event the blobs that have been
+	// added, removed, or updated since the previous one.
+	DeltaEvents bool `json:"deltaEvents"`
+
+	// (optional) Sends an event flagged as Idle, with no blobs, whenever
+	// no event has been produced for a whole NextBatch timeout, so that
+	// consumers know the plugin is alive.
+	IdleKeepalive bool `json:"idleKeepalive"`
+
+	// (optional) Path of a file pausing the detection while it exists, eg:
+	// to be touched before a maintenance and removed after it.
+	PauseFile string `json:"pauseFile"`
+
+	// (optional) Number of recent events the smoothed blob counts are the
+	// median of. Defaults to 5.
+	SmoothingWindow int `json:"smoothingWindow"`
+
+	// (optional) Emits an event for each processed frame, even if nothing
+	// changed, to record a full detection timeline. DebounceMillis still
+	// applies. Snapshots are only taken for the events of actual changes.
+	EmitEveryFrame bool `json:"emitEveryFrame"`
+
+	// (optional) If set, the current blobs are sent again, flagged as a
+	// state refresh, when no event has been sent for this many seconds, so
+	// that consumers joining mid-stream know what is in the scene.
+	StateRefreshSeconds float64 `json:"stateRefreshSeconds"`
+
+	// (optional) Reads a single frame, emits a single event with the
+	// entities found in it, and ends the session, for periodic checks
+	// scheduled externally.
+	SingleShot bool `json:"singleShot"`
+
+	// (optional) Whether to draw the recent path of each entity in the window.
+	ShowTrails bool `json:"showTrails"`
+
+	// (optional) Number of recent positions drawn for each trail.
+	TrailLength int `json:"trailLength"`
+
+	// (optional) Font of the annotations drawn on the window and the
+	// snapshots, between { plain, simplex, duplex, complex, triplex }.
+	// Defaults to plain.
+	FontFace string `json:"fontFace"`
+
+	// (optional) Scale of the annotation font. Defaults to 1.
+	FontScale float64 `json:"fontScale"`
+
+	// (optional) Thickness, in pixels, of the annotation text and boxes.
+	// Defaults to 2.
+	FontThickness int `json:"fontThickness"`
+
+	// (optional) Factor frames are resized by before being shown in the
+	// window, without affecting detection and snapshots. Defaults to 1.
+	RenderScale float64 `json:"renderScale"`
+
+	// (optional) Unix domain socket where events are streamed as JSON lines.
+	SocketPath string `json:"socketPath"`
+
+	// (optional) Address, as host:port, where a gRPC server streams
+	// events as the DetectionSet messages of detection.proto.
+	GRPCAddress string `json:"grpcAddress"`
+
+	// (optional) Gzips each JSON line written to the event log and the
+	// socket. Events sent to Falco are not affected.
+	CompressEvents bool `json:"compressEvents"`
+
+	// (optional) How boxes are described in the JSON lines of the event
+	// log and the socket, between { corners, center }. With center, each
+	// Position has CenterX, CenterY, Width and Height fields. Defaults to
+	// corners.
+	BoxFormat string `json:"boxFormat"`
+
+	// (optional) Where event timestamps come from, between { wallclock, media }.
+	// With media, video files use the position of the frame within the file,
+	// counted from the time the file is opened, so that events are as far
+	// apart as in the recording. Live sources, such as devices and network
+	// streams, keep using the wall clock. Defaults to wallclock.
+	TimestampSource string `json:"timestampSource"`
+
+	// (optional) If set, detection and events are suppressed while the camera
+	// moves, as with PTZ pans, that is when the mean absolute difference
+	// between consecutive frames, from 0 to 255, exceeds this value.
+	PtzMotionThreshold float64 `json:"ptzMotionThreshold"`
+
+	// (optional) Time detection stays suppressed after the camera stopped
+	// moving. Defaults to 2000.
+	PtzSettleMillis int `json:"ptzSettleMillis"`
+
+	// (optional) Emits an event when frames stay darker than TamperLuminance
+	// or blurrier than TamperSharpness for TamperSeconds, as when the camera
+	// is covered or defocused. Ignored with SingleShot.
+	TamperDetection bool `json:"tamperDetection"`
+
+	// (optional) Mean luminance, from 0 to 255, below which frames look
+	// tampered. Defaults to 20.
+	TamperLuminance float64 `json:"tamperLuminance"`
+
+	// (optional) Variance of the Laplacian below which frames look
+	// tampered. Defaults to 10.
+	TamperSharpness float64 `json:"tamperSharpness"`
+
+	// (optional) Time frames must look tampered for. Defaults to 3.
+	TamperSeconds float64 `json:"tamperSeconds"`
+
+	// (optional) Label stamped onto each event, to tell sources apart in
+	// rules. Mandatory when multiple instances are open at the same time.
+	SourceLabel string `json:"sourceLabel"`
+}
@@ -0,0 +1,75 @@
+package homesecurity
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+	"time"
+)
+
+var csvHeader = []string{"timestamp", "source", "class", "confidence", "x", "y", "w", "h"}
+
+// csvLog appends one row per blob of each event to a CSV file,
+// for quick analysis in spreadsheets.
+type csvLog struct {
+	file   *os.File
+	writer *csv.Writer
+}
+
+func openCsvLog(path string) (*csvLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	l := &csvLog{file: file, writer: csv.NewWriter(file)}
+
+	// only new files get the header, as existing ones are appended to
+	if info.Size() == 0 {
+		l.writer.Write(csvHeader)
+		l.writer.Flush()
+		if err := l.writer.Error(); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// Write appends a row for each blob of the event
+func (l *csvLog) Write(evt *VideoEvent) error {
+	ts := evt.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	now := ts.Format(time.RFC3339Nano)
+	for _, blob := range evt.Blobs {
+		pos := blob.Position
+		l.writer.Write([]string{
+			now,
+			evt.VideoSource,
+			blob.Class,
+			strconv.FormatFloat(blob.Confidence, 'f', 4, 64),
+			strconv.Itoa(pos.Left),
+			strconv.Itoa(pos.Top),
+			strconv.Itoa(pos.Right - pos.Left),
+			strconv.Itoa(pos.Bottom - pos.Top),
+		})
+	}
+	l.writer.Flush()
+	return l.writer.Error()
+}
+
+// Close flushes any buffered row and closes the file
+func (l *csvLog) Close() error {
+	l.writer.Flush()
+	if err := l.writer.Error(); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,52 @@
+package homesecurity
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCsvLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "detections.csv")
+	ts := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	human := testBlob(Human, 10, 20, 0.9)
+	human.Class = "person"
+	animal := testBlob(Animal, 300, 40, 0.75)
+	animal.Class = "animal"
+
+	// reopening appends to the file without repeating the header
+	for _, blobs := range [][]Blob{{human, animal}, {human}} {
+		l, err := openCsvLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := l.Write(&VideoEvent{Timestamp: ts, VideoSource: "cam", Blobs: blobs}); err != nil {
+			t.Fatal(err)
+		}
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		csvHeader,
+		{"2022-03-04T05:06:07Z", "cam", "person", "0.9000", "10", "20", "100", "200"},
+		{"2022-03-04T05:06:07Z", "cam", "animal", "0.7500", "300", "40", "100", "200"},
+		{"2022-03-04T05:06:07Z", "cam", "person", "0.9000", "10", "20", "100", "200"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("got rows %q, want %q", rows, want)
+	}
+}
@@ -0,0 +1,91 @@
+package homesecurity
+
+import "time"
+
+// eventDebouncer rate limits events: changes happening too close to the
+// previous event are held back until the debounce interval has elapsed.
+// Each category has its own interval, so that the changes of a category
+// don't hold back the ones of the others.
+type eventDebouncer struct {
+	interval time.Duration
+
+	// if positive, the interval shrinks as the magnitude of the change grows,
+	// down to zero from the immediate magnitude on
+	sensitivity float64
+	immediate   int
+
+	// time of the last event triggered by each category, and magnitude
+	// of the pending changes of each category
+	last    map[CategoryID]time.Time
+	pending map[CategoryID]int
+
+	// events are held back until then, while changes are still registered
+	holdUntil time.Time
+}
+
+const defaultImmediateChangeMagnitude = 5
+
+// Returns the magnitude of the changes sent regardless of the debounce interval
+func (oCfg *OpenConfig) immediateChangeMagnitude() int {
+	if oCfg.ImmediateChangeMagnitude == 0 {
+		return defaultImmediateChangeMagnitude
+	}
+	return oCfg.ImmediateChangeMagnitude
+}
+
+// Interval returns the debounce interval for a change of the given magnitude
+func (d *eventDebouncer) Interval(magnitude int) time.Duration {
+	if d.sensitivity <= 0 || magnitude <= 1 {
+		return d.interval
+	}
+	if d.immediate > 0 && magnitude >= d.immediate {
+		return 0
+	}
+	return time.Duration(float64(d.interval) / (1 + d.sensitivity*float64(magnitude-1)))
+}
+
+// Ready registers the categories that changed, and returns true if an event
+// should be emitted now. The magnitude of each category is the number of its
+// added and removed blobs since the last event, so a non-nil changed replaces
+// the pending changes, while a nil one keeps them. Changes not bound to any
+// category use Unknown.
+func (d *eventDebouncer) Ready(changed map[CategoryID]int, now time.Time) bool {
+	if d.last == nil {
+		d.last = make(map[CategoryID]time.Time)
+	}
+	if changed != nil {
+		d.pending = make(map[CategoryID]int, len(changed))
+		for c, magnitude := range changed {
+			d.pending[c] = magnitude
+		}
+	}
+	if now.Before(d.holdUntil) {
+		return false
+	}
+	ready := false
+	for c, magnitude := range d.pending {
+		if now.Sub(d.last[c]) >= d.Interval(magnitude) {
+			d.last[c] = now
+			ready = true
+		}
+	}
+	if ready {
+		// the event carries all the blobs, so the changes held back for
+		// the other categories are sent too, without restarting their
+		// intervals
+		d.pending = nil
+	}
+	return ready
+}
+
+// categoryChanges returns the magnitude of the changes of each category
+func categoryChanges(delta BlobDelta) map[CategoryID]int {
+	changes := make(map[CategoryID]int)
+	for _, blob := range delta.Added {
+		changes[blob.Category]++
+	}
+	for _, blob := range delta.Removed {
+		changes[blob.Category]++
+	}
+	return changes
+}
@@ -0,0 +1,101 @@
+package homesecurity
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDebounceInterval(t *testing.T) {
+	tests := []struct {
+		sensitivity float64
+		magnitude   int
+		want        time.Duration
+	}{
+		{0, 1, 10 * time.Second},
+		{0, 8, 10 * time.Second},
+		{1, 1, 10 * time.Second},
+		{1, 2, 5 * time.Second},
+		{1, 4, 2500 * time.Millisecond},
+		{1, 5, 0},
+		{1, 8, 0},
+	}
+	for _, tt := range tests {
+		d := eventDebouncer{interval: 10 * time.Second, sensitivity: tt.sensitivity, immediate: 5}
+		if got := d.Interval(tt.magnitude); got != tt.want {
+			t.Errorf("sensitivity %v, magnitude %d: got %s, want %s", tt.sensitivity, tt.magnitude, got, tt.want)
+		}
+	}
+}
+
+func TestDebounceLargeChange(t *testing.T) {
+	d := eventDebouncer{interval: 10 * time.Second, sensitivity: 1, immediate: 5}
+	start := time.Unix(1000, 0)
+	steps := []struct {
+		after   time.Duration
+		changed map[CategoryID]int
+		want    bool
+	}{
+		{0, map[CategoryID]int{Human: 1}, true},
+		// small churn is held back
+		{time.Second, map[CategoryID]int{Human: 1}, false},
+		{2 * time.Second, map[CategoryID]int{Human: 2}, false},
+		// while a crowd showing up is sent right away
+		{3 * time.Second, map[CategoryID]int{Human: 6}, true},
+		{4 * time.Second, map[CategoryID]int{Human: 1}, false},
+	}
+	for i, s := range steps {
+		if got := d.Ready(s.changed, start.Add(s.after)); got != s.want {
+			t.Errorf("step %d: got ready %v, want %v", i, got, s.want)
+		}
+	}
+}
+
+func TestStartupGrace(t *testing.T) {
+	start := time.Unix(1000, 0)
+	d := eventDebouncer{holdUntil: start.Add(5 * time.Second)}
+	steps := []struct {
+		after   time.Duration
+		changed map[CategoryID]int
+		want    bool
+	}{
+		{0, map[CategoryID]int{Human: 1}, false},
+		{2 * time.Second, map[CategoryID]int{Human: 1, Animal: 1}, false},
+		{4 * time.Second, nil, false},
+		// the changes registered meanwhile are sent once it ends
+		{5 * time.Second, nil, true},
+		{6 * time.Second, nil, false},
+	}
+	for i, s := range steps {
+		if got := d.Ready(s.changed, start.Add(s.after)); got != s.want {
+			t.Errorf("step %d: got ready %v, want %v", i, got, s.want)
+		}
+	}
+}
+
+func TestDebouncePerCategory(t *testing.T) {
+	d := eventDebouncer{interval: 10 * time.Second}
+	start := time.Unix(1000, 0)
+	steps := []struct {
+		after   time.Duration
+		changed map[CategoryID]int
+		want    bool
+	}{
+		{0, map[CategoryID]int{Human: 1}, true},
+		// an animal event doesn't wait for the human interval
+		{2 * time.Second, map[CategoryID]int{Animal: 1}, true},
+		{4 * time.Second, map[CategoryID]int{Human: 1}, false},
+		{6 * time.Second, map[CategoryID]int{Human: 1, Animal: 1}, false},
+		// the human change is sent along with the animal one
+		{10 * time.Second, nil, true},
+		{12 * time.Second, nil, false},
+		// a change undone before its interval elapses is not sent
+		{14 * time.Second, map[CategoryID]int{Human: 1}, false},
+		{16 * time.Second, map[CategoryID]int{}, false},
+		{30 * time.Second, nil, false},
+	}
+	for i, s := range steps {
+		if got := d.Ready(s.changed, start.Add(s.after)); got != s.want {
+			t.Errorf("step %d: got ready %v, want %v", i, got, s.want)
+		}
+	}
+}
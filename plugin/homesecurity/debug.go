@@ -0,0 +1,13 @@
+package homesecurity
+
+import "log"
+
+// debugLogger logs diagnostic messages to stderr, only if enabled,
+// keeping them out of the regular output
+type debugLogger bool
+
+func (d debugLogger) Printf(format string, args ...interface{}) {
+	if d {
+		log.Printf("debug: "+format, args...)
+	}
+}
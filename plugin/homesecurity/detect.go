@@ -0,0 +1,631 @@
+package homesecurity
+
+import (
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// See https://tech.amikelive.com/node-718/what-object-categories-labels-are-in-coco-dataset/
+
+type CategoryID int
+const (
+	Unknown    CategoryID = iota
+	Human      CategoryID = iota
+	Vehicle    CategoryID = iota
+	Outdoor    CategoryID = iota
+	Animal     CategoryID = iota
+	Accessory  CategoryID = iota
+	Sports     CategoryID = iota
+	Kitchen    CategoryID = iota
+	Food       CategoryID = iota
+	Furniture  CategoryID = iota
+	Electronic CategoryID = iota
+	Appliance  CategoryID = iota
+	Indoor     CategoryID = iota
+)
+
+type categoryRange struct {
+	start int
+	end   int
+}
+
+var categoryRanges = map[CategoryID]categoryRange{
+	Human:      {1, 1},
+	Vehicle:    {2, 9},
+	Outdoor:    {10, 15},
+	Animal:     {16, 25},
+	Accessory:  {26, 33},
+	Sports:     {34, 43},
+	Kitchen:    {44, 51},
+	Food:       {52, 61},
+	Furniture:  {62, 71},
+	Electronic: {72, 77},
+	Appliance:  {78, 83},
+	Indoor:     {84, 91},
+}
+
+// Categories we want to handle
+var Categories = map[CategoryID]string{
+	Human:  "Human",
+	Animal: "Animal",
+}
+
+func (c CategoryID) String() string {
+	return Categories[c]
+}
+
+// MarshalText makes categories appear by name in JSON outputs
+func (c CategoryID) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+func (c CategoryID) Known() bool {
+	if _, ok := Categories[c]; ok {
+		return true
+	}
+	return false
+}
+
+// Returns true if the name belongs to one of the handled categories
+func knownCategoryName(name string) bool {
+	for _, n := range Categories {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func ParseClassID(classId int) CategoryID {
+	for c, r := range categoryRanges {
+		if r.start <= classId && classId <= r.end {
+			return c
+		}
+	}
+	return Unknown
+}
+
+// BlobPosition is a box, in pixels
+type BlobPosition struct {
+	Left   int
+	Top    int
+	Right  int
+	Bottom int
+}
+
+// ClassScore is the confidence of a detection belonging to a category
+type ClassScore struct {
+	Category   CategoryID
+	Confidence float64
+}
+
+// BlobPoint is a point, in pixels
+type BlobPoint struct {
+	x int
+	y int
+}
+
+// Blob is an entity found in a frame, as tracked by a BlobList
+type Blob struct {
+	// Stable identifier of the tracked blob, unique within a BlobList
+	ID         uint64
+	Category   CategoryID
+	Confidence float64
+	Position   BlobPosition
+
+	// Best class scores, starting with the blob category itself
+	Scores []ClassScore
+
+	// Name of the category as seen by event consumers, after applying
+	// the class aliases
+	Class string
+
+	// Name of the dominant color inside the box, only computed for humans
+	DominantColor string
+
+	// Distance from the camera, in meters, only computed for humans
+	// if the camera is calibrated
+	EstimatedDistanceMeters float64
+
+	// Time the blob has been first detected at
+	FirstSeen time.Time
+
+	// Time the blob has been last detected at
+	LastSeen time.Time
+
+	// Set if the blob is not a human, it has been stationary for a while,
+	// and no human is around
+	Abandoned bool
+
+	// Confidence values after each decay, oldest first; only recorded
+	// if decay debugging is enabled, and left out of the JSON outputs
+	DecayTrace []float64 `json:"-"`
+
+	// last known centers of the blob, oldest first
+	trail []BlobPoint
+
+	// position where the blob has been dwelling since anchorSince
+	anchor      BlobPoint
+	anchorSince time.Time
+
+	// number of consecutive refresh cycles in which the blob has been detected
+	hits      int
+	confirmed bool
+
+	// movement of the center at the last detection, and number of refresh
+	// cycles the blob has been coasting for, since its confidence decayed
+	velocity BlobPoint
+	coasting int
+}
+
+// number of decayed confidence values kept for each blob, when debugging
+const decayTraceLength = 64
+
+// default radius, in pixels, within which a blob is considered stationary
+const defaultAbandonedRadius = 20
+
+// BlobList tracks blobs across frames, merging each new detection with the
+// nearest known blob and retiring the blobs whose confidence has decayed.
+// The zero value is an empty list.
+type BlobList struct {
+	blobs  []Blob
+	nextID uint64
+
+	// number of centers kept in the trail of each blob
+	trailLength int
+
+	// number of blobs confirmed by the last Update
+	added int
+
+	// zones occupied by each blob, and the transitions of the last Update
+	zones     map[uint64]map[string]bool
+	zoneEnter []ZoneTransition
+	zoneExit  []ZoneTransition
+
+	// returns the current time, defaults to time.Now
+	now func() time.Time
+}
+
+func (b *BlobList) clock() time.Time {
+	if b.now == nil {
+		return time.Now()
+	}
+	return b.now()
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (b BlobPosition) Center() BlobPoint {
+	x := (b.Left + b.Right) / 2
+	y := (b.Top + b.Bottom) / 2
+	return BlobPoint{x, y}
+}
+
+// Area returns the area of the rectangle, 0 if it is degenerate
+func (b BlobPosition) Area() int {
+	if b.Right <= b.Left || b.Bottom <= b.Top {
+		return 0
+	}
+	return (b.Right - b.Left) * (b.Bottom - b.Top)
+}
+
+// IoU returns the intersection over union of two rectangles
+func (b BlobPosition) IoU(other BlobPosition) float64 {
+	inter := BlobPosition{
+		Left:   maxInt(b.Left, other.Left),
+		Top:    maxInt(b.Top, other.Top),
+		Right:  minInt(b.Right, other.Right),
+		Bottom: minInt(b.Bottom, other.Bottom),
+	}.Area()
+	union := b.Area() + other.Area() - inter
+	if union <= 0 {
+		return 0
+	}
+	return float64(inter) / float64(union)
+}
+
+func (b BlobPoint) Near(other BlobPoint) float64 {
+	xDiff := float64(minInt(b.x, other.x)) / float64(maxInt(b.x, other.x))
+	yDiff := float64(minInt(b.y, other.y)) / float64(maxInt(b.y, other.y))
+	return xDiff * yDiff
+}
+
+func (b Blob) Color() color.RGBA {
+	switch b.Category {
+	case Human:
+		return color.RGBA{B: 255}
+	case Animal:
+		return color.RGBA{G: 255}
+	}
+	return color.RGBA{}
+}
+
+// suppressOverlaps performs a greedy non-maximum suppression regardless
+// of the categories: among blobs overlapping more than the threshold,
+// only the highest-confidence one is kept.
+func suppressOverlaps(blobs []Blob, threshold float64) []Blob {
+	sorted := append([]Blob(nil), blobs...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Confidence > sorted[j].Confidence
+	})
+	var kept []Blob
+	for _, blob := range sorted {
+		suppressed := false
+		for _, k := range kept {
+			if blob.Position.IoU(k.Position) > threshold {
+				suppressed = true
+				break
+			}
+		}
+		if !suppressed {
+			kept = append(kept, blob)
+		}
+	}
+	return kept
+}
+
+// Given a new blob, returns the index of the most similar known blob,
+// according to the match strategy of the config.
+// If no blob is similar enough, -1 is returned.
+func (b *BlobList) findNearestIndex(blob Blob, merged map[int]bool, cfg *DetectionConfig) int {
+	// known blobs that can't match are skipped as if already merged
+	if cfg.MergeSameClassOnly {
+		skipped := make(map[int]bool, len(b.blobs))
+		for i, known := range b.blobs {
+			skipped[i] = merged[i] || known.Category != blob.Category
+		}
+		merged = skipped
+	}
+	if cfg.MatchStrategy == "hybrid" {
+		return b.findBestMatchIndex(blob, merged, cfg.MaxMatchDistance)
+	}
+	blobFindNearestThreshold := cfg.MemoryNearnessThreshold
+	maxNearness := 0.0
+	maxIndex := -1
+	for i, known := range b.blobs {
+		nearness := known.Position.Center().Near(blob.Position.Center())
+		// The nearess value should be above a certain threshold
+		if !merged[i] && nearness > blobFindNearestThreshold && nearness > maxNearness {
+			maxNearness = nearness
+			maxIndex = i
+		}
+	}
+	return maxIndex
+}
+
+const defaultMaxMatchDistance = 100
+
+// Returns the index of the known blob with the highest matchScore with
+// the new one, or -1 if none is within maxDistance
+func (b *BlobList) findBestMatchIndex(blob Blob, merged map[int]bool, maxDistance int) int {
+	if maxDistance == 0 {
+		maxDistance = defaultMaxMatchDistance
+	}
+	maxScore := 0.0
+	maxIndex := -1
+	for i, known := range b.blobs {
+		score := matchScore(known.Position, blob.Position, float64(maxDistance))
+		if !merged[i] && score > maxScore {
+			maxScore = score
+			maxIndex = i
+		}
+	}
+	return maxIndex
+}
+
+// matchScore returns how likely two boxes belong to the same entity, from
+// 0 to 1. Overlapping boxes score above 0.5 according to their IoU, which
+// suits large entities, while the other ones score below 0.5 according to
+// the distance of their centers, which suits small entities moving fast,
+// and 0 if farther than maxDistance.
+func matchScore(a, b BlobPosition, maxDistance float64) float64 {
+	if iou := a.IoU(b); iou > 0 {
+		return 0.5 + iou/2
+	}
+	distance := a.Center().Distance(b.Center())
+	if distance >= maxDistance {
+		return 0
+	}
+	return (1 - distance/maxDistance) / 2
+}
+
+// Merges a new blob with a known one
+func (b *BlobList) mergeAtIndex(blob Blob, index int, blobMergeConfidenceThreshold, minClassSwitchConfidence float64, now time.Time) bool {
+	changed := false
+	// switching between two low-confidence classes is just noise
+	switchAllowed := blob.Category == b.blobs[index].Category || blob.Confidence > minClassSwitchConfidence
+	// If the confidence of the new blob is better than the current
+	// one, both the confidence and the class are overridden.
+	if switchAllowed && blob.Confidence >= b.blobs[index].Confidence+blobMergeConfidenceThreshold {
+		changed = b.blobs[index].Category != blob.Category
+		b.blobs[index].Confidence = blob.Confidence
+		b.blobs[index].Category = blob.Category
+	}
+	if len(blob.Scores) > 0 {
+		b.blobs[index].Scores = blob.Scores
+	}
+	prev := b.blobs[index].Position.Center()
+	// The position is the mean value of all the coordinates of the two blobs
+	b.blobs[index].Position.Top = (b.blobs[index].Position.Top + blob.Position.Top) / 2
+	b.blobs[index].Position.Left = (b.blobs[index].Position.Left + blob.Position.Left) / 2
+	b.blobs[index].Position.Bottom = (b.blobs[index].Position.Bottom + blob.Position.Bottom) / 2
+	b.blobs[index].Position.Right = (b.blobs[index].Position.Right + blob.Position.Right) / 2
+	cur := b.blobs[index].Position.Center()
+	b.blobs[index].velocity = BlobPoint{cur.x - prev.x, cur.y - prev.y}
+	b.blobs[index].coasting = 0
+	b.blobs[index].LastSeen = now
+	return changed
+}
+
+// Decreases the confidence of all the known blobs.
+// If the confidence crosses a threshold, or the blob is older than
+// maxAge (if positive), the blob is discarded. Confirmed blobs crossing
+// the threshold first coast along their last velocity for grace cycles.
+// If trace is true, the decayed confidence values are recorded.
+func (b *BlobList) refreshConfidence(decayFactor func(CategoryID) float64, blobConfidenceRefreshThreshold float64, trace debugLogger, maxAge time.Duration, now time.Time, grace int) {
+	var newBlobs []Blob
+	for _, blob := range b.blobs {
+		if maxAge > 0 && now.Sub(blob.FirstSeen) > maxAge {
+			trace.Printf("blob %d retired for its age, confidence trace: %v", blob.ID, blob.DecayTrace)
+			continue
+		}
+		blob.Confidence = blob.Confidence * decayFactor(blob.Category)
+		if trace {
+			blob.DecayTrace = append(blob.DecayTrace, blob.Confidence)
+			if len(blob.DecayTrace) > decayTraceLength {
+				blob.DecayTrace = append([]float64(nil), blob.DecayTrace[len(blob.DecayTrace)-decayTraceLength:]...)
+			}
+		}
+		if blob.Confidence > blobConfidenceRefreshThreshold {
+			newBlobs = append(newBlobs, blob)
+		} else if blob.confirmed && blob.coasting < grace {
+			blob.coasting++
+			blob.Position.Left += blob.velocity.x
+			blob.Position.Right += blob.velocity.x
+			blob.Position.Top += blob.velocity.y
+			blob.Position.Bottom += blob.velocity.y
+			newBlobs = append(newBlobs, blob)
+		} else {
+			trace.Printf("blob %d retired, confidence trace: %v", blob.ID, blob.DecayTrace)
+		}
+	}
+	b.blobs = newBlobs
+}
+
+// Appends the current center to the trail of the blob,
+// keeping only the last trailLength ones.
+func (b *Blob) track(trailLength int) {
+	if trailLength <= 0 {
+		return
+	}
+	b.trail = append(b.trail, b.Position.Center())
+	if len(b.trail) > trailLength {
+		b.trail = append([]BlobPoint(nil), b.trail[len(b.trail)-trailLength:]...)
+	}
+}
+
+// Returns the last known centers of the blob, oldest first
+func (b Blob) Trail() []BlobPoint {
+	return b.trail
+}
+
+// Registers a detection of the blob in the current refresh cycle.
+// Returns true if the blob just became confirmed.
+func (b *Blob) hit(minConsecutiveFrames int) bool {
+	b.hits++
+	if !b.confirmed && b.hits >= minConsecutiveFrames {
+		b.confirmed = true
+		return true
+	}
+	return false
+}
+
+// Discards the unconfirmed blobs that have not been detected
+// in the current refresh cycle.
+func (b *BlobList) dropUnconfirmed(seen map[int]bool) {
+	var newBlobs []Blob
+	for i, blob := range b.blobs {
+		if blob.confirmed || seen[i] {
+			newBlobs = append(newBlobs, blob)
+		}
+	}
+	b.blobs = newBlobs
+}
+
+// Distance returns the euclidean distance between two points
+func (b BlobPoint) Distance(other BlobPoint) float64 {
+	return math.Hypot(float64(b.x-other.x), float64(b.y-other.y))
+}
+
+// Overlaps returns true if the two rectangles intersect
+func (b BlobPosition) Overlaps(other BlobPosition) bool {
+	return b.Left < other.Right && other.Left < b.Right && b.Top < other.Bottom && other.Top < b.Bottom
+}
+
+// Updates the dwell time of each blob, and flags the non-human ones that
+// have been stationary for too long with no human overlapping them.
+// Returns true if any blob has just been flagged as abandoned.
+func (b *BlobList) updateDwell(cfg *DetectionConfig, now time.Time) bool {
+	radius := cfg.AbandonedRadius
+	if radius == 0 {
+		radius = defaultAbandonedRadius
+	}
+	changed := false
+	for i := range b.blobs {
+		blob := &b.blobs[i]
+		center := blob.Position.Center()
+		if blob.anchorSince.IsZero() || center.Distance(blob.anchor) > float64(radius) {
+			blob.anchor = center
+			blob.anchorSince = now
+		}
+
+		abandoned := false
+		if blob.Category != Human && now.Sub(blob.anchorSince).Seconds() >= cfg.AbandonedSeconds {
+			abandoned = true
+			for _, other := range b.blobs {
+				if other.Category == Human && other.Position.Overlaps(blob.Position) {
+					abandoned = false
+					break
+				}
+			}
+		}
+		if abandoned && !blob.Abandoned && blob.confirmed {
+			changed = true
+		}
+		blob.Abandoned = abandoned
+	}
+	return changed
+}
+
+// Adds new blob observations
+func (b *BlobList) Update(blobs []Blob, cfg *DetectionConfig) bool {
+	changed := false
+	b.added = 0
+
+	merged := make(map[int]bool)
+	seen := make(map[int]bool)
+	now := b.clock()
+	maxAge := time.Duration(cfg.MaxBlobAgeSeconds * float64(time.Second))
+	b.refreshConfidence(cfg.decayFactor, cfg.MemoryMinConfidence, debugLogger(cfg.DebugDecay), maxAge, now, cfg.RetirementGraceFrames)
+	for _, blob := range blobs {
+		nearestIndex := b.findNearestIndex(blob, merged, cfg)
+		if nearestIndex < 0 {
+			b.nextID++
+			blob.ID = b.nextID
+			blob.hits = 0
+			blob.confirmed = false
+			blob.trail = nil
+			blob.DecayTrace = nil
+			blob.FirstSeen = now
+			blob.LastSeen = now
+			b.blobs = append(b.blobs, blob)
+			nearestIndex = len(b.blobs) - 1
+		} else {
+			if b.mergeAtIndex(blob, nearestIndex, cfg.MemoryClassSwitchThreshold, cfg.MinClassSwitchConfidence, now) && b.blobs[nearestIndex].confirmed {
+				changed = true
+			}
+			if !cfg.MemoryCollapseMultiple {
+				merged[nearestIndex] = true
+			}
+		}
+		b.blobs[nearestIndex].track(b.trailLength)
+		// A blob is counted only once per cycle, even if multiple
+		// detections are collapsed into it
+		if !seen[nearestIndex] {
+			seen[nearestIndex] = true
+			if b.blobs[nearestIndex].hit(cfg.MinConsecutiveFrames) {
+				b.added++
+				changed = true
+			}
+		}
+	}
+	b.dropUnconfirmed(seen)
+	if cfg.AbandonedSeconds > 0 && b.updateDwell(cfg, now) {
+		changed = true
+	}
+	if len(cfg.Zones) > 0 {
+		b.zoneEnter, b.zoneExit = b.updateZones(cfg.Zones)
+		if len(b.zoneEnter) > 0 || len(b.zoneExit) > 0 {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Added returns the number of blobs confirmed by the last Update
+func (b *BlobList) Added() int {
+	return b.added
+}
+
+// ZoneTransitions returns the zones entered and exited during the last Update
+func (b *BlobList) ZoneTransitions() (enter, exit []ZoneTransition) {
+	return b.zoneEnter, b.zoneExit
+}
+
+// Returns a copy of the known blobs that have been confirmed,
+// sorted by descending confidence
+func (b *BlobList) Blobs() []Blob {
+	var blobs []Blob
+	for _, blob := range b.blobs {
+		if blob.confirmed {
+			blob.trail = append([]BlobPoint(nil), blob.trail...)
+			blob.DecayTrace = append([]float64(nil), blob.DecayTrace...)
+			blobs = append(blobs, blob)
+		}
+	}
+	sort.SliceStable(blobs, func(i, j int) bool {
+		return blobs[i].Confidence > blobs[j].Confidence
+	})
+	return blobs
+}
+
+// BlobDelta describes how a set of blobs changed
+type BlobDelta struct {
+	Added   []Blob
+	Removed []Blob
+	Updated []Blob
+}
+
+// Empty returns true if nothing changed
+func (d BlobDelta) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Updated) == 0
+}
+
+// movedBlobs returns the blobs whose center moved farther than threshold
+// pixels from where it was in prev, matching them by their stable IDs
+func movedBlobs(prev, cur []Blob, threshold float64) []Blob {
+	known := make(map[uint64]BlobPoint, len(prev))
+	for _, blob := range prev {
+		known[blob.ID] = blob.Position.Center()
+	}
+	var moved []Blob
+	for _, blob := range cur {
+		if center, ok := known[blob.ID]; ok && blob.Position.Center().Distance(center) > threshold {
+			moved = append(moved, blob)
+		}
+	}
+	return moved
+}
+
+// diffBlobs computes the changes between two sets of blobs,
+// matching them by their stable IDs. Blobs that have moved or
+// switched category are reported as updated.
+func diffBlobs(prev, cur []Blob) BlobDelta {
+	var delta BlobDelta
+	known := make(map[uint64]Blob, len(prev))
+	for _, blob := range prev {
+		known[blob.ID] = blob
+	}
+	for _, blob := range cur {
+		old, ok := known[blob.ID]
+		if !ok {
+			delta.Added = append(delta.Added, blob)
+			continue
+		}
+		if old.Position != blob.Position || old.Category != blob.Category {
+			delta.Updated = append(delta.Updated, blob)
+		}
+		delete(known, blob.ID)
+	}
+	for _, blob := range prev {
+		if _, ok := known[blob.ID]; ok {
+			delta.Removed = append(delta.Removed, blob)
+		}
+	}
+	return delta
+}
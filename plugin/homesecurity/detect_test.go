@@ -0,0 +1,533 @@
+package homesecurity
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testBlob returns a 100x200 blob of the category at the given position
+func testBlob(c CategoryID, left, top int, confidence float64) Blob {
+	return Blob{
+		Category:   c,
+		Confidence: confidence,
+		Position:   BlobPosition{Left: left, Top: top, Right: left + 100, Bottom: top + 200},
+	}
+}
+
+// testTrackConfig returns a tracking config under which a blob survives
+// a few frames without detections
+func testTrackConfig() *DetectionConfig {
+	return &DetectionConfig{
+		MemoryDecayFactor:          0.9,
+		MemoryMinConfidence:        0.3,
+		MemoryNearnessThreshold:    0.8,
+		MemoryClassSwitchThreshold: 0.1,
+	}
+}
+
+// updates returns whether each frame changed the list
+func updates(list *BlobList, cfg *DetectionConfig, frames ...[]Blob) []bool {
+	var changes []bool
+	for _, frame := range frames {
+		changes = append(changes, list.Update(frame, cfg))
+	}
+	return changes
+}
+
+func TestMinConsecutiveFrames(t *testing.T) {
+	human := testBlob(Human, 100, 100, 0.9)
+	tests := []struct {
+		name   string
+		frames [][]Blob
+		want   []bool
+		blobs  int
+	}{
+		{"spurious", [][]Blob{{human}, nil, nil}, []bool{false, false, false}, 0},
+		{"interrupted", [][]Blob{{human}, {human}, nil, {human}}, []bool{false, false, false, false}, 0},
+		{"sustained", [][]Blob{{human}, {human}, {human}, {human}}, []bool{false, false, true, false}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testTrackConfig()
+			cfg.MinConsecutiveFrames = 3
+			var list BlobList
+			got := updates(&list, cfg, tt.frames...)
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("frame %d: got changed %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+			if n := len(list.Blobs()); n != tt.blobs {
+				t.Errorf("got %d confirmed blobs, want %d", n, tt.blobs)
+			}
+		})
+	}
+}
+
+func TestTrail(t *testing.T) {
+	cfg := testTrackConfig()
+	list := BlobList{trailLength: 3}
+	for i := 0; i < 5; i++ {
+		list.Update([]Blob{testBlob(Human, 100+10*i, 100, 0.9)}, cfg)
+	}
+	blobs := list.Blobs()
+	if len(blobs) != 1 {
+		t.Fatalf("got %d blobs, want 1", len(blobs))
+	}
+	// merged positions are smoothed, so only the trimming and
+	// the order of the centers are checked
+	trail := blobs[0].Trail()
+	if len(trail) != 3 {
+		t.Fatalf("got trail %v, want 3 centers", trail)
+	}
+	if trail[2] != blobs[0].Position.Center() || trail[0].x >= trail[1].x || trail[1].x >= trail[2].x {
+		t.Errorf("got trail %v, want the last centers, oldest first", trail)
+	}
+
+	// once retired, the blob leaves no trail behind
+	for len(list.Blobs()) > 0 {
+		list.Update(nil, cfg)
+	}
+	list.Update([]Blob{testBlob(Human, 140, 100, 0.9)}, cfg)
+	if blobs := list.Blobs(); len(blobs) != 1 || len(blobs[0].Trail()) != 1 {
+		t.Errorf("got %+v, want a single blob with a single center", blobs)
+	}
+}
+
+func TestBlobsSortedCopy(t *testing.T) {
+	cfg := testTrackConfig()
+	var list BlobList
+	list.Update([]Blob{
+		testBlob(Human, 100, 100, 0.5),
+		testBlob(Animal, 400, 100, 0.9),
+		testBlob(Human, 700, 100, 0.7),
+	}, cfg)
+
+	blobs := list.Blobs()
+	if len(blobs) != 3 {
+		t.Fatalf("got %d blobs, want 3", len(blobs))
+	}
+	for i := 1; i < len(blobs); i++ {
+		if blobs[i].Confidence > blobs[i-1].Confidence {
+			t.Errorf("blob %d (%.2f) sorted after blob %d (%.2f)", i, blobs[i].Confidence, i-1, blobs[i-1].Confidence)
+		}
+	}
+
+	// the internal list keeps the insertion order, and is not
+	// affected by changes to the returned copy
+	blobs[0].Confidence = 0
+	blobs[0].Position.Left = 0
+	for i, want := range []float64{0.5, 0.9, 0.7} {
+		if got := list.blobs[i].Confidence; got != want {
+			t.Errorf("internal blob %d: got confidence %.2f, want %.2f", i, got, want)
+		}
+	}
+	if list.blobs[1].Position.Left != 400 {
+		t.Errorf("internal blob moved to %d", list.blobs[1].Position.Left)
+	}
+}
+
+// ids returns the IDs of the blobs
+func ids(blobs []Blob) []uint64 {
+	var list []uint64
+	for _, blob := range blobs {
+		list = append(list, blob.ID)
+	}
+	return list
+}
+
+func sameIDs(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDiffBlobs(t *testing.T) {
+	cfg := testTrackConfig()
+	var list BlobList
+	list.Update([]Blob{testBlob(Human, 100, 100, 0.9)}, cfg)
+	first := list.Blobs()
+
+	// the human moves, while an animal appears far away
+	list.Update([]Blob{testBlob(Human, 110, 100, 0.9), testBlob(Animal, 700, 100, 0.8)}, cfg)
+	second := list.Blobs()
+
+	// the animal keeps being detected, the human leaves
+	third := second
+	for len(third) == 2 {
+		list.Update([]Blob{testBlob(Animal, 700, 100, 0.8)}, cfg)
+		third = list.Blobs()
+	}
+
+	tests := []struct {
+		name                    string
+		prev, cur               []Blob
+		added, removed, updated []uint64
+	}{
+		{"appearance and move", first, second, []uint64{2}, nil, []uint64{1}},
+		{"disappearance", second, third, nil, []uint64{1}, nil},
+		{"no change", third, third, nil, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delta := diffBlobs(tt.prev, tt.cur)
+			if !sameIDs(ids(delta.Added), tt.added) || !sameIDs(ids(delta.Removed), tt.removed) || !sameIDs(ids(delta.Updated), tt.updated) {
+				t.Errorf("got added %v, removed %v, updated %v, want %v, %v, %v",
+					ids(delta.Added), ids(delta.Removed), ids(delta.Updated), tt.added, tt.removed, tt.updated)
+			}
+			if got := delta.Empty(); got != (len(tt.added)+len(tt.removed)+len(tt.updated) == 0) {
+				t.Errorf("got empty %v", got)
+			}
+		})
+	}
+}
+
+func TestMovedBlobs(t *testing.T) {
+	at := func(id uint64, left, top int) Blob {
+		blob := testBlob(Human, left, top, 0.9)
+		blob.ID = id
+		return blob
+	}
+	prev := []Blob{at(1, 100, 100), at(2, 400, 100)}
+	tests := []struct {
+		name  string
+		cur   []Blob
+		moved []uint64
+	}{
+		{"still", prev, nil},
+		// moving the center by exactly the threshold is not enough
+		{"at the threshold", []Blob{at(1, 130, 140), at(2, 400, 100)}, nil},
+		{"past the threshold", []Blob{at(1, 130, 141), at(2, 400, 100)}, []uint64{1}},
+		{"both", []Blob{at(1, 200, 100), at(2, 400, 0)}, []uint64{1, 2}},
+		// new blobs are added, not moved
+		{"new", []Blob{at(3, 600, 600)}, nil},
+	}
+	for _, tt := range tests {
+		if got := ids(movedBlobs(prev, tt.cur, 50)); !sameIDs(got, tt.moved) {
+			t.Errorf("%s: got moved %v, want %v", tt.name, got, tt.moved)
+		}
+	}
+}
+
+func TestDecayTrace(t *testing.T) {
+	cfg := testTrackConfig()
+	cfg.DebugDecay = true
+	var list BlobList
+	list.Update([]Blob{testBlob(Human, 100, 100, 0.9)}, cfg)
+	for i := 0; i < 4; i++ {
+		list.Update(nil, cfg)
+	}
+	blobs := list.Blobs()
+	if len(blobs) != 1 {
+		t.Fatalf("got %d blobs, want 1", len(blobs))
+	}
+	trace := blobs[0].DecayTrace
+	if len(trace) != 4 {
+		t.Fatalf("got trace %v, want 4 values", trace)
+	}
+	want := 0.9
+	for i, c := range trace {
+		want *= cfg.MemoryDecayFactor
+		if math.Abs(c-want) > 1e-9 {
+			t.Errorf("decay %d: got %.4f, want %.4f", i+1, c, want)
+		}
+	}
+
+	line, err := encodeEventLine(&VideoEvent{Blobs: blobs}, lineFormat{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(line), "DecayTrace") {
+		t.Errorf("trace serialized in %s", line)
+	}
+}
+
+func TestAbandoned(t *testing.T) {
+	bag := testBlob(Animal, 300, 100, 0.9)
+	tests := []struct {
+		name   string
+		others []Blob
+		want   bool
+	}{
+		{"nobody around", nil, true},
+		{"human far away", []Blob{testBlob(Human, 20, 100, 0.9)}, true},
+		{"human next to it", []Blob{testBlob(Human, 350, 150, 0.9)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testTrackConfig()
+			cfg.MemoryNearnessThreshold = 0.9
+			cfg.AbandonedSeconds = 10
+			now := time.Unix(1000, 0)
+			list := BlobList{now: func() time.Time { return now }}
+			flagged := -1
+			for i := 0; i <= 15; i++ {
+				if list.Update(append([]Blob{bag}, tt.others...), cfg) && flagged < 0 && i > 0 {
+					flagged = i
+				}
+				now = now.Add(time.Second)
+			}
+			abandoned := false
+			for _, blob := range list.Blobs() {
+				if blob.Category == Animal {
+					abandoned = blob.Abandoned
+				}
+			}
+			if abandoned != tt.want {
+				t.Fatalf("got abandoned %v, want %v", abandoned, tt.want)
+			}
+			if tt.want && flagged != 10 {
+				t.Errorf("flagged after %d seconds, want 10", flagged)
+			}
+		})
+	}
+}
+
+func TestAddedBurst(t *testing.T) {
+	crowd := []Blob{
+		testBlob(Human, 0, 100, 0.9),
+		testBlob(Human, 300, 100, 0.9),
+		testBlob(Human, 600, 100, 0.9),
+		testBlob(Human, 900, 100, 0.9),
+	}
+	tests := []struct {
+		name   string
+		frames [][]Blob
+		want   []int
+	}{
+		{"all at once", [][]Blob{crowd}, []int{4}},
+		{"one at a time", [][]Blob{crowd[:1], crowd[:2], crowd[:3], crowd}, []int{1, 1, 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testTrackConfig()
+			cfg.BurstThreshold = 2
+			var list BlobList
+			for i, frame := range tt.frames {
+				list.Update(frame, cfg)
+				if got := list.Added(); got != tt.want[i] {
+					t.Errorf("frame %d: got %d added, want %d", i, got, tt.want[i])
+				}
+				if burst := list.Added() > cfg.BurstThreshold; burst != (tt.want[i] > 2) {
+					t.Errorf("frame %d: got burst %v", i, burst)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxBlobAge(t *testing.T) {
+	tests := []struct {
+		elapsed time.Duration
+		kept    bool
+	}{
+		{3 * time.Second, true},
+		{6 * time.Second, false},
+	}
+	for _, tt := range tests {
+		cfg := testTrackConfig()
+		cfg.MaxBlobAgeSeconds = 5
+		now := time.Unix(1000, 0)
+		list := BlobList{now: func() time.Time { return now }}
+		list.Update([]Blob{testBlob(Human, 100, 100, 0.9)}, cfg)
+
+		// a single decay leaves the confidence well above the threshold
+		now = now.Add(tt.elapsed)
+		list.Update(nil, cfg)
+		if kept := len(list.Blobs()) == 1; kept != tt.kept {
+			t.Errorf("after %s: got kept %v, want %v", tt.elapsed, kept, tt.kept)
+		}
+	}
+}
+
+func TestRetirementGrace(t *testing.T) {
+	tests := []struct {
+		grace  int
+		sameID bool
+	}{
+		{0, false},
+		{3, true},
+	}
+	for _, tt := range tests {
+		cfg := testTrackConfig()
+		cfg.RetirementGraceFrames = tt.grace
+		var list BlobList
+		// barely above the threshold, so that the first decay crosses it
+		blob := testBlob(Human, 100, 100, 0.32)
+		list.Update([]Blob{blob}, cfg)
+		id := list.Blobs()[0].ID
+
+		// occluded for a couple of frames
+		list.Update(nil, cfg)
+		list.Update(nil, cfg)
+		list.Update([]Blob{blob}, cfg)
+		blobs := list.Blobs()
+		if len(blobs) != 1 {
+			t.Fatalf("grace %d: got %d blobs, want 1", tt.grace, len(blobs))
+		}
+		if sameID := blobs[0].ID == id; sameID != tt.sameID {
+			t.Errorf("grace %d: got ID %d after %d, same ID %v, want %v", tt.grace, blobs[0].ID, id, sameID, tt.sameID)
+		}
+	}
+}
+
+func TestMatchScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		left     int
+		min, max float64
+	}{
+		// IoU of 1/3
+		{"overlapping", 50, 0.66, 0.67},
+		// centers 130 pixels apart
+		{"close", 130, 0.17, 0.18},
+		{"far", 500, 0, 0},
+	}
+	a := testBlob(Human, 0, 0, 0.9).Position
+	for _, tt := range tests {
+		b := testBlob(Human, tt.left, 0, 0.9).Position
+		if score := matchScore(a, b, 200); score < tt.min || score > tt.max {
+			t.Errorf("%s: got score %f, want between %f and %f", tt.name, score, tt.min, tt.max)
+		}
+	}
+}
+
+func TestHybridMatching(t *testing.T) {
+	tests := []struct {
+		name   string
+		left   int
+		sameID bool
+	}{
+		{"overlapping", 50, true},
+		{"close", 130, true},
+		{"far", 500, false},
+	}
+	for _, tt := range tests {
+		cfg := testTrackConfig()
+		cfg.MatchStrategy = "hybrid"
+		cfg.MaxMatchDistance = 200
+		var list BlobList
+		list.Update([]Blob{testBlob(Human, 0, 0, 0.9)}, cfg)
+		id := list.Blobs()[0].ID
+
+		// a matched blob is merged into the known one, the other ones
+		// are added next to it
+		list.Update([]Blob{testBlob(Human, tt.left, 0, 0.9)}, cfg)
+		blobs := list.Blobs()
+		matched := len(blobs) == 1 && blobs[0].ID == id
+		if matched != tt.sameID {
+			t.Errorf("%s: got matched %v, want %v", tt.name, matched, tt.sameID)
+		}
+	}
+}
+
+func TestMinClassSwitchConfidence(t *testing.T) {
+	tests := []struct {
+		floor float64
+		want  CategoryID
+	}{
+		{0, Animal},
+		{0.5, Animal},
+		// the animal box is more confident, but still below the floor
+		{0.6, Human},
+	}
+	for _, tt := range tests {
+		cfg := testTrackConfig()
+		cfg.MinClassSwitchConfidence = tt.floor
+		var list BlobList
+		list.Update([]Blob{testBlob(Human, 100, 100, 0.4)}, cfg)
+		list.Update([]Blob{testBlob(Animal, 100, 100, 0.55)}, cfg)
+		blobs := list.Blobs()
+		if len(blobs) != 1 {
+			t.Fatalf("floor %v: got %d blobs, want 1", tt.floor, len(blobs))
+		}
+		if blobs[0].Category != tt.want {
+			t.Errorf("floor %v: got class %s, want %s", tt.floor, blobs[0].Category, tt.want)
+		}
+	}
+}
+
+func TestMergeSameClassOnly(t *testing.T) {
+	tests := []struct {
+		sameClassOnly bool
+		tracks        int
+	}{
+		{false, 1},
+		{true, 2},
+	}
+	for _, tt := range tests {
+		cfg := testTrackConfig()
+		cfg.MergeSameClassOnly = tt.sameClassOnly
+		var list BlobList
+		list.Update([]Blob{testBlob(Human, 100, 100, 0.9)}, cfg)
+		// a dog overlapping the person
+		list.Update([]Blob{testBlob(Animal, 110, 120, 0.9)}, cfg)
+		blobs := list.Blobs()
+		if len(blobs) != tt.tracks {
+			t.Fatalf("same class only %v: got %d tracks, want %d", tt.sameClassOnly, len(blobs), tt.tracks)
+		}
+		if tt.sameClassOnly && blobs[0].Category == blobs[1].Category {
+			t.Errorf("got two %s tracks, want a human and an animal one", blobs[0].Category)
+		}
+	}
+}
+
+func TestLastSeen(t *testing.T) {
+	cfg := testTrackConfig()
+	now := time.Unix(1000, 0)
+	list := BlobList{now: func() time.Time { return now }}
+	steps := []struct {
+		blobs    []Blob
+		lastSeen time.Time
+	}{
+		// set on insertion
+		{[]Blob{testBlob(Human, 100, 100, 0.9)}, time.Unix(1000, 0)},
+		// kept while not detected
+		{nil, time.Unix(1000, 0)},
+		// advanced on merge
+		{[]Blob{testBlob(Human, 105, 100, 0.9)}, time.Unix(1002, 0)},
+	}
+	for i, s := range steps {
+		list.Update(s.blobs, cfg)
+		blobs := list.Blobs()
+		if len(blobs) != 1 {
+			t.Fatalf("step %d: got %d blobs, want 1", i, len(blobs))
+		}
+		if !blobs[0].LastSeen.Equal(s.lastSeen) {
+			t.Errorf("step %d: got last seen %s, want %s", i, blobs[0].LastSeen, s.lastSeen)
+		}
+		now = now.Add(time.Second)
+	}
+}
+
+func TestDecayFactorByClass(t *testing.T) {
+	cfg := testTrackConfig()
+	cfg.MemoryMinConfidence = 0.01
+	cfg.MemoryDecayFactorByClass = map[string]float64{"animal": 0.5}
+	var list BlobList
+	list.Update([]Blob{testBlob(Human, 0, 0, 0.8), testBlob(Animal, 400, 0, 0.8)}, cfg)
+	for i := 0; i < 3; i++ {
+		list.Update(nil, cfg)
+	}
+	want := map[CategoryID]float64{
+		Human:  0.8 * math.Pow(0.9, 3),
+		Animal: 0.8 * math.Pow(0.5, 3),
+	}
+	blobs := list.Blobs()
+	if len(blobs) != 2 {
+		t.Fatalf("got %d blobs, want 2", len(blobs))
+	}
+	for _, blob := range blobs {
+		if math.Abs(blob.Confidence-want[blob.Category]) > 1e-9 {
+			t.Errorf("%s: got confidence %f, want %f", blob.Category, blob.Confidence, want[blob.Category])
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package homesecurity
+
+import (
+	"fmt"
+	"image"
+	"sort"
+
+	"gocv.io/x/gocv"
+)
+
+// detector finds the blobs contained in a frame
+type detector interface {
+	Detect(img *gocv.Mat) ([]Blob, error)
+	Close() error
+}
+
+// normalization describes how frames are preprocessed before being fed
+// to the network, as in (frame - mean) * scale
+type normalization struct {
+	scale  float64
+	mean   [3]float64
+	swapRB bool
+	crop   bool
+}
+
+var normalizationPresets = map[string]normalization{
+	"mobilenet": {scale: 1.0 / 127.5, mean: [3]float64{127.5, 127.5, 127.5}, swapRB: true},
+	"0-1":       {scale: 1.0 / 255.0, mean: [3]float64{0, 0, 0}, swapRB: true},
+	// mean is in BGR order, given that channels are not swapped
+	"imagenet": {scale: 1.0 / 255.0, mean: [3]float64{103.53, 116.28, 123.675}, swapRB: false},
+	"custom":   {scale: 1.0, mean: [3]float64{0, 0, 0}, swapRB: true},
+}
+
+// Returns the normalization selected by the config preset,
+// with the explicit overrides applied.
+func (cfg *DetectionConfig) normalization() normalization {
+	preset := cfg.Normalization
+	if len(preset) == 0 {
+		preset = "mobilenet"
+	}
+	n := normalizationPresets[preset]
+	if cfg.InputScale > 0 {
+		n.scale = cfg.InputScale
+	}
+	if len(cfg.InputMean) == 3 {
+		copy(n.mean[:], cfg.InputMean)
+	}
+	if cfg.SwapRB != nil {
+		n.swapRB = *cfg.SwapRB
+	}
+	n.crop = cfg.CropInput
+	return n
+}
+
+// inputBlob converts the image to the 300x300 blob that the object
+// detector can analyze; the caller is responsible to close it
+func (n normalization) inputBlob(img gocv.Mat) gocv.Mat {
+	mean := gocv.NewScalar(n.mean[0], n.mean[1], n.mean[2], 0)
+	return gocv.BlobFromImage(img, n.scale, image.Pt(300, 300), mean, n.swapRB, n.crop)
+}
+
+// netDetector runs a DNN object detection model on each frame
+type netDetector struct {
+	net  *sharedNet
+	cfg  *DetectionConfig
+	norm normalization
+
+	// only set if auto contrast is enabled
+	enhancer *contrastEnhancer
+	enhanced gocv.Mat
+
+	// sizes of the outputs of the last forward pass, reported by DryRun
+	shapes [][]int
+}
+
+func newNetDetector(cfg *DetectionConfig) (*netDetector, error) {
+	net, err := acquireNet(cfg)
+	if err != nil {
+		return nil, err
+	}
+	d := &netDetector{net: net, cfg: cfg, norm: cfg.normalization()}
+	if cfg.AutoContrast {
+		d.enhancer = newContrastEnhancer()
+		d.enhanced = gocv.NewMat()
+	}
+	return d, nil
+}
+
+func (d *netDetector) Detect(img *gocv.Mat) ([]Blob, error) {
+	// the original frame is left untouched, as it's used for snapshots
+	input := *img
+	if d.enhancer != nil {
+		d.enhancer.Apply(*img, &d.enhanced)
+		input = d.enhanced
+	}
+
+	tiles := splitTiles(image.Rect(0, 0, img.Cols(), img.Rows()), d.cfg.TileRows, d.cfg.TileCols)
+	if len(tiles) == 1 {
+		return d.detectArea(img, input, tiles[0])
+	}
+
+	var blobs []Blob
+	for _, tile := range tiles {
+		region := input.Region(tile)
+		tileBlobs, err := d.detectArea(img, region, tile)
+		region.Close()
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, tileBlobs...)
+	}
+	// objects in the overlap between tiles are detected more than once
+	threshold := d.cfg.NmsThreshold
+	if threshold == 0 {
+		threshold = defaultNmsThreshold
+	}
+	return suppressOverlaps(blobs, threshold), nil
+}
+
+// Runs the network on the input, which is the given area of the frame
+func (d *netDetector) detectArea(frame *gocv.Mat, input gocv.Mat, area image.Rectangle) ([]Blob, error) {
+	blob := d.norm.inputBlob(input)
+	defer blob.Close()
+
+	// feed the blob into the detector and run a forward pass through the network
+	outputs := forwardOutputs(d.net, blob, d.cfg)
+	defer closeMats(outputs)
+	d.shapes = d.shapes[:0]
+	for _, o := range outputs {
+		d.shapes = append(d.shapes, o.Size())
+	}
+	prob, err := decodeOutputs(outputs, d.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode network outputs: %s", err.Error())
+	}
+	defer prob.Close()
+
+	return PerformBlob(frame, area, prob, d.cfg)
+}
+
+// number of best classes kept for each box of boxes-scores models
+const boxesScoresClasses = 3
+
+// forwardOutputs runs a forward pass of the blob, returning the outputs
+// of the layers configured for the kind of model
+func forwardOutputs(net *sharedNet, blob gocv.Mat, cfg *DetectionConfig) []gocv.Mat {
+	if len(cfg.OutputLayers) == 0 {
+		return []gocv.Mat{net.Forward(blob)}
+	}
+	return net.ForwardLayers(blob, cfg.OutputLayers)
+}
+
+// decodeOutputs converts the network outputs to the SSD format, that is a
+// single 1x1xNx7 output, handled by PerformBlob. The caller is responsible
+// to close the returned Mat.
+func decodeOutputs(outputs []gocv.Mat, cfg *DetectionConfig) (gocv.Mat, error) {
+	if len(outputs) == 0 {
+		return gocv.Mat{}, fmt.Errorf("no output from layers %v", cfg.OutputLayers)
+	}
+	if cfg.ModelKind != "boxes-scores" {
+		return outputs[0].Clone(), nil
+	}
+	if len(outputs) != 2 {
+		return gocv.Mat{}, fmt.Errorf("expected boxes and scores outputs, got %d", len(outputs))
+	}
+	return decodeBoxesScores(outputs[0], outputs[1])
+}
+
+// decodeBoxesScores decodes the separate outputs of models giving, for each
+// of N detections, a box as normalized [left, top, right, bottom] and the
+// score of every class, as Nx4 and NxC. Class indexes are COCO class IDs,
+// with 0 being the background. The best classes of each box become rows of
+// an SSD output, so that the runner-up ones are available too.
+func decodeBoxesScores(boxes, scores gocv.Mat) (gocv.Mat, error) {
+	b, err := boxes.DataPtrFloat32()
+	if err != nil {
+		return gocv.Mat{}, err
+	}
+	s, err := scores.DataPtrFloat32()
+	if err != nil {
+		return gocv.Mat{}, err
+	}
+	n := len(b) / 4
+	if n == 0 {
+		return gocv.NewMat(), nil
+	}
+	if len(b)%4 != 0 || len(s)%n != 0 {
+		return gocv.Mat{}, fmt.Errorf("mismatching boxes %v and scores %v outputs", boxes.Size(), scores.Size())
+	}
+	classes := len(s) / n
+
+	var rows []float32
+	for i := 0; i < n; i++ {
+		classScores := s[i*classes : (i+1)*classes]
+		best := make([]int, 0, classes)
+		for c := 1; c < classes; c++ {
+			if classScores[c] > 0 {
+				best = append(best, c)
+			}
+		}
+		sort.SliceStable(best, func(x, y int) bool {
+			return classScores[best[x]] > classScores[best[y]]
+		})
+		if len(best) > boxesScoresClasses {
+			best = best[:boxesScoresClasses]
+		}
+		for _, c := range best {
+			rows = append(rows, 0, float32(c), classScores[c], b[i*4], b[i*4+1], b[i*4+2], b[i*4+3])
+		}
+	}
+	if len(rows) == 0 {
+		return gocv.NewMat(), nil
+	}
+	prob := gocv.NewMatWithSize(1, len(rows), gocv.MatTypeCV32F)
+	for i, v := range rows {
+		prob.SetFloatAt(0, i, v)
+	}
+	return prob, nil
+}
+
+func closeMats(mats []gocv.Mat) {
+	for _, m := range mats {
+		m.Close()
+	}
+}
+
+// fraction of the tile size by which tiles extend over their neighbours,
+// so that objects lying on a tile border are fully contained in a tile
+const tileOverlap = 0.2
+
+// splitTiles splits the bounds in a grid of overlapping tiles. If the grid
+// has a single cell, the bounds themselves are returned.
+func splitTiles(bounds image.Rectangle, rows, cols int) []image.Rectangle {
+	if rows < 1 {
+		rows = 1
+	}
+	if cols < 1 {
+		cols = 1
+	}
+	w, h := bounds.Dx()/cols, bounds.Dy()/rows
+	padX, padY := int(float64(w)*tileOverlap), int(float64(h)*tileOverlap)
+
+	var tiles []image.Rectangle
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			tile := image.Rect(
+				bounds.Min.X+c*w-padX, bounds.Min.Y+r*h-padY,
+				bounds.Min.X+(c+1)*w+padX, bounds.Min.Y+(r+1)*h+padY,
+			)
+			// the last row and column absorb the rounding leftovers
+			if c == cols-1 {
+				tile.Max.X = bounds.Max.X
+			}
+			if r == rows-1 {
+				tile.Max.Y = bounds.Max.Y
+			}
+			tiles = append(tiles, tile.Intersect(bounds))
+		}
+	}
+	return tiles
+}
+
+func (d *netDetector) Close() error {
+	if d.enhancer != nil {
+		d.enhancer.Close()
+		d.enhanced.Close()
+	}
+	// the model is shared, and released by ReleaseNets
+	return nil
+}
@@ -0,0 +1,223 @@
+package homesecurity
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+func TestNormalizationPresets(t *testing.T) {
+	noSwap := false
+	tests := []struct {
+		name string
+		cfg  DetectionConfig
+		want normalization
+	}{
+		{"default", DetectionConfig{}, normalization{scale: 1.0 / 127.5, mean: [3]float64{127.5, 127.5, 127.5}, swapRB: true}},
+		{"mobilenet", DetectionConfig{Normalization: "mobilenet"}, normalization{scale: 1.0 / 127.5, mean: [3]float64{127.5, 127.5, 127.5}, swapRB: true}},
+		{"0-1", DetectionConfig{Normalization: "0-1"}, normalization{scale: 1.0 / 255.0, swapRB: true}},
+		{"imagenet", DetectionConfig{Normalization: "imagenet"}, normalization{scale: 1.0 / 255.0, mean: [3]float64{103.53, 116.28, 123.675}}},
+		{"custom", DetectionConfig{Normalization: "custom", InputScale: 0.5, InputMean: []float64{1, 2, 3}},
+			normalization{scale: 0.5, mean: [3]float64{1, 2, 3}, swapRB: true}},
+		{"overrides", DetectionConfig{Normalization: "0-1", InputScale: 2, SwapRB: &noSwap, CropInput: true},
+			normalization{scale: 2, crop: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.normalization(); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInputBlobFlags(t *testing.T) {
+	// a wide frame, white on its left quarter, and red elsewhere
+	frame := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 255, 0), 300, 600, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+	gocv.Rectangle(&frame, image.Rect(0, 0, 140, 300), color.RGBA{R: 255, G: 255, B: 255, A: 255}, -1)
+
+	tests := []struct {
+		name string
+		norm normalization
+		// first value of the first channel of the blob
+		want float32
+	}{
+		{"no swap", normalization{scale: 1}, 255},
+		{"scale and mean", normalization{scale: 0.5, mean: [3]float64{55, 0, 0}}, 100},
+		// the red channel goes first, the top left corner is still white
+		{"swap", normalization{scale: 1, swapRB: true}, 255},
+		// the white part is cropped away, and the blue channel is empty
+		{"crop", normalization{scale: 1, crop: true}, 0},
+		{"swap and crop", normalization{scale: 1, swapRB: true, crop: true}, 255},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blob := tt.norm.inputBlob(frame)
+			defer blob.Close()
+			values, err := blob.DataPtrFloat32()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(values) != 3*300*300 {
+				t.Fatalf("got %d values, want a 3x300x300 blob", len(values))
+			}
+			if values[0] != tt.want {
+				t.Errorf("got %v, want %v", values[0], tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitTiles(t *testing.T) {
+	bounds := image.Rect(0, 0, 800, 600)
+	tests := []struct {
+		rows, cols int
+		want       []image.Rectangle
+	}{
+		{0, 0, []image.Rectangle{bounds}},
+		{1, 2, []image.Rectangle{image.Rect(0, 0, 480, 600), image.Rect(320, 0, 800, 600)}},
+		{2, 2, []image.Rectangle{
+			image.Rect(0, 0, 480, 360), image.Rect(320, 0, 800, 360),
+			image.Rect(0, 240, 480, 600), image.Rect(320, 240, 800, 600),
+		}},
+	}
+	for _, tt := range tests {
+		got := splitTiles(bounds, tt.rows, tt.cols)
+		if len(got) != len(tt.want) {
+			t.Fatalf("%dx%d: got %v, want %v", tt.rows, tt.cols, got, tt.want)
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%dx%d: got tile %d %v, want %v", tt.rows, tt.cols, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestPerformBlobTile(t *testing.T) {
+	frame := gocv.NewMatWithSize(600, 800, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+	// a small object in the middle of the bottom-right tile
+	results := testResults([detectionStride]float32{0, personClassID, 0.9, 0.5, 0.5, 0.6, 0.6})
+	defer results.Close()
+
+	tiles := splitTiles(image.Rect(0, 0, 800, 600), 2, 2)
+	blobs, err := PerformBlob(&frame, tiles[3], results, &DetectionConfig{MinConfidence: 0.5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := BlobPosition{Left: 560, Top: 420, Right: 608, Bottom: 456}
+	if len(blobs) != 1 || blobs[0].Position != want {
+		t.Errorf("got %+v, want a blob at %+v", blobs, want)
+	}
+}
+
+func TestBoxesScoresTopClasses(t *testing.T) {
+	boxes := gocv.NewMatWithSize(1, 4, gocv.MatTypeCV32F)
+	defer boxes.Close()
+	for i, v := range []float32{0.1, 0.1, 0.4, 0.8} {
+		boxes.SetFloatAt(0, i, v)
+	}
+	// person, then dog and cat, which are both animals
+	scores := gocv.NewMatWithSize(1, 19, gocv.MatTypeCV32F)
+	defer scores.Close()
+	scores.SetFloatAt(0, personClassID, 0.6)
+	scores.SetFloatAt(0, 18, 0.3)
+	scores.SetFloatAt(0, 17, 0.1)
+	prob, err := decodeBoxesScores(boxes, scores)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer prob.Close()
+	frame := gocv.NewMatWithSize(300, 400, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+
+	tests := []struct {
+		k    int
+		want []ClassScore
+	}{
+		{0, []ClassScore{{Human, 0.6}}},
+		{2, []ClassScore{{Human, 0.6}, {Animal, 0.3}}},
+		{5, []ClassScore{{Human, 0.6}, {Animal, 0.3}}},
+	}
+	for _, tt := range tests {
+		cfg := &DetectionConfig{MinConfidence: 0.5, TopClasses: tt.k}
+		blobs, err := PerformBlob(&frame, image.Rect(0, 0, 400, 300), prob, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(blobs) != 1 {
+			t.Fatalf("k %d: got %d blobs, want 1", tt.k, len(blobs))
+		}
+		got := blobs[0].Scores
+		if len(got) != len(tt.want) {
+			t.Fatalf("k %d: got scores %v, want %v", tt.k, got, tt.want)
+		}
+		for i := range got {
+			if got[i].Category != tt.want[i].Category || math.Abs(got[i].Confidence-tt.want[i].Confidence) > 1e-6 {
+				t.Errorf("k %d: got scores %v, want %v", tt.k, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestDecodeOutputs(t *testing.T) {
+	// two boxes, with scores for the background, a person and a bicycle
+	boxes := gocv.NewMatWithSize(2, 4, gocv.MatTypeCV32F)
+	defer boxes.Close()
+	scores := gocv.NewMatWithSize(2, 3, gocv.MatTypeCV32F)
+	defer scores.Close()
+	for i, v := range []float32{0.1, 0.1, 0.3, 0.6, 0.5, 0.5, 0.9, 0.9} {
+		boxes.SetFloatAt(i/4, i%4, v)
+	}
+	for i, v := range []float32{0.1, 0.8, 0, 0.2, 0, 0.7} {
+		scores.SetFloatAt(i/3, i%3, v)
+	}
+
+	tests := []struct {
+		name    string
+		cfg     DetectionConfig
+		outputs []gocv.Mat
+		want    [][detectionStride]float32
+		ok      bool
+	}{
+		{"boxes and scores", DetectionConfig{ModelKind: "boxes-scores", OutputLayers: []string{"boxes", "scores"}},
+			[]gocv.Mat{boxes, scores}, [][detectionStride]float32{
+				{0, 1, 0.8, 0.1, 0.1, 0.3, 0.6},
+				{0, 2, 0.7, 0.5, 0.5, 0.9, 0.9},
+			}, true},
+		{"missing scores", DetectionConfig{ModelKind: "boxes-scores", OutputLayers: []string{"boxes"}},
+			[]gocv.Mat{boxes}, nil, false},
+		{"no outputs", DetectionConfig{OutputLayers: []string{"detections"}}, nil, nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prob, err := decodeOutputs(tt.outputs, &tt.cfg)
+			if !tt.ok {
+				if err == nil {
+					prob.Close()
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer prob.Close()
+			if prob.Total() != len(tt.want)*detectionStride {
+				t.Fatalf("got %d values, want %d", prob.Total(), len(tt.want)*detectionStride)
+			}
+			for i, det := range tt.want {
+				for j, v := range det {
+					if got := prob.GetFloatAt(0, i*detectionStride+j); got != v {
+						t.Errorf("detection %d value %d: got %v, want %v", i, j, got, v)
+					}
+				}
+			}
+		})
+	}
+}
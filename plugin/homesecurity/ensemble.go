@@ -0,0 +1,165 @@
+package homesecurity
+
+import "gocv.io/x/gocv"
+
+// EnsembleModel is an additional model run on each frame,
+// sharing all the other settings with the main one
+type EnsembleModel struct {
+	Model     string `json:"model"`
+	NetConfig string `json:"netConfig"`
+}
+
+// Returns a copy of the config for each model of the ensemble,
+// starting with the main one
+func (cfg *DetectionConfig) ensembleConfigs() []*DetectionConfig {
+	configs := []*DetectionConfig{cfg}
+	for _, m := range cfg.EnsembleModels {
+		c := *cfg
+		c.Model = m.Model
+		c.NetConfig = m.NetConfig
+		c.EnsembleModels = nil
+		configs = append(configs, &c)
+	}
+	return configs
+}
+
+// Returns the configs of the detectors voting in the ensemble. With
+// confidence-avg, MinConfidence applies to the average, so each detector
+// keeps its detections down to MinConfidence divided by the number of
+// detectors, letting the ones missed by a single model weigh on it.
+func (cfg *DetectionConfig) voterConfigs() []*DetectionConfig {
+	configs := cfg.ensembleConfigs()
+	if cfg.VotingMode != "confidence-avg" {
+		return configs
+	}
+	for i, c := range configs {
+		lowered := *c
+		lowered.MinConfidence = cfg.MinConfidence / float64(len(configs))
+		configs[i] = &lowered
+	}
+	return configs
+}
+
+// ensembleDetector runs multiple detectors on each frame, and combines
+// their blobs by overlap according to the voting mode:
+//   - and: only the blobs found by all the detectors are kept
+//   - or: the blobs found by any detector are kept
+//   - confidence-avg: the confidence of each blob is averaged over all
+//     the detectors, counting 0 for the ones that missed it
+type ensembleDetector struct {
+	detectors []detector
+	mode      string
+	threshold float64
+	minConf   float64
+}
+
+func newEnsembleDetector(cfg *DetectionConfig) (*ensembleDetector, error) {
+	e := &ensembleDetector{mode: cfg.VotingMode, threshold: cfg.NmsThreshold, minConf: cfg.MinConfidence}
+	if e.threshold == 0 {
+		e.threshold = defaultNmsThreshold
+	}
+	for _, c := range cfg.voterConfigs() {
+		d, err := newNetDetector(c)
+		if err != nil {
+			e.Close()
+			return nil, err
+		}
+		e.detectors = append(e.detectors, d)
+	}
+	return e, nil
+}
+
+func (e *ensembleDetector) Detect(img *gocv.Mat) ([]Blob, error) {
+	results := make([][]Blob, len(e.detectors))
+	for i, d := range e.detectors {
+		blobs, err := d.Detect(img)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = blobs
+	}
+	return voteBlobs(results, e.mode, e.threshold, e.minConf), nil
+}
+
+// voteBlobs combines the blobs found by each detector. Blobs of the same
+// category overlapping more than the threshold are considered the same.
+func voteBlobs(results [][]Blob, mode string, threshold, minConfidence float64) []Blob {
+	if mode == "or" {
+		var all []Blob
+		for _, r := range results {
+			all = append(all, r...)
+		}
+		return suppressOverlaps(all, threshold)
+	}
+
+	// group the blobs of each detector with the matching ones of the others
+	var groups [][]Blob
+	matched := make([]map[int]bool, len(results))
+	for i := range results {
+		matched[i] = make(map[int]bool)
+	}
+	for i, r := range results {
+		for j, blob := range r {
+			if matched[i][j] {
+				continue
+			}
+			group := []Blob{blob}
+			for k := i + 1; k < len(results); k++ {
+				if m := bestMatch(blob, results[k], matched[k], threshold); m >= 0 {
+					matched[k][m] = true
+					group = append(group, results[k][m])
+				}
+			}
+			groups = append(groups, group)
+		}
+	}
+
+	var blobs []Blob
+	for _, group := range groups {
+		blob := group[0]
+		switch mode {
+		case "confidence-avg":
+			sum := 0.0
+			for _, b := range group {
+				sum += b.Confidence
+			}
+			blob.Confidence = sum / float64(len(results))
+			if blob.Confidence <= minConfidence {
+				continue
+			}
+		default: // and
+			if len(group) < len(results) {
+				continue
+			}
+			for _, b := range group[1:] {
+				if b.Confidence < blob.Confidence {
+					blob.Confidence = b.Confidence
+				}
+			}
+		}
+		blobs = append(blobs, blob)
+	}
+	return blobs
+}
+
+// Returns the index of the unmatched blob of the same category overlapping
+// the most with the given one, or -1 if none overlaps more than threshold
+func bestMatch(blob Blob, candidates []Blob, matched map[int]bool, threshold float64) int {
+	best, bestIoU := -1, threshold
+	for i, c := range candidates {
+		if matched[i] || c.Category != blob.Category {
+			continue
+		}
+		if iou := blob.Position.IoU(c.Position); iou > bestIoU {
+			best, bestIoU = i, iou
+		}
+	}
+	return best
+}
+
+func (e *ensembleDetector) Close() error {
+	for _, d := range e.detectors {
+		d.Close()
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package homesecurity
+
+import (
+	"math"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// fixedDetector finds the same blobs in every frame
+type fixedDetector []Blob
+
+func (d fixedDetector) Detect(img *gocv.Mat) ([]Blob, error) {
+	return append([]Blob(nil), d...), nil
+}
+
+func (d fixedDetector) Close() error {
+	return nil
+}
+
+func TestEnsembleVoting(t *testing.T) {
+	// both models see the human, only one of them the animal
+	first := fixedDetector{testBlob(Human, 0, 0, 0.9), testBlob(Animal, 400, 0, 0.8)}
+	second := fixedDetector{testBlob(Human, 5, 5, 0.4)}
+	tests := []struct {
+		mode string
+		want []ClassScore
+	}{
+		{"and", []ClassScore{{Human, 0.4}}},
+		{"or", []ClassScore{{Human, 0.9}, {Animal, 0.8}}},
+		// the animal averages to 0.4, below minConfidence
+		{"confidence-avg", []ClassScore{{Human, 0.65}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			e := &ensembleDetector{detectors: []detector{first, second}, mode: tt.mode, threshold: defaultNmsThreshold, minConf: 0.5}
+			blobs, err := e.Detect(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(blobs) != len(tt.want) {
+				t.Fatalf("got %d blobs, want %d", len(blobs), len(tt.want))
+			}
+			for i, want := range tt.want {
+				if blobs[i].Category != want.Category || math.Abs(blobs[i].Confidence-want.Confidence) > 1e-9 {
+					t.Errorf("blob %d: got %s %v, want %s %v", i, blobs[i].Category, blobs[i].Confidence, want.Category, want.Confidence)
+				}
+			}
+		})
+	}
+}
+
+func TestVoterConfigs(t *testing.T) {
+	tests := []struct {
+		mode string
+		want float64
+	}{
+		{"and", 0.6},
+		{"or", 0.6},
+		{"confidence-avg", 0.3},
+	}
+	for _, tt := range tests {
+		cfg := &DetectionConfig{Model: "a.pb", MinConfidence: 0.6, VotingMode: tt.mode, EnsembleModels: []EnsembleModel{{Model: "b.pb"}}}
+		configs := cfg.voterConfigs()
+		if len(configs) != 2 || configs[0].Model != "a.pb" || configs[1].Model != "b.pb" {
+			t.Fatalf("%s: got configs %v", tt.mode, configs)
+		}
+		for _, c := range configs {
+			if c.MinConfidence != tt.want {
+				t.Errorf("%s: got voter minConfidence %v, want %v", tt.mode, c.MinConfidence, tt.want)
+			}
+		}
+		if cfg.MinConfidence != 0.6 {
+			t.Errorf("%s: main config changed to %v", tt.mode, cfg.MinConfidence)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package homesecurity
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+)
+
+// eventLog appends events as JSON lines to a file, rotating it
+// when it grows above a given size.
+type eventLog struct {
+	path     string
+	maxBytes int64
+	format   lineFormat
+	file     *os.File
+	writer   *bufio.Writer
+	size     int64
+}
+
+func openEventLog(path string, maxBytes int64, format lineFormat) (*eventLog, error) {
+	l := &eventLog{
+		path:     path,
+		maxBytes: maxBytes,
+		format:   format,
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *eventLog) open() error {
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	l.file = file
+	l.writer = bufio.NewWriter(file)
+	l.size = info.Size()
+	return nil
+}
+
+// Moves the current file to <path>.1, overriding any previous one,
+// and starts a new empty file.
+func (l *eventLog) rotate() error {
+	if err := l.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+// lineFormat describes how events are encoded in the JSON outputs
+type lineFormat struct {
+	// whether to keep the ASCII image
+	ascii bool
+
+	// whether to compress each line
+	compress bool
+
+	// whether to describe boxes by their center and size
+	centerBoxes bool
+}
+
+// encodeEventLine serializes the event as a single compact JSON line,
+// in the given format
+func encodeEventLine(evt *VideoEvent, format lineFormat) ([]byte, error) {
+	e := *evt
+	if !format.ascii {
+		e.AsciiImage = ""
+	}
+	var v interface{} = &e
+	if format.centerBoxes {
+		v = toCenterEvent(&e)
+	}
+	line, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	line = append(line, '\n')
+	if format.compress {
+		return compressLine(line)
+	}
+	return line, nil
+}
+
+// Write appends the event as a single compact JSON line
+func (l *eventLog) Write(evt *VideoEvent) error {
+	line, err := encodeEventLine(evt, l.format)
+	if err != nil {
+		return err
+	}
+
+	if l.maxBytes > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxBytes {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.writer.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+	// events are rare, so flush them right away for
+	// the benefit of tailing consumers
+	return l.writer.Flush()
+}
+
+// Close flushes any buffered line and closes the file
+func (l *eventLog) Close() error {
+	if err := l.writer.Flush(); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
@@ -0,0 +1,107 @@
+package homesecurity
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// loggedEvent holds the fields of a JSON line checked by the tests
+type loggedEvent struct {
+	CorrelationID string
+	AsciiImage    string
+	Blobs         []json.RawMessage
+}
+
+// readEventLines decodes each JSON line of the file
+func readEventLines(t *testing.T, path string) []loggedEvent {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	var events []loggedEvent
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var evt loggedEvent
+		if err := json.Unmarshal(scanner.Bytes(), &evt); err != nil {
+			t.Fatalf("invalid JSON line %q: %s", scanner.Text(), err.Error())
+		}
+		events = append(events, evt)
+	}
+	return events
+}
+
+func TestEventLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.json")
+	l, err := openEventLog(path, 0, lineFormat{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b", "c"} {
+		evt := VideoEvent{CorrelationID: id, AsciiImage: "###", Blobs: []Blob{testBlob(Human, 0, 0, 0.9)}}
+		if err := l.Write(&evt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	events := readEventLines(t, path)
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+	for i, id := range []string{"a", "b", "c"} {
+		if events[i].CorrelationID != id || len(events[i].Blobs) != 1 {
+			t.Errorf("line %d: got %+v", i, events[i])
+		}
+		if events[i].AsciiImage != "" {
+			t.Errorf("line %d: the ascii image is not excluded", i)
+		}
+	}
+}
+
+func TestEventLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.json")
+	line, err := encodeEventLine(&VideoEvent{CorrelationID: "a"}, lineFormat{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// room for two lines per file
+	l, err := openEventLog(path, int64(2*len(line)), lineFormat{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		if err := l.Write(&VideoEvent{CorrelationID: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		ids  []string
+	}{
+		{path + ".1", []string{"c", "d"}},
+		{path, []string{"e"}},
+	}
+	for _, tt := range tests {
+		events := readEventLines(t, tt.path)
+		if len(events) != len(tt.ids) {
+			t.Errorf("%s: got %d events, want %d", tt.path, len(events), len(tt.ids))
+			continue
+		}
+		for i, id := range tt.ids {
+			if events[i].CorrelationID != id {
+				t.Errorf("%s: line %d is %q, want %q", tt.path, i, events[i].CorrelationID, id)
+			}
+		}
+	}
+}
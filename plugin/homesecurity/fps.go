@@ -0,0 +1,60 @@
+package homesecurity
+
+import (
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// weight of the last sample in the moving average of the inference time
+const fpsSmoothing = 0.1
+
+// number of frames after which the achieved inference rate is logged
+const fpsLogFrames = 30
+
+// fpsMeter measures the rate inference can sustain, as the exponential
+// moving average of the inference time of each frame
+type fpsMeter struct {
+	avg     time.Duration
+	samples int
+}
+
+// Add registers the inference time of a frame
+func (f *fpsMeter) Add(d time.Duration) {
+	f.samples++
+	if f.samples == 1 {
+		f.avg = d
+		return
+	}
+	f.avg = time.Duration(fpsSmoothing*float64(d) + (1-fpsSmoothing)*float64(f.avg))
+}
+
+// FPS returns the achieved inference rate, 0 if unknown
+func (f *fpsMeter) FPS() float64 {
+	if f.avg <= 0 {
+		return 0
+	}
+	return float64(time.Second) / float64(f.avg)
+}
+
+// dropRatio returns the fraction of the frames sent by the camera that
+// inference can't keep up with, 0 if any of the rates is unknown
+func dropRatio(cameraFPS, inferenceFPS float64) float64 {
+	if cameraFPS <= 0 || inferenceFPS <= 0 || inferenceFPS >= cameraFPS {
+		return 0
+	}
+	return 1 - inferenceFPS/cameraFPS
+}
+
+// nominalFPS returns the frame rate declared by the source, 0 if unknown
+func nominalFPS(src frameSource) float64 {
+	switch s := src.(type) {
+	case *gocv.VideoCapture:
+		return s.Get(gocv.VideoCaptureFPS)
+	case *endOffsetSource:
+		return s.Get(gocv.VideoCaptureFPS)
+	case *testPattern:
+		return testPatternFPS
+	}
+	return 0
+}
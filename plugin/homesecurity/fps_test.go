@@ -0,0 +1,42 @@
+package homesecurity
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDropRatio(t *testing.T) {
+	tests := []struct {
+		name              string
+		camera, inference float64
+		want              float64
+	}{
+		{"keeping up", 30, 30, 0},
+		{"faster than the camera", 30, 50, 0},
+		{"dropping", 30, 12, 0.6},
+		{"unknown camera rate", 0, 12, 0},
+		{"no inference yet", 30, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := dropRatio(tt.camera, tt.inference); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFpsMeter(t *testing.T) {
+	var f fpsMeter
+	if fps := f.FPS(); fps != 0 {
+		t.Errorf("got %v fps without samples", fps)
+	}
+	for i := 0; i < 50; i++ {
+		f.Add(time.Second / 12)
+	}
+	if fps := f.FPS(); math.Abs(fps-12) > 0.01 {
+		t.Errorf("got %v fps, want 12", fps)
+	}
+	if got := dropRatio(30, f.FPS()); math.Abs(got-0.6) > 0.001 {
+		t.Errorf("got drop ratio %v, want 0.6", got)
+	}
+}
@@ -0,0 +1,60 @@
+package homesecurity
+
+import (
+	"fmt"
+
+	"gocv.io/x/gocv"
+)
+
+// number of consecutive frames of the same dimensions after
+// which the dimensions are considered stable
+const stableFrameDims = 3
+
+// dimsGate holds frames back once the video source sent a 0x0 frame, or
+// changed the dimensions of its frames, until it sends frames of stable,
+// positive dimensions again, as some cameras report 0x0 or stale dimensions
+// on the first reads, which would turn every box into a 0x0 one. Sources
+// sending valid frames from the start are never held back.
+type dimsGate struct {
+	cols, rows int
+
+	// consecutive frames of the current dimensions
+	same int
+
+	// set once a 0x0 frame or a change of dimensions has been seen,
+	// until the dimensions are stable again
+	settling bool
+
+	// frames held back while settling
+	skipped int
+}
+
+// Ready returns true if the frame can be processed
+func (g *dimsGate) Ready(img *gocv.Mat) bool {
+	cols, rows := img.Cols(), img.Rows()
+	if cols <= 0 || rows <= 0 {
+		g.cols, g.rows, g.same, g.settling = 0, 0, 0, true
+		g.skipped++
+		return false
+	}
+	if cols != g.cols || rows != g.rows {
+		// the first dimensions are trusted
+		if g.cols > 0 {
+			g.settling = true
+		}
+		g.cols, g.rows, g.same = cols, rows, 0
+	}
+	if g.same < stableFrameDims {
+		g.same++
+	}
+	if !g.settling {
+		return true
+	}
+	if g.same < stableFrameDims {
+		g.skipped++
+		return false
+	}
+	fmt.Printf("skipped %d frames until stable %dx%d dimensions\n", g.skipped, cols, rows)
+	g.settling, g.skipped = false, 0
+	return true
+}
@@ -0,0 +1,119 @@
+package homesecurity
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// newFrame returns a frame of the given dimensions, 0x0 ones being empty
+func newFrame(cols, rows int) gocv.Mat {
+	if cols == 0 {
+		return gocv.NewMat()
+	}
+	return gocv.NewMatWithSize(rows, cols, gocv.MatTypeCV8UC3)
+}
+
+func TestDimsGate(t *testing.T) {
+	steps := []struct {
+		cols, rows int
+		ready      bool
+	}{
+		// the first valid frames are trusted
+		{40, 30, true},
+		{40, 30, true},
+		// after a 0x0 frame, the dimensions must be stable again
+		{0, 0, false},
+		{40, 30, false},
+		{40, 30, false},
+		{40, 30, true},
+		{40, 30, true},
+		// and so after a change of dimensions
+		{80, 60, false},
+		{80, 60, false},
+		{80, 60, true},
+	}
+	var g dimsGate
+	for i, s := range steps {
+		frame := newFrame(s.cols, s.rows)
+		if ready := g.Ready(&frame); ready != s.ready {
+			t.Errorf("frame %d, %dx%d: got ready %v, want %v", i, s.cols, s.rows, ready, s.ready)
+		}
+		frame.Close()
+	}
+	if g.skipped != 0 {
+		t.Errorf("got %d skipped frames after a stable one, want 0", g.skipped)
+	}
+}
+
+// resizingSource sends a frame for each of the given dimensions, then ends
+type resizingSource struct {
+	*testPattern
+	dims [][2]int
+}
+
+func (s *resizingSource) Read(img *gocv.Mat) bool {
+	if len(s.dims) == 0 {
+		return false
+	}
+	frame := newFrame(s.dims[0][0], s.dims[0][1])
+	defer frame.Close()
+	s.dims = s.dims[1:]
+	frame.CopyTo(img)
+	return true
+}
+
+func TestDimsGatePipeline(t *testing.T) {
+	tests := []struct {
+		name   string
+		dims   [][2]int
+		events int
+	}{
+		{"stable", [][2]int{{640, 480}, {640, 480}, {640, 480}}, 3},
+		{"0x0 first", [][2]int{{0, 0}, {640, 480}, {640, 480}, {640, 480}, {640, 480}}, 2},
+		{"resized", [][2]int{{640, 480}, {640, 480}, {800, 600}, {800, 600}, {800, 600}, {800, 600}}, 4},
+	}
+	defer func(open func(cfg *OpenConfig) (frameSource, error)) {
+		openSource = open
+	}(openSource)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openSource = func(cfg *OpenConfig) (frameSource, error) {
+				pattern, err := newTestPattern(testPatternSource)
+				if err != nil {
+					return nil, err
+				}
+				return &resizingSource{testPattern: pattern, dims: tt.dims}, nil
+			}
+			var wg sync.WaitGroup
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			detectionc, _, errorc := LaunchVideoDetection(ctx, testTrackConfig(), &OpenConfig{EmitEveryFrame: true}, nil, &wg)
+			defer func() {
+				cancel()
+				wg.Wait()
+			}()
+
+			events := 0
+			for {
+				select {
+				case <-ctx.Done():
+					t.Fatal("the source did not end")
+				case <-detectionc:
+					events++
+					continue
+				case err := <-errorc:
+					if err != ErrDeviceClosed {
+						t.Fatalf("got error %v, want ErrDeviceClosed", err)
+					}
+				}
+				break
+			}
+			if events != tt.events {
+				t.Errorf("got %d events, want %d", events, tt.events)
+			}
+		})
+	}
+}
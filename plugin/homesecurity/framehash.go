@@ -0,0 +1,36 @@
+package homesecurity
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+
+	"gocv.io/x/gocv"
+)
+
+// frameHash returns a hash of the pixels and the layout of the frame,
+// so that identical frames hash the same
+func frameHash(img *gocv.Mat) uint64 {
+	h := fnv.New64a()
+	var layout [12]byte
+	binary.LittleEndian.PutUint32(layout[0:], uint32(img.Rows()))
+	binary.LittleEndian.PutUint32(layout[4:], uint32(img.Cols()))
+	binary.LittleEndian.PutUint32(layout[8:], uint32(img.Type()))
+	h.Write(layout[:])
+	h.Write(img.ToBytes())
+	return h.Sum64()
+}
+
+// duplicateFilter tells frames identical to the previous one, as some
+// cameras and looped files deliver the same frame more than once
+type duplicateFilter struct {
+	last    uint64
+	hasLast bool
+}
+
+// Duplicate returns true if the frame is identical to the previous one
+func (f *duplicateFilter) Duplicate(img *gocv.Mat) bool {
+	hash := frameHash(img)
+	dup := f.hasLast && hash == f.last
+	f.last, f.hasLast = hash, true
+	return dup
+}
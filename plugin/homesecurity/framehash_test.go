@@ -0,0 +1,49 @@
+package homesecurity
+
+import (
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+func TestDuplicateFilter(t *testing.T) {
+	pattern, err := newTestPattern(testPatternSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pattern.Close()
+	img := gocv.NewMat()
+	defer img.Close()
+
+	var dups duplicateFilter
+	tests := []struct {
+		// whether a new frame is read, rather than the previous one repeated
+		read bool
+		want bool
+	}{
+		{true, false},
+		{false, true},
+		{false, true},
+		{true, false},
+		{false, true},
+	}
+	for i, tt := range tests {
+		if tt.read {
+			pattern.Read(&img)
+		}
+		if got := dups.Duplicate(&img); got != tt.want {
+			t.Errorf("frame %d: got duplicate %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestFrameHashLayout(t *testing.T) {
+	// the same pixels, laid out differently
+	a := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), 2, 8, gocv.MatTypeCV8UC3)
+	defer a.Close()
+	b := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(0, 0, 0, 0), 4, 4, gocv.MatTypeCV8UC3)
+	defer b.Close()
+	if frameHash(&a) == frameHash(&b) {
+		t.Error("frames of different sizes hash the same")
+	}
+}
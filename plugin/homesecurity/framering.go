@@ -0,0 +1,75 @@
+package homesecurity
+
+import (
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// upper bound to the number of frames kept in memory by a frameRing
+const maxRingFrames = 300
+
+type timedFrame struct {
+	at    time.Time
+	frame gocv.Mat
+}
+
+// frameRing keeps a copy of the frames read in the recent past,
+// keyed by the time they were read at.
+type frameRing struct {
+	frames []timedFrame
+	window time.Duration
+}
+
+func newFrameRing(window time.Duration) *frameRing {
+	return &frameRing{window: window}
+}
+
+// Push stores a copy of the frame, dropping the frames that
+// are too old to be ever requested again
+func (r *frameRing) Push(img *gocv.Mat, at time.Time) {
+	r.frames = append(r.frames, timedFrame{at: at, frame: img.Clone()})
+
+	// always keep one frame older than the window, so that
+	// At can find the closest one to the window start
+	drop := 0
+	for drop < len(r.frames)-1 && at.Sub(r.frames[drop+1].at) >= r.window {
+		drop++
+	}
+	if n := len(r.frames) - drop; n > maxRingFrames {
+		drop += n - maxRingFrames
+	}
+	for i := 0; i < drop; i++ {
+		r.frames[i].frame.Close()
+	}
+	r.frames = append(r.frames[:0], r.frames[drop:]...)
+}
+
+// At returns the stored frame closest to the given time, or nil
+// if no frame has been stored yet
+func (r *frameRing) At(t time.Time) *gocv.Mat {
+	var best *timedFrame
+	for i := range r.frames {
+		if best == nil || absDuration(r.frames[i].at.Sub(t)) < absDuration(best.at.Sub(t)) {
+			best = &r.frames[i]
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return &best.frame
+}
+
+func (r *frameRing) Close() {
+	for _, f := range r.frames {
+		f.frame.Close()
+	}
+	r.frames = nil
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,76 @@
+package homesecurity
+
+import (
+	"testing"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+func TestFrameRingPreRoll(t *testing.T) {
+	ring := newFrameRing(500 * time.Millisecond)
+	defer ring.Close()
+	start := time.Unix(1000, 0)
+	// each frame is filled with its index, to tell them apart
+	for i := 0; i <= 10; i++ {
+		frame := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(float64(i), 0, 0, 0), 4, 4, gocv.MatTypeCV8UC3)
+		ring.Push(&frame, start.Add(time.Duration(i)*100*time.Millisecond))
+		frame.Close()
+	}
+	now := start.Add(time.Second)
+
+	tests := []struct {
+		preRoll time.Duration
+		want    uint8
+	}{
+		{0, 10},
+		{300 * time.Millisecond, 7},
+		{320 * time.Millisecond, 7},
+		{500 * time.Millisecond, 5},
+		// older frames than the window are dropped
+		{time.Second, 5},
+	}
+	for _, tt := range tests {
+		frame := ring.At(now.Add(-tt.preRoll))
+		if frame == nil {
+			t.Fatalf("pre-roll %s: no frame", tt.preRoll)
+		}
+		if got := frame.GetVecbAt(0, 0)[0]; got != tt.want {
+			t.Errorf("pre-roll %s: got frame %d, want %d", tt.preRoll, got, tt.want)
+		}
+	}
+}
+
+func TestSnapshotBurst(t *testing.T) {
+	ring := newFrameRing(time.Second)
+	defer ring.Close()
+	start := time.Unix(1000, 0)
+	for i := 0; i <= 10; i++ {
+		frame := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(float64(i), 0, 0, 0), 4, 4, gocv.MatTypeCV8UC3)
+		ring.Push(&frame, start.Add(time.Duration(i)*100*time.Millisecond))
+		frame.Close()
+	}
+	now := start.Add(time.Second)
+
+	tests := []struct {
+		name    string
+		preRoll time.Duration
+		count   int
+		want    []uint8
+	}{
+		{"single", 0, 1, []uint8{10}},
+		{"burst", 0, 3, []uint8{6, 8, 10}},
+		{"burst with pre-roll", 300 * time.Millisecond, 3, []uint8{3, 5, 7}},
+	}
+	for _, tt := range tests {
+		times := burstTimes(now, tt.preRoll, 200*time.Millisecond, tt.count)
+		if len(times) != len(tt.want) {
+			t.Fatalf("%s: got %d frames, want %d", tt.name, len(times), len(tt.want))
+		}
+		for i, at := range times {
+			if got := ring.At(at).GetVecbAt(0, 0)[0]; got != tt.want[i] {
+				t.Errorf("%s: got frame %d at %d, want %d", tt.name, got, i, tt.want[i])
+			}
+		}
+	}
+}
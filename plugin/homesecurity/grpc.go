@@ -0,0 +1,97 @@
+package homesecurity
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/FedeDP/falco-home-security/plugin/detectionpb"
+	"google.golang.org/grpc"
+)
+
+// grpcStream streams events as DetectionSet messages to all the clients
+// of the DetectionStream service.
+type grpcStream struct {
+	detectionpb.UnimplementedDetectionStreamServer
+
+	server   *grpc.Server
+	listener net.Listener
+	mu       sync.Mutex
+	clients  map[chan *detectionpb.DetectionSet]bool
+}
+
+func listenGRPC(address string) (*grpcStream, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	s := &grpcStream{
+		server:   grpc.NewServer(),
+		listener: listener,
+		clients:  make(map[chan *detectionpb.DetectionSet]bool),
+	}
+	detectionpb.RegisterDetectionStreamServer(s.server, s)
+	go s.server.Serve(listener)
+	return s, nil
+}
+
+// Stream implements the DetectionStream service
+func (s *grpcStream) Stream(_ *detectionpb.StreamRequest, stream detectionpb.DetectionStream_StreamServer) error {
+	queue := make(chan *detectionpb.DetectionSet, socketClientQueue)
+	s.mu.Lock()
+	s.clients[queue] = true
+	s.mu.Unlock()
+	defer s.remove(queue)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case msg, ok := <-queue:
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(msg); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *grpcStream) remove(queue chan *detectionpb.DetectionSet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clients[queue] {
+		delete(s.clients, queue)
+		close(queue)
+	}
+}
+
+// Write sends the event to all the connected clients. Events are
+// dropped for clients that are not keeping up. The message is shared
+// by all the clients, and never modified once queued.
+func (s *grpcStream) Write(evt *VideoEvent) error {
+	msg := toDetectionSet(*evt)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for queue := range s.clients {
+		select {
+		case queue <- msg:
+		default:
+			fmt.Printf("dropping event for slow gRPC client\n")
+		}
+	}
+	return nil
+}
+
+// Close ends the streams of all the clients and stops the server
+func (s *grpcStream) Close() error {
+	s.mu.Lock()
+	for queue := range s.clients {
+		delete(s.clients, queue)
+		close(queue)
+	}
+	s.mu.Unlock()
+	s.server.Stop()
+	return nil
+}
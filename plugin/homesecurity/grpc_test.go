@@ -0,0 +1,59 @@
+package homesecurity
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/FedeDP/falco-home-security/plugin/detectionpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestGRPCStream(t *testing.T) {
+	s, err := listenGRPC("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, s.listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	stream, err := detectionpb.NewDetectionStreamClient(conn).Stream(ctx, &detectionpb.StreamRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the client is subscribed once the server has received its request
+	for {
+		s.mu.Lock()
+		n := len(s.clients)
+		s.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			t.Fatal("client never subscribed")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	sent := VideoEvent{VideoSource: "/dev/video0", Blobs: []Blob{{ID: 3, Category: Human, Confidence: 0.9}}}
+	if err := s.Write(&sent); err != nil {
+		t.Fatal(err)
+	}
+	set, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fromDetectionSet(set)
+	if got.VideoSource != sent.VideoSource || len(got.Blobs) != 1 || got.Blobs[0].ID != 3 {
+		t.Errorf("got %+v, want %+v", got, sent)
+	}
+}
@@ -0,0 +1,31 @@
+package homesecurity_test
+
+import (
+	"testing"
+
+	"github.com/FedeDP/falco-home-security/plugin/homesecurity"
+)
+
+func TestBlobListUpdate(t *testing.T) {
+	cfg := &homesecurity.DetectionConfig{
+		MemoryDecayFactor:       0.9,
+		MemoryMinConfidence:     0.3,
+		MemoryNearnessThreshold: 0.8,
+	}
+	person := homesecurity.Blob{
+		Category:   homesecurity.Human,
+		Confidence: 0.9,
+		Position:   homesecurity.BlobPosition{Left: 100, Top: 100, Right: 200, Bottom: 300},
+	}
+	var list homesecurity.BlobList
+	if !list.Update([]homesecurity.Blob{person}, cfg) {
+		t.Error("new entity not reported as a change")
+	}
+	if list.Update([]homesecurity.Blob{person}, cfg) {
+		t.Error("same entity reported as a change")
+	}
+	blobs := list.Blobs()
+	if len(blobs) != 1 || blobs[0].Category != homesecurity.Human || blobs[0].ID == 0 {
+		t.Errorf("got %+v, want a single tracked human", blobs)
+	}
+}
@@ -0,0 +1,186 @@
+package homesecurity
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// delay before the first retry of loading a model, doubled at each attempt
+const modelLoadBackoff = 500 * time.Millisecond
+
+// sharedNet is a loaded DNN model, safe to be used by multiple detectors
+type sharedNet struct {
+	mu  sync.Mutex
+	net gocv.Net
+}
+
+// Forward runs a forward pass of the given input blob,
+// the caller is responsible to close the returned Mat
+func (n *sharedNet) Forward(blob gocv.Mat) gocv.Mat {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.net.SetInput(blob, "")
+	return n.net.Forward("")
+}
+
+// ForwardLayers runs a forward pass of the given input blob, returning
+// the outputs of the given layers; the caller is responsible to close them
+func (n *sharedNet) ForwardLayers(blob gocv.Mat, names []string) []gocv.Mat {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.net.SetInput(blob, "")
+	return n.net.ForwardLayers(names)
+}
+
+var (
+	netCacheMu sync.Mutex
+	netCache   = make(map[string]*sharedNet)
+)
+
+func netCacheKey(cfg *DetectionConfig) string {
+	return fmt.Sprintf("%s|%s|%s|%s", cfg.Model, cfg.NetConfig, cfg.Backend, cfg.Target)
+}
+
+// loadNet loads the model described by the config, replaced by tests
+var loadNet = readNet
+
+// acquireNet returns the model described by the config, loading it
+// if it has not been loaded yet. The model files may appear only after
+// a while, for example on networked filesystems, in which case loading
+// is retried up to ModelLoadRetries times with an exponential backoff.
+// The cache is not locked meanwhile, so that other models can be used.
+func acquireNet(cfg *DetectionConfig) (*sharedNet, error) {
+	key := netCacheKey(cfg)
+	netCacheMu.Lock()
+	n, ok := netCache[key]
+	netCacheMu.Unlock()
+	if ok {
+		return n, nil
+	}
+
+	backoff := modelLoadBackoff
+	for attempt := 0; ; attempt++ {
+		net, err := loadNet(cfg)
+		if err == nil {
+			return cacheNet(key, net), nil
+		}
+		if attempt >= cfg.ModelLoadRetries {
+			return nil, fmt.Errorf("%s (after %d attempts)", err.Error(), attempt+1)
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// cacheNet adds a loaded model to the cache, unless the same model has
+// been loaded in the meantime, in which case the cached one is returned
+func cacheNet(key string, net gocv.Net) *sharedNet {
+	netCacheMu.Lock()
+	defer netCacheMu.Unlock()
+	if n, ok := netCache[key]; ok {
+		net.Close()
+		return n
+	}
+	n := &sharedNet{net: net}
+	netCache[key] = n
+	return n
+}
+
+func readNet(cfg *DetectionConfig) (gocv.Net, error) {
+	// check files first, as OpenCV does not cope well with missing ones
+	for _, path := range []string{cfg.Model, cfg.NetConfig} {
+		if _, err := os.Stat(path); err != nil {
+			return gocv.Net{}, fmt.Errorf("error reading network model from : %v %v: %s", cfg.Model, cfg.NetConfig, err.Error())
+		}
+	}
+
+	// open DNN object tracking model
+	net := gocv.ReadNet(cfg.Model, cfg.NetConfig)
+	if net.Empty() {
+		net.Close()
+		return gocv.Net{}, fmt.Errorf("error reading network model from : %v %v", cfg.Model, cfg.NetConfig)
+	}
+
+	_ = net.SetPreferableBackend(gocv.ParseNetBackend(cfg.Backend))
+	_ = net.SetPreferableTarget(gocv.ParseNetTarget(cfg.Target))
+	return net, nil
+}
+
+// DryRun loads the model described by the config and runs a forward pass
+// on a synthetic frame, printing the output shape and the resolved
+// backend and target. Useful to check model files before deploying them.
+func DryRun(cfg *DetectionConfig) error {
+	var det detector
+	if len(cfg.InferenceServer) > 0 {
+		det = newRemoteDetector(cfg)
+	} else {
+		nd, err := newNetDetector(cfg)
+		if err != nil {
+			return err
+		}
+		defer ReleaseNets()
+		det = nd
+	}
+	defer det.Close()
+	return dryRun(cfg, det)
+}
+
+// dryRun runs the detector on a synthetic frame, and prints what it found
+func dryRun(cfg *DetectionConfig, det detector) error {
+	pattern, err := newTestPattern(testPatternSource)
+	if err != nil {
+		return err
+	}
+	defer pattern.Close()
+	frame := gocv.NewMat()
+	defer frame.Close()
+	pattern.Read(&frame)
+
+	blobs, err := det.Detect(&frame)
+	if err != nil {
+		return err
+	}
+	if len(cfg.InferenceServer) > 0 {
+		fmt.Printf("inference server: %v\n", cfg.InferenceServer)
+	} else {
+		fmt.Printf("model: %v %v\n", cfg.Model, cfg.NetConfig)
+		fmt.Printf("backend: %v, target: %v\n", gocv.ParseNetBackend(cfg.Backend), gocv.ParseNetTarget(cfg.Target))
+	}
+	if nd, ok := det.(*netDetector); ok {
+		for _, shape := range nd.shapes {
+			fmt.Printf("output shape: %v\n", shape)
+		}
+	}
+	fmt.Printf("entities found in the synthetic frame: %d\n", len(blobs))
+	return nil
+}
+
+// LoadNets loads the models of the config, including the ensemble ones,
+// so that issues are detected before any session is started
+func LoadNets(cfg *DetectionConfig) error {
+	if len(cfg.InferenceServer) > 0 {
+		return nil
+	}
+	for _, c := range cfg.ensembleConfigs() {
+		if _, err := acquireNet(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReleaseNets closes all the cached models
+func ReleaseNets() {
+	netCacheMu.Lock()
+	defer netCacheMu.Unlock()
+	for key, n := range netCache {
+		n.mu.Lock()
+		n.net.Close()
+		n.mu.Unlock()
+		delete(netCache, key)
+	}
+}
@@ -0,0 +1,112 @@
+package homesecurity
+
+import (
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+func TestAcquireNetRetries(t *testing.T) {
+	defer func(load func(*DetectionConfig) (gocv.Net, error)) {
+		loadNet = load
+	}(loadNet)
+	var attempts int32
+	loadNet = func(cfg *DetectionConfig) (gocv.Net, error) {
+		atomic.AddInt32(&attempts, 1)
+		if _, err := os.Stat(cfg.Model); err != nil {
+			return gocv.Net{}, err
+		}
+		// the stub is never used, nor closed
+		return gocv.Net{}, nil
+	}
+	dir := t.TempDir()
+	late := &DetectionConfig{Model: filepath.Join(dir, "late.pb"), ModelLoadRetries: 3}
+	ready := &DetectionConfig{Model: filepath.Join(dir, "ready.pb")}
+	missing := &DetectionConfig{Model: filepath.Join(dir, "missing.pb")}
+	defer func() {
+		netCacheMu.Lock()
+		for _, cfg := range []*DetectionConfig{late, ready} {
+			delete(netCache, netCacheKey(cfg))
+		}
+		netCacheMu.Unlock()
+	}()
+	if err := os.WriteFile(ready.Model, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the model file appears after the first attempt
+	done := make(chan error)
+	go func() {
+		_, err := acquireNet(late)
+		done <- err
+	}()
+	time.Sleep(modelLoadBackoff / 5)
+	if err := os.WriteFile(late.Model, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// other models can be loaded while waiting
+	start := time.Now()
+	if _, err := acquireNet(ready); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= modelLoadBackoff/2 {
+		t.Errorf("loading another model took %s", elapsed)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	// one attempt each for the late model, before and after the file
+	// appeared, plus the one for the ready model
+	if n := atomic.LoadInt32(&attempts); n != 3 {
+		t.Errorf("got %d attempts, want 3", n)
+	}
+
+	if _, err := acquireNet(missing); err == nil {
+		t.Error("missing model loaded")
+	}
+}
+
+// frameDetector records the size of the frames it runs on
+type frameDetector struct {
+	sizes []image.Point
+	err   error
+}
+
+func (d *frameDetector) Detect(img *gocv.Mat) ([]Blob, error) {
+	d.sizes = append(d.sizes, image.Pt(img.Cols(), img.Rows()))
+	return nil, d.err
+}
+
+func (d *frameDetector) Close() error {
+	return nil
+}
+
+func TestDryRun(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"detection", nil},
+		{"failing model", errors.New("broken model")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			det := &frameDetector{err: tt.err}
+			if err := dryRun(&DetectionConfig{}, det); err != tt.err {
+				t.Errorf("got error %v, want %v", err, tt.err)
+			}
+			want := image.Pt(testPatternWidth, testPatternHeight)
+			if len(det.sizes) != 1 || det.sizes[0] != want {
+				t.Errorf("got frames %v, want a single %v one", det.sizes, want)
+			}
+		})
+	}
+}
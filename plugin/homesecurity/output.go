@@ -0,0 +1,68 @@
+package homesecurity
+
+import "fmt"
+
+// EventOutput is an additional destination where events
+// are sent to, beside Falco
+type EventOutput interface {
+	Write(evt *VideoEvent) error
+	Close() error
+}
+
+// OpenEventOutputs opens all the event outputs enabled in the open config
+func OpenEventOutputs(cfg *OpenConfig) ([]EventOutput, error) {
+	var outputs []EventOutput
+	closeAll := func() {
+		for _, o := range outputs {
+			o.Close()
+		}
+	}
+
+	if len(cfg.EventLogPath) > 0 {
+		format := lineFormat{ascii: cfg.EventLogAscii, compress: cfg.CompressEvents, centerBoxes: cfg.BoxFormat == "center"}
+		l, err := openEventLog(cfg.EventLogPath, int64(cfg.EventLogMaxBytes), format)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("error opening event log: %s", err.Error())
+		}
+		outputs = append(outputs, l)
+	}
+
+	if len(cfg.CsvLogPath) > 0 {
+		l, err := openCsvLog(cfg.CsvLogPath)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("error opening CSV log: %s", err.Error())
+		}
+		outputs = append(outputs, l)
+	}
+
+	if len(cfg.SqlitePath) > 0 {
+		l, err := openSqliteLog(cfg.SqlitePath)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("error opening SQLite database: %s", err.Error())
+		}
+		outputs = append(outputs, l)
+	}
+
+	if len(cfg.SocketPath) > 0 {
+		format := lineFormat{ascii: true, compress: cfg.CompressEvents, centerBoxes: cfg.BoxFormat == "center"}
+		s, err := listenEventSocket(cfg.SocketPath, format)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("error listening on event socket: %s", err.Error())
+		}
+		outputs = append(outputs, s)
+	}
+
+	if len(cfg.GRPCAddress) > 0 {
+		s, err := listenGRPC(cfg.GRPCAddress)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("error starting gRPC server: %s", err.Error())
+		}
+		outputs = append(outputs, s)
+	}
+	return outputs, nil
+}
@@ -0,0 +1,99 @@
+package homesecurity
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"sort"
+
+	"gocv.io/x/gocv"
+)
+
+const defaultSnapshotPaletteSize = 256
+
+// bits kept of each channel when counting the colors of a frame, so that
+// nearly identical colors share a palette entry
+const paletteBits = 5
+
+// paletteSize returns the number of colors of paletted snapshots
+func (oCfg *OpenConfig) paletteSize() int {
+	if oCfg.SnapshotPaletteSize == 0 {
+		return defaultSnapshotPaletteSize
+	}
+	return oCfg.SnapshotPaletteSize
+}
+
+// writePalettedPNG writes the snapshot as an 8-bit paletted PNG, quantized
+// to the given number of colors. The palette is made of the most frequent
+// colors of the snapshot, and dithering hides most of the banding, which
+// keeps enough detail to recognize people at a fraction of the size.
+func writePalettedPNG(path string, snapshot *gocv.Mat, size int) error {
+	img, err := snapshot.ToImage()
+	if err != nil {
+		return err
+	}
+	paletted := image.NewPaletted(img.Bounds(), quantizePalette(img, size))
+	draw.FloydSteinberg.Draw(paletted, img.Bounds(), img, image.Point{})
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, paletted); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// quantizePalette returns a palette of at most size colors: the average
+// color of each of the size most frequent color buckets of the image
+func quantizePalette(img image.Image, size int) color.Palette {
+	type bucket struct {
+		r, g, b, n int
+	}
+	const shift = 8 - paletteBits
+	buckets := make(map[int]*bucket)
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			key := int(c.R>>shift)<<(2*paletteBits) | int(c.G>>shift)<<paletteBits | int(c.B>>shift)
+			bk, ok := buckets[key]
+			if !ok {
+				bk = &bucket{}
+				buckets[key] = bk
+			}
+			bk.r += int(c.R)
+			bk.g += int(c.G)
+			bk.b += int(c.B)
+			bk.n++
+		}
+	}
+
+	sorted := make([]*bucket, 0, len(buckets))
+	for _, bk := range buckets {
+		sorted = append(sorted, bk)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].n > sorted[j].n
+	})
+	if len(sorted) > size {
+		sorted = sorted[:size]
+	}
+	palette := make(color.Palette, 0, len(sorted))
+	for _, bk := range sorted {
+		palette = append(palette, color.RGBA{
+			R: uint8(bk.r / bk.n),
+			G: uint8(bk.g / bk.n),
+			B: uint8(bk.b / bk.n),
+			A: 0xff,
+		})
+	}
+	if len(palette) == 0 {
+		palette = append(palette, color.Black)
+	}
+	return palette
+}
@@ -0,0 +1,65 @@
+package homesecurity
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+func TestQuantizePalette(t *testing.T) {
+	red, green, blue, white := color.RGBA{R: 255, A: 255}, color.RGBA{G: 255, A: 255}, color.RGBA{B: 255, A: 255}, color.RGBA{R: 255, G: 255, B: 255, A: 255}
+	img := image.NewRGBA(image.Rect(0, 0, 10, 1))
+	for x, c := range []color.RGBA{red, red, red, red, green, green, green, blue, blue, white} {
+		img.Set(x, 0, c)
+	}
+	tests := []struct {
+		size int
+		want color.Palette
+	}{
+		// the most frequent colors are kept
+		{2, color.Palette{red, green}},
+		{4, color.Palette{red, green, blue, white}},
+		{8, color.Palette{red, green, blue, white}},
+	}
+	for _, tt := range tests {
+		if got := quantizePalette(img, tt.size); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("size %d: got %v, want %v", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestPalettedPNG(t *testing.T) {
+	img := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(100, 50, 25, 0), 60, 80, gocv.MatTypeCV8UC3)
+	defer img.Close()
+	gocv.Rectangle(&img, image.Rect(10, 10, 40, 40), color.RGBA{R: 255, G: 255, B: 255}, -1)
+	gocv.Circle(&img, image.Pt(60, 30), 15, color.RGBA{R: 200}, -1)
+
+	for _, size := range []int{2, 16} {
+		path := filepath.Join(t.TempDir(), "snapshot.png")
+		if err := writePalettedPNG(path, &img, size); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		palette, ok := decoded.ColorModel().(color.Palette)
+		if !ok {
+			t.Fatalf("size %d: got a %T image, want a paletted one", size, decoded)
+		}
+		if len(palette) > size {
+			t.Errorf("size %d: got %d colors", size, len(palette))
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package homesecurity
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// pathVars are the values of the tokens of a path template
+type pathVars struct {
+	Source string
+	Class  string
+	ID     string
+	Time   time.Time
+}
+
+// expandPathTemplate replaces the {source}, {date}, {time}, {class} and
+// {id} tokens of the template. Values are sanitized to be a single path
+// element, as sources can be URLs.
+func expandPathTemplate(template string, vars pathVars) string {
+	return strings.NewReplacer(
+		"{source}", sanitizePathElement(vars.Source),
+		"{date}", vars.Time.Format("2006-01-02"),
+		"{time}", vars.Time.Format("01-02-2006_15.04.05.000"),
+		"{class}", sanitizePathElement(vars.Class),
+		"{id}", sanitizePathElement(vars.ID),
+	).Replace(template)
+}
+
+// sanitizePathElement replaces the characters that are not safe
+// within a file name with underscores
+func sanitizePathElement(s string) string {
+	mapped := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		}
+		return '_'
+	}, s)
+	// never point to the current or parent folder
+	if len(strings.Trim(mapped, ".")) == 0 {
+		return strings.Repeat("_", len(mapped)+1)
+	}
+	return mapped
+}
+
+// templateRoot returns the folder of a path template preceding any token,
+// that is the one that can be created and checked in advance
+func templateRoot(template string) string {
+	i := strings.Index(template, "{")
+	if i < 0 {
+		return template
+	}
+	// the placeholder stands for the partial path element
+	// the first token is part of, if any
+	return filepath.Dir(template[:i] + "_")
+}
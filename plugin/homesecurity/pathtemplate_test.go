@@ -0,0 +1,62 @@
+package homesecurity
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpandPathTemplate(t *testing.T) {
+	vars := pathVars{
+		Source: "rtsp://user@camera:554/stream",
+		Class:  "human",
+		ID:     "1234",
+		Time:   time.Date(2022, 3, 4, 5, 6, 7, 8000000, time.UTC),
+	}
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"/snaps/{source}", "/snaps/rtsp___user_camera_554_stream"},
+		{"/snaps/{date}", "/snaps/2022-03-04"},
+		{"{time}.png", "03-04-2022_05.06.07.008.png"},
+		{"/snaps/{class}/{id}", "/snaps/human/1234"},
+		{"/snaps/{source}/{date}/", "/snaps/rtsp___user_camera_554_stream/2022-03-04/"},
+		{"/snaps/{unknown}", "/snaps/{unknown}"},
+	}
+	for _, tt := range tests {
+		if got := expandPathTemplate(tt.template, vars); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizePathElement(t *testing.T) {
+	tests := []struct {
+		s, want string
+	}{
+		{"front-door.cam", "front-door.cam"},
+		{"/dev/video0", "_dev_video0"},
+		{"..", "___"},
+		{"", "_"},
+	}
+	for _, tt := range tests {
+		if got := sanitizePathElement(tt.s); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestTemplateRoot(t *testing.T) {
+	tests := []struct {
+		template, want string
+	}{
+		{"/snaps", "/snaps"},
+		{"/snaps/{source}/{date}", "/snaps"},
+		{"/snaps/cam-{source}", "/snaps"},
+	}
+	for _, tt := range tests {
+		if got := templateRoot(tt.template); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.template, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package homesecurity
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PauseSwitch allows to pause and resume the detection from another goroutine.
+// A nil PauseSwitch is never paused.
+type PauseSwitch struct {
+	paused int32
+}
+
+func (p *PauseSwitch) Pause() {
+	atomic.StoreInt32(&p.paused, 1)
+}
+
+func (p *PauseSwitch) Resume() {
+	atomic.StoreInt32(&p.paused, 0)
+}
+
+func (p *PauseSwitch) Paused() bool {
+	return p != nil && atomic.LoadInt32(&p.paused) == 1
+}
+
+// how often WatchPauseFile checks the pause file
+const pauseFilePollInterval = time.Second
+
+// WatchPauseFile pauses the detection when the file at path is created, and
+// resumes it once the file is removed, until ctx is done. The switch is only
+// flipped when the file appears or disappears, leaving alone the pauses
+// requested in other ways. The watcher is added to the wait group.
+func WatchPauseFile(ctx context.Context, path string, pause *PauseSwitch, wg *sync.WaitGroup) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(pauseFilePollInterval)
+		defer ticker.Stop()
+		exists := false
+		for {
+			if _, err := os.Stat(path); (err == nil) != exists {
+				exists = !exists
+				if exists {
+					pause.Pause()
+				} else {
+					pause.Resume()
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,51 @@
+package homesecurity
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitPaused waits for the switch to be in the given state
+func waitPaused(t *testing.T, pause *PauseSwitch, want bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * pauseFilePollInterval)
+	for pause.Paused() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("got paused %v, want %v", pause.Paused(), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatchPauseFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pause")
+	var (
+		pause PauseSwitch
+		wg    sync.WaitGroup
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	WatchPauseFile(ctx, path, &pause, &wg)
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	// pauses requested in other ways are left alone
+	pause.Pause()
+	time.Sleep(2 * pauseFilePollInterval)
+	waitPaused(t, &pause, true)
+	pause.Resume()
+
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitPaused(t, &pause, true)
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	waitPaused(t, &pause, false)
+}
@@ -0,0 +1,40 @@
+package homesecurity
+
+import (
+	"image"
+
+	"gocv.io/x/gocv"
+)
+
+// contrastEnhancer equalizes the luminance of frames with CLAHE,
+// leaving their colors untouched
+type contrastEnhancer struct {
+	clahe gocv.CLAHE
+	ycc   gocv.Mat
+}
+
+func newContrastEnhancer() *contrastEnhancer {
+	return &contrastEnhancer{
+		clahe: gocv.NewCLAHEWithParams(2.0, image.Pt(8, 8)),
+		ycc:   gocv.NewMat(),
+	}
+}
+
+// Apply writes the enhanced version of src to dst
+func (e *contrastEnhancer) Apply(src gocv.Mat, dst *gocv.Mat) {
+	gocv.CvtColor(src, &e.ycc, gocv.ColorBGRToYCrCb)
+	channels := gocv.Split(e.ycc)
+	defer func() {
+		for _, c := range channels {
+			c.Close()
+		}
+	}()
+	e.clahe.Apply(channels[0], &channels[0])
+	gocv.Merge(channels, &e.ycc)
+	gocv.CvtColor(e.ycc, dst, gocv.ColorYCrCbToBGR)
+}
+
+func (e *contrastEnhancer) Close() error {
+	e.ycc.Close()
+	return e.clahe.Close()
+}
@@ -0,0 +1,45 @@
+package homesecurity
+
+import (
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// luminanceRange returns the difference between the brightest
+// and the darkest pixel of the frame
+func luminanceRange(img gocv.Mat) float32 {
+	gray := gocv.NewMat()
+	defer gray.Close()
+	gocv.CvtColor(img, &gray, gocv.ColorBGRToGray)
+	min, max, _, _ := gocv.MinMaxLoc(gray)
+	return max - min
+}
+
+func TestContrastEnhancer(t *testing.T) {
+	// a dark frame, with a faint horizontal gradient
+	frame := gocv.NewMatWithSize(64, 64, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			v := uint8(20 + x/4)
+			for c := 0; c < 3; c++ {
+				frame.SetUCharAt(y, x*3+c, v)
+			}
+		}
+	}
+
+	e := newContrastEnhancer()
+	defer e.Close()
+	enhanced := gocv.NewMat()
+	defer enhanced.Close()
+	e.Apply(frame, &enhanced)
+
+	before, after := luminanceRange(frame), luminanceRange(enhanced)
+	if after <= before {
+		t.Errorf("got luminance range %.0f, want wider than %.0f", after, before)
+	}
+	if got := frame.GetUCharAt(0, 0); got != 20 {
+		t.Errorf("source frame modified: got %d, want 20", got)
+	}
+}
@@ -0,0 +1,83 @@
+package homesecurity
+
+import (
+	"github.com/FedeDP/falco-home-security/plugin/detectionpb"
+	"google.golang.org/protobuf/proto"
+)
+
+// MarshalProto encodes the event as a DetectionSet protobuf message
+func MarshalProto(evt VideoEvent) ([]byte, error) {
+	return proto.Marshal(toDetectionSet(evt))
+}
+
+// UnmarshalProto decodes a DetectionSet protobuf message into an event
+func UnmarshalProto(data []byte) (VideoEvent, error) {
+	var set detectionpb.DetectionSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return VideoEvent{}, err
+	}
+	return fromDetectionSet(&set), nil
+}
+
+// toDetectionSet converts the event to the messages of detection.proto
+func toDetectionSet(evt VideoEvent) *detectionpb.DetectionSet {
+	set := &detectionpb.DetectionSet{
+		VideoSource:  evt.VideoSource,
+		SourceLabel:  evt.SourceLabel,
+		SnapshotPath: evt.SnapshotPath,
+		Paused:       evt.Paused,
+		Resumed:      evt.Resumed,
+		Tampered:     evt.Tampered,
+		Idle:         evt.Idle,
+		StateRefresh: evt.StateRefresh,
+		Error:        evt.Error,
+	}
+	for _, blob := range evt.Blobs {
+		set.Detections = append(set.Detections, &detectionpb.Detection{
+			Id:         blob.ID,
+			Category:   int32(blob.Category),
+			Confidence: blob.Confidence,
+			Box: &detectionpb.BoundingBox{
+				Left:   int32(blob.Position.Left),
+				Top:    int32(blob.Position.Top),
+				Right:  int32(blob.Position.Right),
+				Bottom: int32(blob.Position.Bottom),
+			},
+			DominantColor: blob.DominantColor,
+			Abandoned:     blob.Abandoned,
+		})
+	}
+	return set
+}
+
+// fromDetectionSet converts a DetectionSet message back to an event
+func fromDetectionSet(set *detectionpb.DetectionSet) VideoEvent {
+	evt := VideoEvent{
+		VideoSource:  set.GetVideoSource(),
+		SourceLabel:  set.GetSourceLabel(),
+		SnapshotPath: set.GetSnapshotPath(),
+		Paused:       set.GetPaused(),
+		Resumed:      set.GetResumed(),
+		Tampered:     set.GetTampered(),
+		Idle:         set.GetIdle(),
+		StateRefresh: set.GetStateRefresh(),
+		Error:        set.GetError(),
+	}
+	for _, d := range set.GetDetections() {
+		box := d.GetBox()
+		evt.Blobs = append(evt.Blobs, Blob{
+			ID:         d.GetId(),
+			Category:   CategoryID(d.GetCategory()),
+			Confidence: d.GetConfidence(),
+			Position: BlobPosition{
+				Left:   int(box.GetLeft()),
+				Top:    int(box.GetTop()),
+				Right:  int(box.GetRight()),
+				Bottom: int(box.GetBottom()),
+			},
+			DominantColor: d.GetDominantColor(),
+			Abandoned:     d.GetAbandoned(),
+		})
+	}
+	return evt
+}
@@ -0,0 +1,50 @@
+package homesecurity
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProtoRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		evt  VideoEvent
+	}{
+		{"empty", VideoEvent{}},
+		{"flags", VideoEvent{VideoSource: "/dev/video0", SourceLabel: "door", Paused: true, Resumed: true, Tampered: true, Idle: true, StateRefresh: true}},
+		{"error", VideoEvent{VideoSource: "/dev/video0", Error: "detection panicked: boom"}},
+		{"detections", VideoEvent{
+			VideoSource:  "rtsp://cam",
+			SnapshotPath: "/tmp/snap.png",
+			Blobs: []Blob{
+				{ID: 1, Category: Human, Confidence: 0.87, Position: BlobPosition{Left: 10, Top: 20, Right: 110, Bottom: 220}, DominantColor: "red"},
+				{ID: 2, Category: Animal, Confidence: 0.5, Position: BlobPosition{Left: -5, Top: 0, Right: 30, Bottom: 40}, Abandoned: true},
+			},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := MarshalProto(tt.evt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := UnmarshalProto(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.evt) {
+				t.Errorf("got %+v, want %+v", got, tt.evt)
+			}
+		})
+	}
+}
+
+func TestUnmarshalProtoTruncated(t *testing.T) {
+	data, err := MarshalProto(VideoEvent{VideoSource: "/dev/video0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UnmarshalProto(data[:len(data)-1]); err == nil {
+		t.Error("truncated message decoded")
+	}
+}
@@ -0,0 +1,69 @@
+package homesecurity
+
+import (
+	"image"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// frames are compared at this size, as global motion doesn't need details
+const (
+	ptzSampleWidth  = 160
+	ptzSampleHeight = 120
+)
+
+const defaultPtzSettleMillis = 2000
+
+// ptzSuppressor recognizes camera movements, like PTZ pans, as the whole
+// frame changing at once, so that detection can be suppressed meanwhile
+type ptzSuppressor struct {
+	threshold float64
+	settle    time.Duration
+
+	small gocv.Mat
+	prev  gocv.Mat
+	cur   gocv.Mat
+	diff  gocv.Mat
+
+	// detection is suppressed until then
+	until time.Time
+}
+
+func newPtzSuppressor(cfg *OpenConfig) *ptzSuppressor {
+	settle := cfg.PtzSettleMillis
+	if settle == 0 {
+		settle = defaultPtzSettleMillis
+	}
+	return &ptzSuppressor{
+		threshold: cfg.PtzMotionThreshold,
+		settle:    time.Duration(settle) * time.Millisecond,
+		small:     gocv.NewMat(),
+		prev:      gocv.NewMat(),
+		cur:       gocv.NewMat(),
+		diff:      gocv.NewMat(),
+	}
+}
+
+// Moving returns true while the camera is moving, and for
+// the settle period after it stopped
+func (p *ptzSuppressor) Moving(img *gocv.Mat, now time.Time) bool {
+	gocv.Resize(*img, &p.small, image.Pt(ptzSampleWidth, ptzSampleHeight), 0, 0, gocv.InterpolationArea)
+	gocv.CvtColor(p.small, &p.cur, gocv.ColorBGRToGray)
+	if !p.prev.Empty() {
+		gocv.AbsDiff(p.cur, p.prev, &p.diff)
+		// mean absolute difference per pixel, from 0 to 255
+		if p.diff.Mean().Val1 > p.threshold {
+			p.until = now.Add(p.settle)
+		}
+	}
+	p.cur.CopyTo(&p.prev)
+	return now.Before(p.until)
+}
+
+func (p *ptzSuppressor) Close() {
+	p.small.Close()
+	p.prev.Close()
+	p.cur.Close()
+	p.diff.Close()
+}
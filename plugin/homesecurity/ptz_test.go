@@ -0,0 +1,40 @@
+package homesecurity
+
+import (
+	"testing"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+func TestPtzSuppressor(t *testing.T) {
+	still := checkerboard()
+	defer still.Close()
+	// panning shifts the whole scene between frames
+	panned := gocv.NewMat()
+	defer panned.Close()
+	gocv.BitwiseNot(still, &panned)
+
+	p := newPtzSuppressor(&OpenConfig{PtzMotionThreshold: 30, PtzSettleMillis: 1000})
+	defer p.Close()
+	now := time.Unix(1000, 0)
+	tests := []struct {
+		name   string
+		frame  *gocv.Mat
+		moving bool
+	}{
+		{"first frame", &still, false},
+		{"static", &still, false},
+		{"panning", &panned, true},
+		{"panning", &still, true},
+		{"settling", &still, true},
+		{"settling", &still, true},
+		{"settled", &still, false},
+	}
+	for i, tt := range tests {
+		if moving := p.Moving(tt.frame, now); moving != tt.moving {
+			t.Errorf("frame %d (%s): got moving %v, want %v", i, tt.name, moving, tt.moving)
+		}
+		now = now.Add(400 * time.Millisecond)
+	}
+}
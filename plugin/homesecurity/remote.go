@@ -0,0 +1,127 @@
+package homesecurity
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+const defaultInferenceTimeoutMillis = 5000
+
+// consecutive failed requests after which the inference server is
+// considered down, ending the session
+const maxInferenceFailures = 5
+
+// errFrameSkipped is returned by detectors giving up on a frame, which is
+// then skipped without affecting the tracked blobs
+var errFrameSkipped = errors.New("frame skipped")
+
+// remoteDetection is a detection returned by the inference server:
+// a COCO class id, its confidence, and a box in pixels of the frame
+type remoteDetection struct {
+	ClassID    int     `json:"classId"`
+	Confidence float64 `json:"confidence"`
+	Left       int     `json:"left"`
+	Top        int     `json:"top"`
+	Right      int     `json:"right"`
+	Bottom     int     `json:"bottom"`
+}
+
+type remoteResponse struct {
+	Detections []remoteDetection `json:"detections"`
+}
+
+// remoteDetector offloads the inference to an external HTTP service:
+// each frame is POSTed as a JPEG to InferenceServer, which answers with
+// a JSON object like {"detections": [{"classId": 1, "confidence": 0.9,
+// "left": 10, "top": 20, "right": 110, "bottom": 220}]}.
+// Frames whose request fails are skipped, until maxInferenceFailures
+// consecutive ones fail, while malformed answers end the session.
+type remoteDetector struct {
+	cfg      *DetectionConfig
+	client   *http.Client
+	failures int
+}
+
+func newRemoteDetector(cfg *DetectionConfig) *remoteDetector {
+	timeout := cfg.InferenceTimeoutMillis
+	if timeout == 0 {
+		timeout = defaultInferenceTimeoutMillis
+	}
+	return &remoteDetector{
+		cfg:    cfg,
+		client: &http.Client{Timeout: time.Duration(timeout) * time.Millisecond},
+	}
+}
+
+func (d *remoteDetector) Detect(img *gocv.Mat) ([]Blob, error) {
+	buf, err := gocv.IMEncode(gocv.JPEGFileExt, *img)
+	if err != nil {
+		return nil, err
+	}
+	defer buf.Close()
+
+	resp, err := d.client.Post(d.cfg.InferenceServer, "image/jpeg", bytes.NewReader(buf.GetBytes()))
+	if err != nil {
+		return nil, d.failed(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return nil, d.failed(fmt.Errorf("inference server answered %s: %s", resp.Status, bytes.TrimSpace(body)))
+	}
+	var result remoteResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("malformed inference server response: %s", err.Error())
+	}
+	d.failures = 0
+	return d.cfg.remoteBlobs(result.Detections), nil
+}
+
+// failed reports a failed request, and returns errFrameSkipped unless
+// too many consecutive requests failed
+func (d *remoteDetector) failed(err error) error {
+	d.failures++
+	if d.failures >= maxInferenceFailures {
+		return fmt.Errorf("%d consecutive inference requests failed, the last one with: %s", d.failures, err.Error())
+	}
+	fmt.Printf("skipping frame, inference request failed: %s\n", err.Error())
+	return errFrameSkipped
+}
+
+// remoteBlobs filters the detections of the inference server as
+// PerformBlob does with the ones of local models
+func (cfg *DetectionConfig) remoteBlobs(detections []remoteDetection) []Blob {
+	var blobs []Blob
+	for _, det := range detections {
+		if det.Confidence <= cfg.MinConfidence {
+			continue
+		}
+		c := ParseClassID(det.ClassID)
+		if !c.Known() || (cfg.PersonOnly && det.ClassID != personClassID) {
+			continue
+		}
+		pos := BlobPosition{Left: det.Left, Top: det.Top, Right: det.Right, Bottom: det.Bottom}
+		if cfg.ignored(pos) {
+			continue
+		}
+		blobs = append(blobs, Blob{
+			Category:   c,
+			Confidence: det.Confidence,
+			Position:   pos,
+			Scores:     []ClassScore{{Category: c, Confidence: det.Confidence}},
+		})
+	}
+	return blobs
+}
+
+func (d *remoteDetector) Close() error {
+	d.client.CloseIdleConnections()
+	return nil
+}
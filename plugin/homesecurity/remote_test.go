@@ -0,0 +1,87 @@
+package homesecurity
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+func TestRemoteDetector(t *testing.T) {
+	// answers are served in order, the last one from then on
+	answers := []struct {
+		status int
+		body   string
+		delay  time.Duration
+	}{
+		{http.StatusOK, `{"detections": [{"classId": 1, "confidence": 0.9, "left": 10, "top": 20, "right": 110, "bottom": 220}, {"classId": 1, "confidence": 0.2}]}`, 0},
+		{http.StatusServiceUnavailable, "overloaded", 0},
+		{http.StatusOK, `{"detections": []}`, 200 * time.Millisecond},
+		{http.StatusOK, `{"detections": []}`, 0},
+		{http.StatusInternalServerError, "down", 0},
+	}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "image/jpeg" {
+			t.Errorf("got content type %q, want image/jpeg", ct)
+		}
+		answer := answers[len(answers)-1]
+		if requests < len(answers) {
+			answer = answers[requests]
+		}
+		requests++
+		time.Sleep(answer.delay)
+		w.WriteHeader(answer.status)
+		fmt.Fprint(w, answer.body)
+	}))
+	defer server.Close()
+
+	det := newRemoteDetector(&DetectionConfig{InferenceServer: server.URL, InferenceTimeoutMillis: 100, MinConfidence: 0.5})
+	defer det.Close()
+	frame := gocv.NewMatWithSize(240, 320, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+
+	steps := []struct {
+		blobs int
+		err   error
+	}{
+		{1, nil},
+		// errors and timeouts skip the frame
+		{0, errFrameSkipped},
+		{0, errFrameSkipped},
+		// a success resets the failures
+		{0, nil},
+		{0, errFrameSkipped},
+		{0, errFrameSkipped},
+		{0, errFrameSkipped},
+		{0, errFrameSkipped},
+	}
+	for i, s := range steps {
+		blobs, err := det.Detect(&frame)
+		if len(blobs) != s.blobs || err != s.err {
+			t.Fatalf("request %d: got %d blobs, %v, want %d, %v", i, len(blobs), err, s.blobs, s.err)
+		}
+	}
+	if _, err := det.Detect(&frame); err == nil || err == errFrameSkipped {
+		t.Errorf("got %v after %d consecutive failures, want the session to end", err, maxInferenceFailures)
+	}
+}
+
+func TestRemoteDetectorMalformed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"detections": [`)
+	}))
+	defer server.Close()
+
+	det := newRemoteDetector(&DetectionConfig{InferenceServer: server.URL})
+	defer det.Close()
+	frame := gocv.NewMatWithSize(240, 320, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+	if _, err := det.Detect(&frame); err == nil || !strings.Contains(err.Error(), "malformed") {
+		t.Errorf("got %v, want a malformed response error", err)
+	}
+}
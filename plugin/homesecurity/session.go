@@ -0,0 +1,104 @@
+package homesecurity
+
+import (
+	"context"
+	"sync"
+)
+
+// Detector is a detection session, built by NewDetector from options
+type Detector struct {
+	cfg   *DetectionConfig
+	oCfg  *OpenConfig
+	pause *PauseSwitch
+	wg    *sync.WaitGroup
+}
+
+// Option configures a Detector
+type Option func(d *Detector)
+
+// WithDetectionConfig sets the model and how its detections are tracked
+func WithDetectionConfig(cfg *DetectionConfig) Option {
+	return func(d *Detector) {
+		d.cfg = cfg
+	}
+}
+
+// WithOpenConfig sets the video source and the outputs of the session
+func WithOpenConfig(oCfg *OpenConfig) Option {
+	return func(d *Detector) {
+		d.oCfg = oCfg
+	}
+}
+
+// WithPauseSwitch sets the switch pausing and resuming the detection
+func WithPauseSwitch(pause *PauseSwitch) Option {
+	return func(d *Detector) {
+		d.pause = pause
+	}
+}
+
+// WithWaitGroup sets the wait group the detection loop is added to, letting
+// callers wait for it to release the video source once stopped
+func WithWaitGroup(wg *sync.WaitGroup) Option {
+	return func(d *Detector) {
+		d.wg = wg
+	}
+}
+
+// NewDetector returns a detection session configured by the given options.
+// The configs default to the zero ones, and are expected to be validated
+// by the caller.
+func NewDetector(opts ...Option) *Detector {
+	d := &Detector{}
+	for _, opt := range opts {
+		opt(d)
+	}
+	if d.cfg == nil {
+		d.cfg = &DetectionConfig{}
+	}
+	if d.oCfg == nil {
+		d.oCfg = &OpenConfig{}
+	}
+	if d.pause == nil {
+		d.pause = &PauseSwitch{}
+	}
+	if d.wg == nil {
+		d.wg = &sync.WaitGroup{}
+	}
+	return d
+}
+
+// Run starts the detection loop in a new goroutine, until ctx is done or
+// the video source ends. The events are sent on the first channel, and the
+// error ending the session, ErrDeviceClosed once the source has no more
+// frames, on the second one; both are closed once the loop returns.
+// Rendered frames are discarded: use LaunchVideoDetection to show them.
+// The loop, and the goroutine discarding the frames, only end with ctx or
+// the source: callers that stop reading the channels before they are
+// closed must cancel ctx, else the loop blocks on its next event.
+func (d *Detector) Run(ctx context.Context) (<-chan VideoEvent, <-chan error) {
+	detectionChan, renderChan, errorChan := d.launch(ctx)
+	go func() {
+		for range renderChan {
+		}
+	}()
+	return detectionChan, errorChan
+}
+
+// launch starts the detection loop in a new goroutine, stopped by ctx
+func (d *Detector) launch(ctx context.Context) (DetectionChan, RenderChan, ErrorChan) {
+	detectionChan := make(DetectionChan)
+	renderChan := make(RenderChan)
+	errorChan := make(ErrorChan)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer close(detectionChan)
+		defer close(renderChan)
+		defer close(errorChan)
+		superviseDetection(ctx, d.oCfg, detectionChan, errorChan, func() {
+			runDetection(ctx, d.cfg, d.oCfg, d.pause, detectionChan, renderChan, errorChan)
+		})
+	}()
+	return detectionChan, renderChan, errorChan
+}
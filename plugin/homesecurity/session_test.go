@@ -0,0 +1,59 @@
+package homesecurity
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDetectorCancelled(t *testing.T) {
+	tests := []struct {
+		name string
+		// events read before cancelling the context
+		events int
+	}{
+		{"before running", -1},
+		{"without reading", 0},
+		{"while running", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.events < 0 {
+				cancel()
+			}
+			var wg sync.WaitGroup
+			oCfg := &OpenConfig{VideoSource: testPatternSource, EmitEveryFrame: true}
+			d := NewDetector(WithDetectionConfig(testTrackConfig()), WithOpenConfig(oCfg), WithWaitGroup(&wg))
+			detectionc, errorc := d.Run(ctx)
+			for i := 0; i < tt.events; i++ {
+				select {
+				case <-detectionc:
+				case err := <-errorc:
+					t.Fatalf("detection ended: %v", err)
+				case <-time.After(5 * time.Second):
+					t.Fatalf("got %d events, want %d", i, tt.events)
+				}
+			}
+			cancel()
+
+			// the loop returns without anyone reading, then closes the channels
+			stopped := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-time.After(5 * time.Second):
+				t.Fatal("the detection loop did not end")
+			}
+			for range detectionc {
+			}
+			for range errorc {
+			}
+		})
+	}
+}
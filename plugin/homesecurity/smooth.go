@@ -0,0 +1,70 @@
+package homesecurity
+
+import "sort"
+
+// default number of events the smoothed blob counts are computed over
+const defaultSmoothingWindow = 5
+
+// CountSmoother keeps the blob counts of the recent events, and returns
+// their median, which is stable against single-frame flickering.
+type CountSmoother struct {
+	window  int
+	history []map[CategoryID]uint64
+	totals  []uint64
+}
+
+func NewCountSmoother(window int) *CountSmoother {
+	if window <= 0 {
+		window = defaultSmoothingWindow
+	}
+	return &CountSmoother{window: window}
+}
+
+// Add registers the blobs of a new event, dropping the oldest one
+// falling out of the window
+func (s *CountSmoother) Add(blobs []Blob) {
+	counts := make(map[CategoryID]uint64)
+	for _, blob := range blobs {
+		counts[blob.Category]++
+	}
+	s.history = append(s.history, counts)
+	s.totals = append(s.totals, uint64(len(blobs)))
+	if len(s.history) > s.window {
+		s.history = s.history[1:]
+		s.totals = s.totals[1:]
+	}
+}
+
+// Total returns the median of the overall blob counts
+func (s *CountSmoother) Total() uint64 {
+	return median(s.totals)
+}
+
+// ByCategory returns the median of the blob counts of each category
+// seen within the window
+func (s *CountSmoother) ByCategory() map[CategoryID]uint64 {
+	res := make(map[CategoryID]uint64)
+	for _, counts := range s.history {
+		for c := range counts {
+			if _, ok := res[c]; ok {
+				continue
+			}
+			values := make([]uint64, len(s.history))
+			for i, h := range s.history {
+				values[i] = h[c]
+			}
+			res[c] = median(values)
+		}
+	}
+	return res
+}
+
+// median returns the lower median of the values, 0 if there are none
+func median(values []uint64) uint64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]uint64(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[(len(sorted)-1)/2]
+}
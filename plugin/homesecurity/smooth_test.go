@@ -0,0 +1,33 @@
+package homesecurity
+
+import "testing"
+
+func TestCountSmoother(t *testing.T) {
+	s := NewCountSmoother(5)
+	// two humans, with a missed detection and a spurious one
+	counts := []int{2, 2, 1, 2, 3, 2, 2}
+	for i, n := range counts {
+		var blobs []Blob
+		for j := 0; j < n; j++ {
+			blobs = append(blobs, testBlob(Human, j*200, 0, 0.9))
+		}
+		s.Add(blobs)
+		if i < 1 {
+			continue
+		}
+		if got := s.Total(); got != 2 {
+			t.Errorf("event %d: got smoothed count %d, want 2", i, got)
+		}
+		if got := s.ByCategory()[Human]; got != 2 {
+			t.Errorf("event %d: got smoothed human count %d, want 2", i, got)
+		}
+	}
+
+	// categories leaving the window are dropped
+	for i := 0; i < 5; i++ {
+		s.Add(nil)
+	}
+	if got := s.ByCategory(); len(got) != 0 {
+		t.Errorf("got %v after an empty window", got)
+	}
+}
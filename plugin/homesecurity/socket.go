@@ -0,0 +1,117 @@
+package homesecurity
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+)
+
+// number of events buffered for each client before starting to drop them
+const socketClientQueue = 64
+
+// eventSocket streams events as JSON lines, optionally compressed,
+// to all the clients connected to a Unix domain socket.
+type eventSocket struct {
+	path     string
+	format   lineFormat
+	listener net.Listener
+	mu       sync.Mutex
+	clients  map[*socketClient]bool
+}
+
+type socketClient struct {
+	conn  net.Conn
+	queue chan []byte
+}
+
+func listenEventSocket(path string, format lineFormat) (*eventSocket, error) {
+	// remove any stale socket left by a previous run
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	s := &eventSocket{
+		path:     path,
+		format:   format,
+		listener: listener,
+		clients:  make(map[*socketClient]bool),
+	}
+	go s.accept()
+	return s, nil
+}
+
+func (s *eventSocket) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			// listener has been closed
+			return
+		}
+		c := &socketClient{
+			conn:  conn,
+			queue: make(chan []byte, socketClientQueue),
+		}
+		s.mu.Lock()
+		s.clients[c] = true
+		s.mu.Unlock()
+		go s.serve(c)
+	}
+}
+
+func (s *eventSocket) serve(c *socketClient) {
+	defer s.remove(c)
+	for line := range c.queue {
+		if _, err := c.conn.Write(line); err != nil {
+			return
+		}
+	}
+}
+
+func (s *eventSocket) remove(c *socketClient) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clients[c] {
+		delete(s.clients, c)
+		close(c.queue)
+		c.conn.Close()
+	}
+}
+
+// Write sends the event to all the connected clients. Events are
+// dropped for clients that are not keeping up.
+func (s *eventSocket) Write(evt *VideoEvent) error {
+	line, err := encodeEventLine(evt, s.format)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		select {
+		case c.queue <- line:
+		default:
+			fmt.Printf("dropping event for slow socket client\n")
+		}
+	}
+	return nil
+}
+
+// Close disconnects all the clients and removes the socket file
+func (s *eventSocket) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	for c := range s.clients {
+		delete(s.clients, c)
+		close(c.queue)
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+	if rmErr := os.Remove(s.path); rmErr != nil && !os.IsNotExist(rmErr) && err == nil {
+		err = rmErr
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package homesecurity
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEventSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.sock")
+	s, err := listenEventSocket(path, lineFormat{ascii: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// the client is served once it has been accepted
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		n := len(s.clients)
+		s.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			s.Close()
+			t.Fatal("client never accepted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := s.Write(&VideoEvent{CorrelationID: "abc", Blobs: []Blob{{ID: 1, Category: Human}}}); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got loggedEvent
+	if err := json.Unmarshal(line, &got); err != nil {
+		t.Fatalf("invalid JSON line %q: %s", line, err.Error())
+	}
+	if got.CorrelationID != "abc" || len(got.Blobs) != 1 {
+		t.Errorf("got %+v, want event abc with 1 blob", got)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("socket file not removed: %v", err)
+	}
+}
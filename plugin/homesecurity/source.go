@@ -0,0 +1,413 @@
+package homesecurity
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// frameSource is anything frames can be read from, one at a time
+type frameSource interface {
+	Read(img *gocv.Mat) bool
+	Close() error
+}
+
+// mediaPositioner is implemented by the sources knowing the position,
+// within the media, of the last frame read
+type mediaPositioner interface {
+	MediaPosition() (time.Duration, bool)
+}
+
+// mediaPosition returns the position of the last frame read from the
+// source, if known. Live sources have no position.
+func mediaPosition(src frameSource) (time.Duration, bool) {
+	var msec float64
+	switch s := src.(type) {
+	case mediaPositioner:
+		return s.MediaPosition()
+	case *gocv.VideoCapture:
+		msec = s.Get(gocv.VideoCapturePosMsec)
+	case *endOffsetSource:
+		msec = s.Get(gocv.VideoCapturePosMsec)
+	}
+	if msec <= 0 {
+		return 0, false
+	}
+	return time.Duration(msec * float64(time.Millisecond)), true
+}
+
+// isVideoFile returns true if the video source is a local file. Frames
+// of files have a position within the media, while devices and network
+// streams are live, even if some of them report a position.
+func isVideoFile(videoSource string) bool {
+	info, err := os.Stat(videoSource)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// frameTimestamp returns the time of the last frame read from the source,
+// that is its position within the media counted from mediaStart, if set
+// and known, or else the wall clock
+func frameTimestamp(src frameSource, mediaStart time.Time) time.Time {
+	if !mediaStart.IsZero() {
+		if pos, ok := mediaPosition(src); ok {
+			return mediaStart.Add(pos)
+		}
+	}
+	return time.Now()
+}
+
+// mediaSeeker is implemented by the sources able to move to a position
+// within the media
+type mediaSeeker interface {
+	SeekMedia(pos time.Duration)
+}
+
+// seekMedia moves the source to the given position within the media,
+// if the source supports it
+func seekMedia(src frameSource, pos time.Duration) {
+	msec := float64(pos) / float64(time.Millisecond)
+	switch s := src.(type) {
+	case mediaSeeker:
+		s.SeekMedia(pos)
+	case *gocv.VideoCapture:
+		s.Set(gocv.VideoCapturePosMsec, msec)
+	case *endOffsetSource:
+		s.Set(gocv.VideoCapturePosMsec, msec)
+	}
+}
+
+// capture backends by name, the empty one being the default
+var captureAPIs = map[string]gocv.VideoCaptureAPI{
+	"":          gocv.VideoCaptureAny,
+	"any":       gocv.VideoCaptureAny,
+	"v4l2":      gocv.VideoCaptureV4L2,
+	"ffmpeg":    gocv.VideoCaptureFFmpeg,
+	"gstreamer": gocv.VideoCaptureGstreamer,
+}
+
+// openSource opens the video source of the sessions, replaced by tests
+var openSource = openFrameSource
+
+// openFrameSource opens the capture device (webcam, file, or stream)
+// or the synthetic source matching the open config
+func openFrameSource(cfg *OpenConfig) (frameSource, error) {
+	videoSource := cfg.VideoSource
+	if isTestPattern(videoSource) {
+		return newTestPattern(videoSource)
+	}
+
+	api := captureAPIs[cfg.CaptureAPI]
+
+	// If it is a number, open a video capture from webcam, else from file
+	id, err := strconv.Atoi(videoSource)
+	if err == nil {
+		capture, err := gocv.OpenVideoCaptureWithAPI(id, api)
+		if err != nil {
+			return nil, fmt.Errorf("error opening video capture device: %v", videoSource)
+		}
+		logCaptureProperties(setCaptureProperties(capture, cfg))
+		return capture, nil
+	}
+
+	capture, err := gocv.VideoCaptureFileWithAPI(videoSource, api)
+	if err != nil {
+		return nil, fmt.Errorf("error opening video capture device: %v", videoSource)
+	}
+	logCaptureProperties(setCaptureProperties(capture, cfg))
+	if err := seekFile(capture, cfg.StartOffsetSeconds, cfg.EndOffsetSeconds); err != nil {
+		capture.Close()
+		return nil, err
+	}
+	if cfg.EndOffsetSeconds > 0 {
+		return &endOffsetSource{VideoCapture: capture, endMsec: cfg.EndOffsetSeconds * 1000}, nil
+	}
+	return capture, nil
+}
+
+// captureProperties is implemented by the capture devices, and by the fake
+// ones of the tests
+type captureProperties interface {
+	Set(prop gocv.VideoCaptureProperties, param float64)
+	Get(prop gocv.VideoCaptureProperties) float64
+	ToCodec(codec string) float64
+	CodecString() string
+}
+
+// setCaptureProperties requests the configured properties to the capture
+// device, and returns the ones it actually picked, as devices silently fall
+// back to the closest values they support. Nothing is returned if no
+// property is configured.
+func setCaptureProperties(capture captureProperties, cfg *OpenConfig) string {
+	if cfg.CaptureWidth == 0 && cfg.CaptureHeight == 0 && cfg.CaptureFPS == 0 && cfg.CaptureFourcc == "" {
+		return ""
+	}
+	// the codec goes first, as it may restrict the available resolutions
+	if cfg.CaptureFourcc != "" {
+		capture.Set(gocv.VideoCaptureFOURCC, capture.ToCodec(cfg.CaptureFourcc))
+	}
+	if cfg.CaptureWidth > 0 {
+		capture.Set(gocv.VideoCaptureFrameWidth, float64(cfg.CaptureWidth))
+	}
+	if cfg.CaptureHeight > 0 {
+		capture.Set(gocv.VideoCaptureFrameHeight, float64(cfg.CaptureHeight))
+	}
+	if cfg.CaptureFPS > 0 {
+		capture.Set(gocv.VideoCaptureFPS, cfg.CaptureFPS)
+	}
+	return fmt.Sprintf("%vx%v at %v fps, codec %q",
+		capture.Get(gocv.VideoCaptureFrameWidth), capture.Get(gocv.VideoCaptureFrameHeight),
+		capture.Get(gocv.VideoCaptureFPS), capture.CodecString())
+}
+
+func logCaptureProperties(effective string) {
+	if len(effective) > 0 {
+		fmt.Printf("capture properties: %s\n", effective)
+	}
+}
+
+// warmUp reads and discards the given number of frames. Failing to read
+// them is reported differently than the source being closed later on,
+// as it usually means the source is not working at all.
+func warmUp(src frameSource, img *gocv.Mat, frames int) error {
+	for i := 0; i < frames; i++ {
+		if ok := src.Read(img); !ok {
+			return fmt.Errorf("failed to read warmup frame %d of %d", i+1, frames)
+		}
+	}
+	return nil
+}
+
+// seekFile moves a file capture to the start offset, checking that
+// both offsets fall within the file duration, if known
+func seekFile(capture *gocv.VideoCapture, start, end float64) error {
+	frames := capture.Get(gocv.VideoCaptureFrameCount)
+	fps := capture.Get(gocv.VideoCaptureFPS)
+	if frames > 0 && fps > 0 {
+		duration := frames / fps
+		if start >= duration {
+			return fmt.Errorf("startOffsetSeconds %v is past the end of the video (%.3fs)", start, duration)
+		}
+		if end > duration {
+			return fmt.Errorf("endOffsetSeconds %v is past the end of the video (%.3fs)", end, duration)
+		}
+	}
+	if start > 0 {
+		capture.Set(gocv.VideoCapturePosMsec, start*1000)
+	}
+	return nil
+}
+
+// endOffsetSource stops reading a file capture past an end offset
+type endOffsetSource struct {
+	*gocv.VideoCapture
+	endMsec float64
+}
+
+func (s *endOffsetSource) Read(img *gocv.Mat) bool {
+	if s.Get(gocv.VideoCapturePosMsec) >= s.endMsec {
+		return false
+	}
+	return s.VideoCapture.Read(img)
+}
+
+// queuedSource reads frames from another source in a separate goroutine,
+// keeping only the most recent ones in a bounded queue. This way, slow
+// consumers always work on the freshest frames and never block the capture.
+type queuedSource struct {
+	src    frameSource
+	frames chan queuedFrame
+	stop   chan struct{}
+	done   chan struct{}
+
+	// ends the reads waiting for a frame, once the consumer stops
+	quit <-chan struct{}
+
+	// media position of the last frame read, if known
+	pos   time.Duration
+	posOk bool
+}
+
+type queuedFrame struct {
+	mat   gocv.Mat
+	pos   time.Duration
+	posOk bool
+}
+
+func newQueuedSource(src frameSource, depth int, quit <-chan struct{}) *queuedSource {
+	q := &queuedSource{
+		src:    src,
+		frames: make(chan queuedFrame, depth),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		quit:   quit,
+	}
+	go q.capture()
+	return q
+}
+
+func (q *queuedSource) capture() {
+	defer close(q.done)
+	defer close(q.frames)
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+
+		frame := queuedFrame{mat: gocv.NewMat()}
+		if ok := q.src.Read(&frame.mat); !ok {
+			frame.mat.Close()
+			return
+		}
+		frame.pos, frame.posOk = mediaPosition(q.src)
+
+		// drop the oldest frames until there is room for the new one
+		for pushed := false; !pushed; {
+			select {
+			case q.frames <- frame:
+				pushed = true
+			default:
+				select {
+				case old := <-q.frames:
+					old.mat.Close()
+				default:
+				}
+			}
+		}
+	}
+}
+
+func (q *queuedSource) Read(img *gocv.Mat) bool {
+	var frame queuedFrame
+	select {
+	case <-q.quit:
+		return false
+	case f, ok := <-q.frames:
+		if !ok {
+			return false
+		}
+		frame = f
+	}
+	defer frame.mat.Close()
+	frame.mat.CopyTo(img)
+	q.pos, q.posOk = frame.pos, frame.posOk
+	return true
+}
+
+func (q *queuedSource) MediaPosition() (time.Duration, bool) {
+	return q.pos, q.posOk
+}
+
+// Close stops the capture. A frame still being read is not waited for, as
+// a stalled source might never return it: the source and the frames left
+// are released once it does.
+func (q *queuedSource) Close() error {
+	close(q.stop)
+	select {
+	case <-q.done:
+		return q.release()
+	default:
+		go q.release()
+		return nil
+	}
+}
+
+func (q *queuedSource) release() error {
+	<-q.done
+	for frame := range q.frames {
+		frame.mat.Close()
+	}
+	return q.src.Close()
+}
+
+// number of attempts made to reopen a source after sleeping
+const reopenAttempts = 3
+
+// burstSource reads bursts of frames, releasing the underlying source
+// and sleeping between one burst and the next to save power. Reopened
+// sources are warmed up again, and files resume from the last frame read.
+type burstSource struct {
+	open     func() (frameSource, error)
+	src      frameSource
+	burst    int
+	interval time.Duration
+	warmup   int
+	read     int
+	done     <-chan struct{}
+
+	// media position of the last frame read, if known
+	pos   time.Duration
+	posOk bool
+}
+
+func newBurstSource(src frameSource, open func() (frameSource, error), burst int, interval time.Duration, warmup int, done <-chan struct{}) *burstSource {
+	return &burstSource{
+		open:     open,
+		src:      src,
+		burst:    burst,
+		interval: interval,
+		warmup:   warmup,
+		done:     done,
+	}
+}
+
+func (b *burstSource) Read(img *gocv.Mat) bool {
+	if b.src == nil {
+		select {
+		case <-b.done:
+			return false
+		case <-time.After(b.interval):
+		}
+		if err := b.reopen(); err != nil {
+			fmt.Printf("failed to reopen video source: %s\n", err.Error())
+			return false
+		}
+		if err := warmUp(b.src, img, b.warmup); err != nil {
+			fmt.Printf("failed to reopen video source: %s\n", err.Error())
+			return false
+		}
+		if b.posOk {
+			seekMedia(b.src, b.pos)
+		}
+	}
+
+	ok := b.src.Read(img)
+	b.pos, b.posOk = mediaPosition(b.src)
+	b.read++
+	if b.read >= b.burst {
+		b.src.Close()
+		b.src = nil
+		b.read = 0
+	}
+	return ok
+}
+
+func (b *burstSource) MediaPosition() (time.Duration, bool) {
+	return b.pos, b.posOk
+}
+
+func (b *burstSource) reopen() error {
+	var err error
+	for i := 0; i < reopenAttempts; i++ {
+		if b.src, err = b.open(); err == nil {
+			return nil
+		}
+		select {
+		case <-b.done:
+			return err
+		case <-time.After(time.Second):
+		}
+	}
+	return err
+}
+
+func (b *burstSource) Close() error {
+	if b.src == nil {
+		return nil
+	}
+	return b.src.Close()
+}
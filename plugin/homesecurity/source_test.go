@@ -0,0 +1,425 @@
+package homesecurity
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// numberedSource is a frame source whose media position, in milliseconds,
+// is the number of the last frame read, ending after limit frames
+type numberedSource struct {
+	n      int
+	limit  int
+	reads  int
+	closed bool
+}
+
+func (s *numberedSource) Read(img *gocv.Mat) bool {
+	if s.n >= s.limit {
+		return false
+	}
+	s.n++
+	s.reads++
+	return true
+}
+
+func (s *numberedSource) MediaPosition() (time.Duration, bool) {
+	return time.Duration(s.n) * time.Millisecond, true
+}
+
+func (s *numberedSource) SeekMedia(pos time.Duration) {
+	s.n = int(pos / time.Millisecond)
+}
+
+func (s *numberedSource) Close() error {
+	s.closed = true
+	return nil
+}
+
+// readPositions reads all the frames of the source, returning their positions
+func readPositions(src frameSource) []time.Duration {
+	img := gocv.NewMat()
+	defer img.Close()
+	var positions []time.Duration
+	for src.Read(&img) {
+		pos, _ := mediaPosition(src)
+		positions = append(positions, pos)
+	}
+	return positions
+}
+
+func TestQueuedSourceDropsStaleFrames(t *testing.T) {
+	src := &numberedSource{limit: 10}
+	q := newQueuedSource(src, 2, nil)
+	// a slow consumer only gets to read once all the frames are captured
+	select {
+	case <-q.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("capture blocked by the consumer")
+	}
+	got := readPositions(q)
+	want := []time.Duration{9 * time.Millisecond, 10 * time.Millisecond}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("got frames %v, want the newest ones %v", got, want)
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !src.closed {
+		t.Error("source not closed")
+	}
+}
+
+// stalledSource is a frame source whose reads block until it is unblocked
+type stalledSource struct {
+	unblock chan struct{}
+	closed  chan struct{}
+}
+
+func (s *stalledSource) Read(img *gocv.Mat) bool {
+	<-s.unblock
+	return false
+}
+
+func (s *stalledSource) Close() error {
+	close(s.closed)
+	return nil
+}
+
+func TestQueuedSourceStalled(t *testing.T) {
+	src := &stalledSource{unblock: make(chan struct{}), closed: make(chan struct{})}
+	quit := make(chan struct{})
+	q := newQueuedSource(src, 2, quit)
+
+	// neither the consumer nor the closing wait for the stalled read
+	read := make(chan bool)
+	go func() {
+		img := gocv.NewMat()
+		defer img.Close()
+		read <- q.Read(&img)
+	}()
+	close(quit)
+	select {
+	case ok := <-read:
+		if ok {
+			t.Error("got a frame")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("read not ended by quit")
+	}
+	closed := make(chan error)
+	go func() { closed <- q.Close() }()
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("close blocked by the stalled read")
+	}
+
+	// the source is released once the read returns
+	close(src.unblock)
+	select {
+	case <-src.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("source not closed")
+	}
+}
+
+// writeTestVideo writes a video file of the given number of frames
+func writeTestVideo(t *testing.T, frames int, fps float64) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.avi")
+	w, err := gocv.VideoWriterFile(path, "MJPG", fps, 64, 48, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < frames; i++ {
+		frame := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(float64(i*10), 0, 0, 0), 48, 64, gocv.MatTypeCV8UC3)
+		err := w.Write(frame)
+		frame.Close()
+		if err != nil {
+			w.Close()
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestFileOffsets(t *testing.T) {
+	// 2 seconds of video
+	path := writeTestVideo(t, 20, 10)
+	tests := []struct {
+		name       string
+		start, end float64
+		frames     int
+	}{
+		{"whole file", 0, 0, 20},
+		{"start offset", 1, 0, 10},
+		{"both offsets", 0.5, 1.5, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := openFrameSource(&OpenConfig{VideoSource: path, StartOffsetSeconds: tt.start, EndOffsetSeconds: tt.end})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer src.Close()
+			positions := readPositions(src)
+			if len(positions) != tt.frames {
+				t.Fatalf("got %d frames, want %d", len(positions), tt.frames)
+			}
+			if first := positions[0]; first < time.Duration(tt.start*float64(time.Second)) {
+				t.Errorf("got a frame at %s, before the start offset", first)
+			}
+		})
+	}
+
+	if _, err := openFrameSource(&OpenConfig{VideoSource: path, StartOffsetSeconds: 3}); err == nil {
+		t.Error("start offset past the end of the video accepted")
+	}
+}
+
+func TestBurstSource(t *testing.T) {
+	var opened []*numberedSource
+	open := func() (frameSource, error) {
+		src := &numberedSource{limit: 100}
+		opened = append(opened, src)
+		return src, nil
+	}
+	first, _ := open()
+	done := make(chan struct{})
+	interval := 20 * time.Millisecond
+	b := newBurstSource(first, open, 2, interval, 1, done)
+
+	start := time.Now()
+	got := readPositions(&frameLimit{src: b, limit: 6})
+	if elapsed := time.Since(start); elapsed < 2*interval {
+		t.Errorf("6 frames read in %s, want at least 2 sleeps of %s", elapsed, interval)
+	}
+	// the file resumes where the previous burst left it
+	for i, pos := range got {
+		if want := time.Duration(i+1) * time.Millisecond; pos != want {
+			t.Errorf("got frames %v, want them in sequence", got)
+			break
+		}
+	}
+	if len(opened) != 3 {
+		t.Fatalf("source opened %d times, want 3", len(opened))
+	}
+	for i, src := range opened {
+		if !src.closed && i < 2 {
+			t.Errorf("source %d not released after its burst", i)
+		}
+		// reopened sources are warmed up again
+		if want := 2 + minInt(i, 1); src.reads != want {
+			t.Errorf("source %d: got %d reads, want %d", i, src.reads, want)
+		}
+	}
+
+	// the last burst released the source, and stopping
+	// doesn't wait for the interval to elapse
+	close(done)
+	img := gocv.NewMat()
+	defer img.Close()
+	start = time.Now()
+	b.interval = time.Hour
+	if b.Read(&img) {
+		t.Error("frame read once stopped")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("stopping took %s", elapsed)
+	}
+}
+
+// frameLimit ends a source after limit frames
+type frameLimit struct {
+	src   frameSource
+	limit int
+}
+
+func (f *frameLimit) Read(img *gocv.Mat) bool {
+	if f.limit == 0 {
+		return false
+	}
+	f.limit--
+	return f.src.Read(img)
+}
+
+func (f *frameLimit) MediaPosition() (time.Duration, bool) {
+	return mediaPosition(f.src)
+}
+
+func (f *frameLimit) Close() error {
+	return f.src.Close()
+}
+
+func TestWarmUp(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames int
+		limit  int
+		ok     bool
+	}{
+		{"no warmup", 0, 10, true},
+		{"discarded", 3, 10, true},
+		{"source failing", 3, 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &numberedSource{limit: tt.limit}
+			img := gocv.NewMat()
+			defer img.Close()
+			err := warmUp(src, &img, tt.frames)
+			if (err == nil) != tt.ok {
+				t.Fatalf("got error %v, want success %v", err, tt.ok)
+			}
+			if err != nil && !strings.Contains(err.Error(), "warmup") {
+				t.Errorf("got %q, not telling apart warmup failures", err.Error())
+			}
+			// the first frame processed is the one after the warmup
+			if tt.ok && (!src.Read(&img) || src.n != tt.frames+1) {
+				t.Errorf("got frame %d after the warmup, want %d", src.n, tt.frames+1)
+			}
+		})
+	}
+}
+
+func TestIsVideoFile(t *testing.T) {
+	path := writeTestVideo(t, 1, 10)
+	tests := []struct {
+		source string
+		want   bool
+	}{
+		{path, true},
+		{filepath.Dir(path), false},
+		{"0", false},
+		{"rtsp://camera/stream", false},
+	}
+	for _, tt := range tests {
+		if got := isVideoFile(tt.source); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.source, got, tt.want)
+		}
+	}
+}
+
+func TestMediaTimestamps(t *testing.T) {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	path := writeTestVideo(t, 10, 10)
+	src, err := openFrameSource(&OpenConfig{VideoSource: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	img := gocv.NewMat()
+	defer img.Close()
+
+	// the first frame may have no position yet
+	prev := start
+	for i := 0; src.Read(&img); i++ {
+		ts := frameTimestamp(src, start)
+		if i > 0 && !ts.After(prev) {
+			t.Errorf("frame %d at %s, not after %s", i, ts, prev)
+		}
+		if ts.Sub(start) > time.Second {
+			t.Errorf("frame %d at %s, past the end of the video", i, ts)
+		}
+		prev = ts
+	}
+
+	// positions are ignored for live sources
+	before := time.Now()
+	if ts := frameTimestamp(&numberedSource{n: 5}, time.Time{}); ts.Before(before) {
+		t.Errorf("live frame at %s, not at the wall clock", ts)
+	}
+}
+
+func TestCaptureAPIs(t *testing.T) {
+	tests := []struct {
+		name string
+		want gocv.VideoCaptureAPI
+	}{
+		{"", gocv.VideoCaptureAny},
+		{"any", gocv.VideoCaptureAny},
+		{"v4l2", gocv.VideoCaptureV4L2},
+		{"ffmpeg", gocv.VideoCaptureFFmpeg},
+		{"gstreamer", gocv.VideoCaptureGstreamer},
+	}
+	for _, tt := range tests {
+		api, ok := captureAPIs[tt.name]
+		if !ok || api != tt.want {
+			t.Errorf("%q: got %v, %v, want %v", tt.name, api, ok, tt.want)
+		}
+		if err := ValidateOpenConfig(&OpenConfig{VideoSource: "0", CaptureAPI: tt.name}); err != nil {
+			t.Errorf("%q: %s", tt.name, err)
+		}
+	}
+}
+
+// fakeCapture is a capture device supporting up to 640x480 at 30 fps
+type fakeCapture struct {
+	props map[gocv.VideoCaptureProperties]float64
+	set   []gocv.VideoCaptureProperties
+}
+
+func (c *fakeCapture) Set(prop gocv.VideoCaptureProperties, param float64) {
+	limits := map[gocv.VideoCaptureProperties]float64{
+		gocv.VideoCaptureFrameWidth:  640,
+		gocv.VideoCaptureFrameHeight: 480,
+		gocv.VideoCaptureFPS:         30,
+	}
+	if limit, ok := limits[prop]; ok && param > limit {
+		param = limit
+	}
+	c.props[prop] = param
+	c.set = append(c.set, prop)
+}
+
+func (c *fakeCapture) Get(prop gocv.VideoCaptureProperties) float64 {
+	return c.props[prop]
+}
+
+func (c *fakeCapture) ToCodec(codec string) float64 {
+	return float64(codec[0])
+}
+
+func (c *fakeCapture) CodecString() string {
+	if c.props[gocv.VideoCaptureFOURCC] == 'M' {
+		return "MJPG"
+	}
+	return ""
+}
+
+func TestSetCaptureProperties(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       OpenConfig
+		set       int
+		effective string
+	}{
+		{"none", OpenConfig{}, 0, ""},
+		{"accepted", OpenConfig{CaptureWidth: 320, CaptureHeight: 240, CaptureFPS: 15}, 3, `320x240 at 15 fps, codec ""`},
+		{"clamped", OpenConfig{CaptureWidth: 1280, CaptureHeight: 720, CaptureFPS: 60, CaptureFourcc: "MJPG"}, 4, `640x480 at 30 fps, codec "MJPG"`},
+	}
+	for _, tt := range tests {
+		capture := &fakeCapture{props: make(map[gocv.VideoCaptureProperties]float64)}
+		effective := setCaptureProperties(capture, &tt.cfg)
+		if len(capture.set) != tt.set {
+			t.Errorf("%s: got %d properties set, want %d", tt.name, len(capture.set), tt.set)
+		}
+		if tt.cfg.CaptureFourcc != "" && capture.set[0] != gocv.VideoCaptureFOURCC {
+			t.Errorf("%s: the codec is not set first", tt.name)
+		}
+		if effective != tt.effective {
+			t.Errorf("%s: got effective %q, want %q", tt.name, effective, tt.effective)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package homesecurity
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExpandSources returns the open config of each video source of a session:
+// the config itself, or a copy of it for each source listed in SourcesFile.
+func ExpandSources(oCfg *OpenConfig) ([]*OpenConfig, error) {
+	if len(oCfg.SourcesFile) == 0 {
+		return []*OpenConfig{oCfg}, nil
+	}
+	file, err := os.Open(oCfg.SourcesFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var sources []*OpenConfig
+	labels := make(map[string]int)
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		source, label, ok := parseSourceLine(scanner.Text())
+		if !ok {
+			continue
+		}
+		if len(label) == 0 {
+			label = oCfg.SourceLabel
+		} else if prev, dup := labels[label]; dup {
+			return nil, fmt.Errorf("%s:%d: label %q is already used at line %d", oCfg.SourcesFile, n, label, prev)
+		} else {
+			labels[label] = n
+		}
+		sCfg := *oCfg
+		sCfg.SourcesFile = ""
+		sCfg.VideoSource = source
+		sCfg.SourceLabel = label
+		if err := ValidateOpenConfig(&sCfg); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", oCfg.SourcesFile, n, err.Error())
+		}
+		sources = append(sources, &sCfg)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("%s lists no video source", oCfg.SourcesFile)
+	}
+	return sources, nil
+}
+
+// parseSourceLine parses a line of a sources file, made of a source
+// optionally followed by its label. Blank lines and the ones starting
+// with # are skipped.
+func parseSourceLine(line string) (source, label string, ok bool) {
+	line = strings.TrimSpace(line)
+	if len(line) == 0 || strings.HasPrefix(line, "#") {
+		return "", "", false
+	}
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		return line[:i], strings.TrimSpace(line[i:]), true
+	}
+	return line, "", true
+}
+
+// LaunchSources launches the detection of each source, as in
+// LaunchVideoDetection, merging what they send into a single set of
+// channels. A source ending, even with an error, only ends its own
+// detection, and is notified by a SourceEnded event; once all the
+// detections have ended, ErrDeviceClosed is sent and the channels closed.
+func LaunchSources(ctx context.Context, cfg *DetectionConfig, oCfgs []*OpenConfig, pause *PauseSwitch, wg *sync.WaitGroup) (DetectionChan, RenderChan, ErrorChan) {
+	if len(oCfgs) == 1 {
+		return LaunchVideoDetection(ctx, cfg, oCfgs[0], pause, wg)
+	}
+
+	detectionChan := make(DetectionChan)
+	renderChan := make(RenderChan)
+	errorChan := make(ErrorChan)
+	var forwarders sync.WaitGroup
+	for _, oCfg := range oCfgs {
+		detectionc, renderc, errorc := LaunchVideoDetection(ctx, cfg, oCfg, pause, wg)
+		forwarders.Add(3)
+		go func() {
+			defer forwarders.Done()
+			for evt := range detectionc {
+				select {
+				case <-ctx.Done():
+					return
+				case detectionChan <- evt:
+				}
+			}
+		}()
+		go func() {
+			defer forwarders.Done()
+			for img := range renderc {
+				select {
+				case <-ctx.Done():
+					return
+				case renderChan <- img:
+				}
+			}
+		}()
+		go func(oCfg *OpenConfig) {
+			defer forwarders.Done()
+			for err := range errorc {
+				videoEv := VideoEvent{
+					CorrelationID: NewCorrelationID(),
+					Timestamp:     time.Now(),
+					VideoSource:   oCfg.VideoSource,
+					SourceLabel:   oCfg.SourceLabel,
+					SourceEnded:   true,
+				}
+				if err != ErrDeviceClosed {
+					videoEv.Error = err.Error()
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case detectionChan <- videoEv:
+				}
+			}
+		}(oCfg)
+	}
+	go func() {
+		forwarders.Wait()
+		select {
+		case <-ctx.Done():
+		case errorChan <- ErrDeviceClosed:
+		}
+		close(detectionChan)
+		close(renderChan)
+		close(errorChan)
+	}()
+	return detectionChan, renderChan, errorChan
+}
@@ -0,0 +1,134 @@
+package homesecurity
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeSourcesFile(t *testing.T, lines ...string) string {
+	path := filepath.Join(t.TempDir(), "sources.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExpandSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		sources []string
+		labels  []string
+		err     string
+	}{
+		{"labels", []string{"# cameras", "rtsp://garage garage", "", "  rtsp://porch\tporch  "},
+			[]string{"rtsp://garage", "rtsp://porch"}, []string{"garage", "porch"}, ""},
+		{"default label", []string{"rtsp://garage"}, []string{"rtsp://garage"}, []string{"home"}, ""},
+		{"duplicate label", []string{"rtsp://garage garage", "rtsp://porch garage"}, nil, nil, "already used at line 1"},
+		{"empty", []string{"# nothing"}, nil, nil, "lists no video source"},
+	}
+	for _, tt := range tests {
+		oCfg := &OpenConfig{SourceLabel: "home", SourcesFile: writeSourcesFile(t, tt.lines...)}
+		sources, err := ExpandSources(oCfg)
+		if len(tt.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: got error %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", tt.name, err)
+		}
+		if len(sources) != len(tt.sources) {
+			t.Fatalf("%s: got %d sources, want %d", tt.name, len(sources), len(tt.sources))
+		}
+		for i, sCfg := range sources {
+			if sCfg.VideoSource != tt.sources[i] || sCfg.SourceLabel != tt.labels[i] || len(sCfg.SourcesFile) > 0 {
+				t.Errorf("%s: source %d is %s, %s, want %s, %s", tt.name, i, sCfg.VideoSource, sCfg.SourceLabel, tt.sources[i], tt.labels[i])
+			}
+		}
+	}
+}
+
+func TestLaunchSources(t *testing.T) {
+	path := writeSourcesFile(t, testPatternSource+" first", testPatternSynthetic+" second")
+	sources, err := ExpandSources(&OpenConfig{SourcesFile: path, SingleShot: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	detectionc, _, errorc := LaunchSources(ctx, testTrackConfig(), sources, &PauseSwitch{}, &wg)
+
+	// each source sends its single shot, then ends
+	shots := make(map[string]int)
+	ended := make(map[string]int)
+	for done := false; !done; {
+		select {
+		case <-ctx.Done():
+			t.Fatal("the sources did not end")
+		case evt := <-detectionc:
+			if evt.SourceEnded {
+				ended[evt.SourceLabel]++
+			} else {
+				shots[evt.SourceLabel]++
+			}
+		case err := <-errorc:
+			if err != ErrDeviceClosed {
+				t.Errorf("got error %v, want ErrDeviceClosed", err)
+			}
+			done = true
+		}
+	}
+	wg.Wait()
+	for _, label := range []string{"first", "second"} {
+		if shots[label] != 1 || ended[label] != 1 {
+			t.Errorf("source %s: got %d events and %d ends, want 1 and 1", label, shots[label], ended[label])
+		}
+	}
+}
+
+func TestSourceFailureIsolation(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.mp4")
+	path := writeSourcesFile(t, testPatternSource+" working", missing+" failing")
+	sources, err := ExpandSources(&OpenConfig{SourcesFile: path, EmitEveryFrame: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	var wg sync.WaitGroup
+	detectionc, _, errorc := LaunchSources(ctx, testTrackConfig(), sources, &PauseSwitch{}, &wg)
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	// the working source keeps sending events once the other one failed
+	failed := false
+	for after := 0; after < 3; {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("got %d events after the failure, want 3", after)
+		case evt := <-detectionc:
+			switch {
+			case evt.SourceLabel == "failing":
+				if !evt.SourceEnded || len(evt.Error) == 0 {
+					t.Errorf("got %+v from the failing source, want its end with the error", evt)
+				}
+				failed = true
+			case evt.SourceEnded:
+				t.Fatalf("the working source ended: %s", evt.Error)
+			case failed:
+				after++
+			}
+		case err := <-errorc:
+			t.Fatalf("the session ended: %v", err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package homesecurity
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// name of the database/sql driver, registered by sqlite_driver.go
+const sqliteDriver = "sqlite3"
+
+// number of rows queued before Write blocks
+const sqliteQueue = 256
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS detections (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	time TEXT NOT NULL,
+	source TEXT NOT NULL,
+	label TEXT NOT NULL,
+	class TEXT NOT NULL,
+	confidence REAL NOT NULL,
+	left INTEGER NOT NULL,
+	top INTEGER NOT NULL,
+	right INTEGER NOT NULL,
+	bottom INTEGER NOT NULL,
+	snapshot_path TEXT NOT NULL,
+	correlation_id TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS detections_time ON detections (time);
+`
+
+const sqliteInsert = `INSERT INTO detections
+	(time, source, label, class, confidence, left, top, right, bottom, snapshot_path, correlation_id)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+type sqliteRow []interface{}
+
+// sqliteLog inserts a row per blob of each event into a SQLite database,
+// for a searchable history. Rows are inserted by a separate goroutine, in a
+// transaction for all the rows queued up in the meantime.
+type sqliteLog struct {
+	db   *sql.DB
+	rows chan sqliteRow
+	done chan error
+}
+
+func openSqliteLog(path string) (*sqliteLog, error) {
+	if !sqliteSupported() {
+		return nil, fmt.Errorf("SQLite support is not built in, rebuild with -tags sqlite")
+	}
+	db, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	l := &sqliteLog{
+		db:   db,
+		rows: make(chan sqliteRow, sqliteQueue),
+		done: make(chan error, 1),
+	}
+	go l.insert()
+	return l, nil
+}
+
+func sqliteSupported() bool {
+	for _, d := range sql.Drivers() {
+		if d == sqliteDriver {
+			return true
+		}
+	}
+	return false
+}
+
+// Write queues a row for each blob of the event
+func (l *sqliteLog) Write(evt *VideoEvent) error {
+	ts := evt.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	at := ts.UTC().Format(time.RFC3339Nano)
+	for _, blob := range evt.Blobs {
+		pos := blob.Position
+		l.rows <- sqliteRow{
+			at, evt.VideoSource, evt.SourceLabel, blob.Class, blob.Confidence,
+			pos.Left, pos.Top, pos.Right, pos.Bottom, evt.SnapshotPath, evt.CorrelationID,
+		}
+	}
+	return nil
+}
+
+// insert inserts the queued rows until the queue is closed. Failing batches
+// are reported and dropped, so that a broken database doesn't stop events.
+func (l *sqliteLog) insert() {
+	var lastErr error
+	for row := range l.rows {
+		batch := []sqliteRow{row}
+		// take whatever else is already queued
+		for more := true; more; {
+			select {
+			case row, ok := <-l.rows:
+				if !ok {
+					more = false
+					break
+				}
+				batch = append(batch, row)
+			default:
+				more = false
+			}
+		}
+		if err := l.insertBatch(batch); err != nil {
+			fmt.Printf("failed to insert %d detections: %s\n", len(batch), err.Error())
+			lastErr = err
+		}
+	}
+	l.done <- lastErr
+}
+
+func (l *sqliteLog) insertBatch(batch []sqliteRow) error {
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(sqliteInsert)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for _, row := range batch {
+		if _, err := stmt.Exec(row...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Close inserts the queued rows and closes the database
+func (l *sqliteLog) Close() error {
+	close(l.rows)
+	err := <-l.done
+	if closeErr := l.db.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,7 @@
+//go:build sqlite
+// +build sqlite
+
+package homesecurity
+
+// the driver needs cgo and a C compiler, so it's only built on demand
+import _ "github.com/mattn/go-sqlite3"
@@ -0,0 +1,81 @@
+//go:build sqlite
+// +build sqlite
+
+package homesecurity
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSqliteLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "detections.db")
+	at := time.Date(2022, 3, 4, 5, 6, 7, 0, time.UTC)
+	human := Blob{Class: "Human", Confidence: 0.9, Position: BlobPosition{Left: 1, Top: 2, Right: 3, Bottom: 4}}
+	animal := Blob{Class: "Animal", Confidence: 0.5, Position: BlobPosition{Left: 5, Top: 6, Right: 7, Bottom: 8}}
+	events := []VideoEvent{
+		{Timestamp: at, VideoSource: "rtsp://cam", SourceLabel: "door", CorrelationID: "a", SnapshotPath: "/snaps/a.png", Blobs: []Blob{human, animal}},
+		// no blobs, no rows
+		{Timestamp: at, VideoSource: "rtsp://cam", Paused: true},
+		{Timestamp: at.Add(time.Second), VideoSource: "rtsp://cam", SourceLabel: "door", CorrelationID: "b", Blobs: []Blob{human}},
+	}
+	// reopening keeps the rows of the previous sessions
+	for session := 0; session < 2; session++ {
+		l, err := openSqliteLog(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range events {
+			if err := l.Write(&events[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := l.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db, err := sql.Open(sqliteDriver, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT time, source, label, class, confidence, left, top, right, bottom, snapshot_path, correlation_id FROM detections ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	type row struct {
+		time, source, label, class string
+		confidence                 float64
+		left, top, right, bottom   int
+		snapshot, id               string
+	}
+	want := []row{
+		{"2022-03-04T05:06:07Z", "rtsp://cam", "door", "Human", 0.9, 1, 2, 3, 4, "/snaps/a.png", "a"},
+		{"2022-03-04T05:06:07Z", "rtsp://cam", "door", "Animal", 0.5, 5, 6, 7, 8, "/snaps/a.png", "a"},
+		{"2022-03-04T05:06:08Z", "rtsp://cam", "door", "Human", 0.9, 1, 2, 3, 4, "", "b"},
+	}
+	want = append(want, want...)
+	var got []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.time, &r.source, &r.label, &r.class, &r.confidence, &r.left, &r.top, &r.right, &r.bottom, &r.snapshot, &r.id); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("row %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package homesecurity
+
+import (
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	defaultTamperLuminance = 20.0
+	defaultTamperSharpness = 10.0
+	defaultTamperSeconds   = 3.0
+)
+
+// tamperDetector recognizes a covered or defocused camera, that is frames
+// staying too dark or too blurry for a while
+type tamperDetector struct {
+	luminance float64
+	sharpness float64
+	duration  time.Duration
+
+	gray      gocv.Mat
+	laplacian gocv.Mat
+	mean      gocv.Mat
+	stddev    gocv.Mat
+
+	// when frames started looking tampered, if they do
+	since    time.Time
+	tampered bool
+}
+
+func newTamperDetector(cfg *OpenConfig) *tamperDetector {
+	t := &tamperDetector{
+		luminance: cfg.TamperLuminance,
+		sharpness: cfg.TamperSharpness,
+		duration:  time.Duration(cfg.TamperSeconds * float64(time.Second)),
+		gray:      gocv.NewMat(),
+		laplacian: gocv.NewMat(),
+		mean:      gocv.NewMat(),
+		stddev:    gocv.NewMat(),
+	}
+	if t.luminance == 0 {
+		t.luminance = defaultTamperLuminance
+	}
+	if t.sharpness == 0 {
+		t.sharpness = defaultTamperSharpness
+	}
+	if t.duration == 0 {
+		t.duration = time.Duration(defaultTamperSeconds * float64(time.Second))
+	}
+	return t
+}
+
+// Check measures the frame, and returns true only on the frame
+// at which the camera is considered tampered
+func (t *tamperDetector) Check(img *gocv.Mat, now time.Time) bool {
+	luminance, sharpness := t.measure(img)
+	if luminance >= t.luminance && sharpness >= t.sharpness {
+		t.since = time.Time{}
+		t.tampered = false
+		return false
+	}
+	if t.since.IsZero() {
+		t.since = now
+	}
+	if t.tampered || now.Sub(t.since) < t.duration {
+		return false
+	}
+	t.tampered = true
+	return true
+}
+
+// measure returns the mean luminance of the frame, and its sharpness
+// as the variance of its Laplacian
+func (t *tamperDetector) measure(img *gocv.Mat) (float64, float64) {
+	gocv.CvtColor(*img, &t.gray, gocv.ColorBGRToGray)
+	luminance := t.gray.Mean().Val1
+
+	gocv.Laplacian(t.gray, &t.laplacian, gocv.MatTypeCV64F, 1, 1, 0, gocv.BorderDefault)
+	gocv.MeanStdDev(t.laplacian, &t.mean, &t.stddev)
+	stddev := t.stddev.GetDoubleAt(0, 0)
+	return luminance, stddev * stddev
+}
+
+func (t *tamperDetector) Close() {
+	t.gray.Close()
+	t.laplacian.Close()
+	t.mean.Close()
+	t.stddev.Close()
+}
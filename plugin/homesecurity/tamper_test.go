@@ -0,0 +1,70 @@
+package homesecurity
+
+import (
+	"image"
+	"image/color"
+	"testing"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// checkerboard returns a bright and sharp frame
+func checkerboard() gocv.Mat {
+	img := gocv.NewMatWithSize(120, 160, gocv.MatTypeCV8UC3)
+	for y := 0; y < 120; y += 10 {
+		for x := (y / 10 % 2) * 10; x < 160; x += 20 {
+			gocv.Rectangle(&img, image.Rect(x, y, x+10, y+10), color.RGBA{255, 255, 255, 0}, -1)
+		}
+	}
+	return img
+}
+
+func TestTamperDetector(t *testing.T) {
+	normal := checkerboard()
+	defer normal.Close()
+	black := gocv.NewMatWithSize(120, 160, gocv.MatTypeCV8UC3)
+	defer black.Close()
+	// bright enough, but with no detail at all
+	blurred := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(128, 128, 128, 0), 120, 160, gocv.MatTypeCV8UC3)
+	defer blurred.Close()
+
+	tests := []struct {
+		name  string
+		frame *gocv.Mat
+	}{
+		{"covered", &black},
+		{"defocused", &blurred},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTamperDetector(&OpenConfig{TamperSeconds: 2})
+			defer d.Close()
+			now := time.Unix(1000, 0)
+			for i := 0; i < 5; i++ {
+				if d.Check(&normal, now) {
+					t.Fatal("normal frame reported as tampered")
+				}
+				now = now.Add(500 * time.Millisecond)
+			}
+
+			// reported once, after TamperSeconds
+			var reported []int
+			for i := 0; i < 10; i++ {
+				if d.Check(tt.frame, now) {
+					reported = append(reported, i)
+				}
+				now = now.Add(500 * time.Millisecond)
+			}
+			if len(reported) != 1 || reported[0] != 4 {
+				t.Errorf("got tamper reported at frames %v, want only at 4", reported)
+			}
+
+			// normal frames reset the detector
+			d.Check(&normal, now)
+			if d.Check(tt.frame, now.Add(time.Second)) {
+				t.Error("tamper reported again before TamperSeconds")
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package homesecurity
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+const (
+	testPatternSource    = "testpattern"
+	testPatternSynthetic = "synthetic://moving-box"
+
+	testPatternWidth  = 640
+	testPatternHeight = 480
+	testPatternBoxW   = 80
+	testPatternBoxH   = 160
+	testPatternStep   = 8
+	testPatternFPS    = 30
+)
+
+func isTestPattern(videoSource string) bool {
+	return videoSource == testPatternSource || strings.HasPrefix(videoSource, "synthetic://")
+}
+
+// testPattern is a synthetic frame source generating frames
+// in-memory, with a colored box moving back and forth.
+type testPattern struct {
+	frame    gocv.Mat
+	box      image.Rectangle
+	dir      int
+	lastRead time.Time
+}
+
+func newTestPattern(videoSource string) (*testPattern, error) {
+	if videoSource != testPatternSource && videoSource != testPatternSynthetic {
+		return nil, fmt.Errorf("unknown synthetic video source: %v", videoSource)
+	}
+	top := (testPatternHeight - testPatternBoxH) / 2
+	return &testPattern{
+		frame: gocv.NewMatWithSize(testPatternHeight, testPatternWidth, gocv.MatTypeCV8UC3),
+		box:   image.Rect(0, top, testPatternBoxW, top+testPatternBoxH),
+		dir:   1,
+	}, nil
+}
+
+// Box returns the position of the box in the last generated frame
+func (t *testPattern) Box() image.Rectangle {
+	return t.box
+}
+
+func (t *testPattern) Read(img *gocv.Mat) bool {
+	// pace the frames like a real camera would do
+	if wait := time.Second/testPatternFPS - time.Since(t.lastRead); wait > 0 {
+		time.Sleep(wait)
+	}
+	t.lastRead = time.Now()
+
+	// bounce the box between the frame borders
+	if t.box.Max.X+testPatternStep*t.dir > testPatternWidth || t.box.Min.X+testPatternStep*t.dir < 0 {
+		t.dir = -t.dir
+	}
+	t.box = t.box.Add(image.Pt(testPatternStep*t.dir, 0))
+
+	t.frame.SetTo(gocv.NewScalar(64, 64, 64, 0))
+	gocv.Rectangle(&t.frame, t.box, color.RGBA{R: 255, G: 128, A: 255}, -1)
+	t.frame.CopyTo(img)
+	return true
+}
+
+func (t *testPattern) Close() error {
+	return t.frame.Close()
+}
+
+// newTestPatternDetector returns the detector of a test pattern, replaced
+// by tests faking detection failures
+var newTestPatternDetector = func(pattern boxSource) detector {
+	return &testPatternDetector{pattern: pattern}
+}
+
+// boxSource is a synthetic source knowing where its box is,
+// so that detecting it needs no model
+type boxSource interface {
+	frameSource
+	Box() image.Rectangle
+}
+
+// testPatternDetector is a detector stub that always
+// finds the box of a test pattern, as a human.
+type testPatternDetector struct {
+	pattern boxSource
+}
+
+func (d *testPatternDetector) Detect(img *gocv.Mat) ([]Blob, error) {
+	box := d.pattern.Box()
+	return []Blob{
+		{
+			Category:   Human,
+			Confidence: 0.9,
+			Position: BlobPosition{
+				Left:   box.Min.X,
+				Top:    box.Min.Y,
+				Right:  box.Max.X,
+				Bottom: box.Max.Y,
+			},
+		},
+	}, nil
+}
+
+func (d *testPatternDetector) Close() error {
+	return nil
+}
@@ -0,0 +1,86 @@
+package homesecurity
+
+import (
+	"image"
+
+	"gocv.io/x/gocv"
+)
+
+// default number of frames between two detections, when interpolating
+const defaultDetectionInterval = 5
+
+type blobTracker struct {
+	tracker gocv.Tracker
+	blob    Blob
+}
+
+// trackingDetector runs the actual detector only once every few frames,
+// and follows the detected blobs with OpenCV trackers in between.
+type trackingDetector struct {
+	det      detector
+	interval int
+	frame    int
+	trackers []blobTracker
+}
+
+func newTrackingDetector(det detector, interval int) *trackingDetector {
+	if interval <= 0 {
+		interval = defaultDetectionInterval
+	}
+	return &trackingDetector{det: det, interval: interval}
+}
+
+func (d *trackingDetector) Detect(img *gocv.Mat) ([]Blob, error) {
+	defer func() { d.frame++ }()
+	if d.frame%d.interval == 0 {
+		blobs, err := d.det.Detect(img)
+		if err != nil {
+			return nil, err
+		}
+		d.reset(img, blobs)
+		return blobs, nil
+	}
+
+	var blobs []Blob
+	for i := range d.trackers {
+		t := &d.trackers[i]
+		rect, ok := t.tracker.Update(*img)
+		if !ok {
+			continue
+		}
+		t.blob.Position = BlobPosition{
+			Left:   rect.Min.X,
+			Top:    rect.Min.Y,
+			Right:  rect.Max.X,
+			Bottom: rect.Max.Y,
+		}
+		blobs = append(blobs, t.blob)
+	}
+	return blobs, nil
+}
+
+// Replaces the current trackers with new ones initialized on the given blobs
+func (d *trackingDetector) reset(img *gocv.Mat, blobs []Blob) {
+	d.closeTrackers()
+	for _, b := range blobs {
+		t := gocv.NewTrackerMIL()
+		rect := image.Rect(b.Position.Left, b.Position.Top, b.Position.Right, b.Position.Bottom)
+		if !t.Init(*img, rect) {
+			t.Close()
+			continue
+		}
+		d.trackers = append(d.trackers, blobTracker{tracker: t, blob: b})
+	}
+}
+
+func (d *trackingDetector) closeTrackers() {
+	for _, t := range d.trackers {
+		t.tracker.Close()
+	}
+	d.trackers = nil
+}
+
+func (d *trackingDetector) Close() error {
+	d.closeTrackers()
+	return d.det.Close()
+}
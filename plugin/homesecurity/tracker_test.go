@@ -0,0 +1,49 @@
+package homesecurity
+
+import (
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+// countingDetector counts the frames the wrapped detector runs on
+type countingDetector struct {
+	detector
+	calls int
+}
+
+func (d *countingDetector) Detect(img *gocv.Mat) ([]Blob, error) {
+	d.calls++
+	return d.detector.Detect(img)
+}
+
+func TestTrackingDetector(t *testing.T) {
+	pattern, err := newTestPattern(testPatternSource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pattern.Close()
+	counter := &countingDetector{detector: &testPatternDetector{pattern: pattern}}
+	d := newTrackingDetector(counter, 3)
+	defer d.Close()
+
+	img := gocv.NewMat()
+	defer img.Close()
+	for i := 0; i < 9; i++ {
+		pattern.Read(&img)
+		blobs, err := d.Detect(&img)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(blobs) != 1 {
+			t.Fatalf("frame %d: got %d blobs, want 1", i, len(blobs))
+		}
+		box := pattern.Box()
+		if diff := blobs[0].Position.Left - box.Min.X; diff < -testPatternStep || diff > testPatternStep {
+			t.Errorf("frame %d: blob at %d, box at %d", i, blobs[0].Position.Left, box.Min.X)
+		}
+	}
+	if counter.calls != 3 {
+		t.Errorf("detector run on %d frames, want 3", counter.calls)
+	}
+}
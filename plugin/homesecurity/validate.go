@@ -0,0 +1,299 @@
+package homesecurity
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+var validBackends = []string{"", "default", "halide", "openvino", "opencv", "vulkan", "cuda"}
+
+var validTargets = []string{"", "cpu", "fp32", "fp16", "vpu", "vulkan", "fpga", "cuda", "cudafp16"}
+
+var validNormalizations = []string{"", "mobilenet", "0-1", "imagenet", "custom"}
+
+var validVotingModes = []string{"", "and", "or", "confidence-avg"}
+
+var validModelKinds = []string{"", "ssd", "boxes-scores"}
+
+var validMatchStrategies = []string{"", "nearness", "hybrid"}
+
+var validTimestampSources = []string{"", "wallclock", "media"}
+
+var validEventGranularities = []string{"", "snapshot", "per-blob"}
+
+var validCaptureAPIs = []string{"", "any", "v4l2", "ffmpeg", "gstreamer"}
+
+var validBoxFormats = []string{"", "corners", "center"}
+
+var validEmbedFormats = []string{"", "jpeg", "png"}
+
+var validFontFaces = []string{"", "plain", "simplex", "duplex", "complex", "triplex"}
+
+// validationErrors collects field-level configuration problems, so that
+// all of them can be reported to the user at once.
+type validationErrors []string
+
+func (v *validationErrors) addf(field, format string, args ...interface{}) {
+	*v = append(*v, field+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *validationErrors) checkMandatory(field, value string) {
+	if len(value) == 0 {
+		v.addf(field, "is mandatory")
+	}
+}
+
+func (v *validationErrors) checkRange(field string, value, min, max float64) {
+	if value < min || value > max {
+		v.addf(field, "must be in [%v, %v], got %v", min, max, value)
+	}
+}
+
+func (v *validationErrors) checkNonNegative(field string, value int) {
+	if value < 0 {
+		v.addf(field, "must not be negative, got %d", value)
+	}
+}
+
+func (v *validationErrors) checkNonNegativeFloat(field string, value float64) {
+	if value < 0 {
+		v.addf(field, "must not be negative, got %v", value)
+	}
+}
+
+func (v *validationErrors) checkPositiveFloat(field string, value float64) {
+	if value <= 0 {
+		v.addf(field, "must be positive, got %v", value)
+	}
+}
+
+func (v *validationErrors) checkEnum(field, value string, valid []string) {
+	for _, s := range valid {
+		if s == value {
+			return
+		}
+	}
+	v.addf(field, "unknown value %q, must be one of %s", value, strings.Join(valid[1:], ", "))
+}
+
+func (v validationErrors) err(what string) error {
+	if len(v) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid %s config: %s", what, strings.Join(v, "; "))
+}
+
+// ValidateDetectionConfig checks all the fields of the init configuration
+// and returns an error listing every problem found, if any.
+func ValidateDetectionConfig(cfg *DetectionConfig) error {
+	var errs validationErrors
+	if len(cfg.InferenceServer) == 0 {
+		errs.checkMandatory("model", cfg.Model)
+		errs.checkMandatory("netConfig", cfg.NetConfig)
+	} else {
+		if u, err := url.Parse(cfg.InferenceServer); err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			errs.addf("inferenceServer", "must be an http or https URL, got %q", cfg.InferenceServer)
+		}
+		if len(cfg.EnsembleModels) > 0 {
+			errs.addf("ensembleModels", "cannot be used with inferenceServer")
+		}
+	}
+	errs.checkNonNegative("inferenceTimeoutMillis", cfg.InferenceTimeoutMillis)
+	for i, m := range cfg.EnsembleModels {
+		errs.checkMandatory(fmt.Sprintf("ensembleModels[%d].model", i), m.Model)
+		errs.checkMandatory(fmt.Sprintf("ensembleModels[%d].netConfig", i), m.NetConfig)
+	}
+	errs.checkEnum("votingMode", cfg.VotingMode, validVotingModes)
+	errs.checkEnum("backend", cfg.Backend, validBackends)
+	errs.checkEnum("target", cfg.Target, validTargets)
+	errs.checkNonNegative("modelLoadRetries", cfg.ModelLoadRetries)
+	errs.checkRange("minConfidence", cfg.MinConfidence, 0, 1)
+	errs.checkRange("memoryMinConfidence", cfg.MemoryMinConfidence, 0, 1)
+	errs.checkRange("memoryDecayFactor", cfg.MemoryDecayFactor, 0, 1)
+	for name, factor := range cfg.MemoryDecayFactorByClass {
+		if !knownCategoryName(name) {
+			errs.addf("memoryDecayFactorByClass", "unknown category %q", name)
+		}
+		errs.checkRange("memoryDecayFactorByClass."+name, factor, 0, 1)
+	}
+	errs.checkRange("memoryNearnessThreshold", cfg.MemoryNearnessThreshold, 0, 1)
+	errs.checkRange("memoryClassSwitchThreshold", cfg.MemoryClassSwitchThreshold, 0, 1)
+	errs.checkNonNegative("minConsecutiveFrames", cfg.MinConsecutiveFrames)
+	errs.checkNonNegativeFloat("minClassSwitchConfidence", cfg.MinClassSwitchConfidence)
+	errs.checkNonNegative("retirementGraceFrames", cfg.RetirementGraceFrames)
+	for i, p := range cfg.SizeConfidenceCurve {
+		field := fmt.Sprintf("sizeConfidenceCurve[%d]", i)
+		errs.checkRange(field+".area", p.Area, 0, 1)
+		errs.checkRange(field+".minConfidence", p.MinConfidence, 0, 1)
+		if i > 0 && p.Area <= cfg.SizeConfidenceCurve[i-1].Area {
+			errs.addf(field+".area", "breakpoints must be sorted by increasing area")
+		}
+	}
+	if cfg.Calibration != nil {
+		errs.checkPositiveFloat("calibration.focalLengthPixels", cfg.Calibration.FocalLengthPixels)
+		errs.checkPositiveFloat("calibration.referenceHeightMeters", cfg.Calibration.ReferenceHeightMeters)
+	}
+	for name, poly := range cfg.Zones {
+		if len(poly) < 3 {
+			errs.addf("zones", "zone %q must have at least 3 points, got %d", name, len(poly))
+		}
+	}
+	for name := range cfg.ClassAliases {
+		if !knownCategoryName(name) {
+			errs.addf("classAliases", "unknown category %q", name)
+		}
+	}
+	errs.checkNonNegative("burstThreshold", cfg.BurstThreshold)
+	errs.checkNonNegative("detectionCacheSize", cfg.DetectionCacheSize)
+	errs.checkNonNegativeFloat("positionChangeThreshold", cfg.PositionChangeThreshold)
+	for name, threshold := range cfg.CountAlerts {
+		if !knownCategoryName(name) {
+			errs.addf("countAlerts", "unknown category %q", name)
+		}
+		if threshold <= 0 {
+			errs.addf("countAlerts."+name, "must be positive, got %d", threshold)
+		}
+	}
+	errs.checkNonNegativeFloat("maxBlobAgeSeconds", cfg.MaxBlobAgeSeconds)
+	errs.checkNonNegativeFloat("abandonedSeconds", cfg.AbandonedSeconds)
+	errs.checkNonNegative("abandonedRadius", cfg.AbandonedRadius)
+	errs.checkRange("nmsThreshold", cfg.NmsThreshold, 0, 1)
+	errs.checkNonNegative("topClasses", cfg.TopClasses)
+	errs.checkNonNegative("tileRows", cfg.TileRows)
+	errs.checkNonNegative("tileCols", cfg.TileCols)
+	errs.checkRange("ignoreThreshold", cfg.IgnoreThreshold, 0, 1)
+	for i, r := range cfg.IgnoreRegions {
+		if r.Right <= r.Left || r.Bottom <= r.Top {
+			errs.addf(fmt.Sprintf("ignoreRegions[%d]", i), "must have right > left and bottom > top")
+		}
+	}
+	errs.checkNonNegative("detectionInterval", cfg.DetectionInterval)
+	errs.checkEnum("modelKind", cfg.ModelKind, validModelKinds)
+	errs.checkNonNegative("maxRawDetections", cfg.MaxRawDetections)
+	errs.checkNonNegative("confidenceDecimals", cfg.ConfidenceDecimals)
+	errs.checkEnum("matchStrategy", cfg.MatchStrategy, validMatchStrategies)
+	errs.checkNonNegative("maxMatchDistance", cfg.MaxMatchDistance)
+	if cfg.ModelKind == "boxes-scores" && len(cfg.OutputLayers) != 2 {
+		errs.addf("outputLayers", "must name the boxes and scores layers for boxes-scores models, got %d", len(cfg.OutputLayers))
+	} else if cfg.ModelKind != "boxes-scores" && len(cfg.OutputLayers) > 1 {
+		errs.addf("outputLayers", "must have at most 1 layer for ssd models, got %d", len(cfg.OutputLayers))
+	}
+	errs.checkEnum("normalization", cfg.Normalization, validNormalizations)
+	errs.checkNonNegativeFloat("inputScale", cfg.InputScale)
+	if cfg.Normalization == "custom" && cfg.InputScale == 0 {
+		errs.addf("inputScale", "is mandatory with custom normalization")
+	}
+	if len(cfg.InputMean) != 0 && len(cfg.InputMean) != 3 {
+		errs.addf("inputMean", "must have exactly 3 values, got %d", len(cfg.InputMean))
+	}
+	return errs.err("init")
+}
+
+// ValidateOpenConfig checks all the fields of the open parameters
+// and returns an error listing every problem found, if any.
+func ValidateOpenConfig(cfg *OpenConfig) error {
+	var errs validationErrors
+	if len(cfg.SourcesFile) == 0 {
+		errs.checkMandatory("videoSource", cfg.VideoSource)
+	} else {
+		if len(cfg.VideoSource) > 0 {
+			errs.addf("videoSource", "cannot be used with sourcesFile")
+		}
+		if cfg.ShowWindow {
+			errs.addf("showWindow", "cannot be used with sourcesFile")
+		}
+	}
+	errs.checkEnum("captureAPI", cfg.CaptureAPI, validCaptureAPIs)
+	errs.checkNonNegative("captureWidth", cfg.CaptureWidth)
+	errs.checkNonNegative("captureHeight", cfg.CaptureHeight)
+	errs.checkNonNegativeFloat("captureFPS", cfg.CaptureFPS)
+	if cfg.CaptureFourcc != "" && len(cfg.CaptureFourcc) != 4 {
+		errs.addf("captureFourcc", "must be 4 characters long, got %q", cfg.CaptureFourcc)
+	}
+	errs.checkNonNegativeFloat("startOffsetSeconds", cfg.StartOffsetSeconds)
+	if len(cfg.GRPCAddress) > 0 {
+		if _, _, err := net.SplitHostPort(cfg.GRPCAddress); err != nil {
+			errs.addf("grpcAddress", "must be a host:port address, got %q", cfg.GRPCAddress)
+		}
+	}
+	errs.checkNonNegativeFloat("endOffsetSeconds", cfg.EndOffsetSeconds)
+	if cfg.EndOffsetSeconds > 0 && cfg.EndOffsetSeconds <= cfg.StartOffsetSeconds {
+		errs.addf("endOffsetSeconds", "must be greater than startOffsetSeconds")
+	}
+	errs.checkEnum("timestampSource", cfg.TimestampSource, validTimestampSources)
+	errs.checkEnum("eventGranularity", cfg.EventGranularity, validEventGranularities)
+	errs.checkNonNegative("burstFrames", cfg.BurstFrames)
+	errs.checkNonNegative("pollIntervalMillis", cfg.PollIntervalMillis)
+	errs.checkNonNegative("warmupFrames", cfg.WarmupFrames)
+	errs.checkNonNegative("maxRestarts", cfg.MaxRestarts)
+	errs.checkNonNegativeFloat("startupGraceSeconds", cfg.StartupGraceSeconds)
+	errs.checkNonNegative("frameQueueDepth", cfg.FrameQueueDepth)
+	errs.checkNonNegative("snapshotPreRollMillis", cfg.SnapshotPreRollMillis)
+	if len(cfg.SnapshotName) > 0 {
+		if !strings.Contains(cfg.SnapshotName, "{id}") {
+			errs.addf("snapshotName", "must contain the {id} token, to tell snapshots apart")
+		}
+		if strings.ContainsRune(cfg.SnapshotName, '/') {
+			errs.addf("snapshotName", "must be a file name, use snapshotPath for folders")
+		}
+		switch strings.ToLower(filepath.Ext(cfg.SnapshotName)) {
+		case ".png", ".jpg", ".jpeg":
+		default:
+			errs.addf("snapshotName", "must end with .png, .jpg or .jpeg, got %q", cfg.SnapshotName)
+		}
+	}
+	if cfg.SnapshotPaletteSize != 0 {
+		errs.checkRange("snapshotPaletteSize", float64(cfg.SnapshotPaletteSize), 2, 256)
+	}
+	if cfg.SnapshotPalette && len(cfg.SnapshotName) > 0 && strings.ToLower(filepath.Ext(cfg.SnapshotName)) != ".png" {
+		errs.addf("snapshotPalette", "requires a .png snapshotName")
+	}
+	errs.checkNonNegative("minSnapshotIntervalMillis", cfg.MinSnapshotIntervalMillis)
+	errs.checkNonNegative("snapshotBurstCount", cfg.SnapshotBurstCount)
+	errs.checkNonNegative("snapshotBurstSpacingMillis", cfg.SnapshotBurstSpacingMillis)
+	if cfg.SnapshotBurstCount > 1 && cfg.SnapshotBurstSpacingMillis == 0 {
+		errs.addf("snapshotBurstSpacingMillis", "is mandatory when snapshotBurstCount is greater than 1")
+	}
+	errs.checkNonNegativeFloat("bestFrameWindowSeconds", cfg.BestFrameWindowSeconds)
+	if cfg.SingleShot && cfg.BestFrameWindowSeconds > 0 {
+		errs.addf("bestFrameWindowSeconds", "cannot be used with singleShot")
+	}
+	if cfg.SingleShot && cfg.StartupGraceSeconds > 0 {
+		errs.addf("startupGraceSeconds", "cannot be used with singleShot")
+	}
+	errs.checkEnum("embedFormat", cfg.EmbedFormat, validEmbedFormats)
+	errs.checkEnum("boxFormat", cfg.BoxFormat, validBoxFormats)
+	if cfg.EmbedQuality != 0 {
+		errs.checkRange("embedQuality", float64(cfg.EmbedQuality), 1, 100)
+	}
+	if cfg.EmbedFormat == "png" && cfg.EmbedQuality != 0 {
+		errs.addf("embedQuality", "only applies to the jpeg embedFormat")
+	}
+	errs.checkNonNegative("cropPadding", cfg.CropPadding)
+	for name, padding := range cfg.CropPaddingByClass {
+		if !knownCategoryName(name) {
+			errs.addf("cropPaddingByClass", "unknown category %q", name)
+		}
+		errs.checkNonNegative("cropPaddingByClass."+name, padding)
+	}
+	errs.checkNonNegative("eventLogMaxBytes", cfg.EventLogMaxBytes)
+	errs.checkNonNegative("debounceMillis", cfg.DebounceMillis)
+	errs.checkNonNegativeFloat("changeSensitivity", cfg.ChangeSensitivity)
+	errs.checkNonNegative("immediateChangeMagnitude", cfg.ImmediateChangeMagnitude)
+	errs.checkNonNegative("smoothingWindow", cfg.SmoothingWindow)
+	errs.checkNonNegativeFloat("stateRefreshSeconds", cfg.StateRefreshSeconds)
+	errs.checkNonNegative("trailLength", cfg.TrailLength)
+	errs.checkNonNegativeFloat("renderScale", cfg.RenderScale)
+	errs.checkEnum("fontFace", cfg.FontFace, validFontFaces)
+	errs.checkNonNegativeFloat("fontScale", cfg.FontScale)
+	errs.checkNonNegative("fontThickness", cfg.FontThickness)
+	errs.checkNonNegativeFloat("ptzMotionThreshold", cfg.PtzMotionThreshold)
+	errs.checkNonNegative("ptzSettleMillis", cfg.PtzSettleMillis)
+	errs.checkNonNegativeFloat("tamperLuminance", cfg.TamperLuminance)
+	errs.checkNonNegativeFloat("tamperSharpness", cfg.TamperSharpness)
+	errs.checkNonNegativeFloat("tamperSeconds", cfg.TamperSeconds)
+	return errs.err("open")
+}
@@ -0,0 +1,67 @@
+package homesecurity
+
+import (
+	"strings"
+	"testing"
+)
+
+// checkValidation asserts that err reports exactly the given fields
+func checkValidation(t *testing.T, err error, fields []string) {
+	t.Helper()
+	if len(fields) == 0 {
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		return
+	}
+	if err == nil {
+		t.Fatalf("expected errors for %v", fields)
+	}
+	problems := strings.Split(strings.SplitN(err.Error(), ": ", 2)[1], "; ")
+	if len(problems) != len(fields) {
+		t.Errorf("got %d problems, want %d: %s", len(problems), len(fields), err.Error())
+	}
+	for _, field := range fields {
+		if !strings.Contains(err.Error(), field+": ") {
+			t.Errorf("%s is not reported: %s", field, err.Error())
+		}
+	}
+}
+
+func TestValidateDetectionConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    DetectionConfig
+		fields []string
+	}{
+		{"valid", DetectionConfig{Model: "model.pb", NetConfig: "model.pbtxt", MinConfidence: 0.5}, nil},
+		{"missing model", DetectionConfig{NetConfig: "model.pbtxt"}, []string{"model"}},
+		{"unknown alias", DetectionConfig{Model: "model.pb", NetConfig: "model.pbtxt", ClassAliases: map[string]string{"person": "intruder"}},
+			[]string{"classAliases"}},
+		{"all at once", DetectionConfig{MinConfidence: 1.5, Backend: "gpu", MemoryDecayFactor: -1},
+			[]string{"model", "netConfig", "minConfidence", "backend", "memoryDecayFactor"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, ValidateDetectionConfig(&tt.cfg), tt.fields)
+		})
+	}
+}
+
+func TestValidateOpenConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    OpenConfig
+		fields []string
+	}{
+		{"valid", OpenConfig{VideoSource: "/dev/video0"}, nil},
+		{"all at once", OpenConfig{CaptureAPI: "dshow", CaptureWidth: -1, EmbedQuality: 101},
+			[]string{"videoSource", "captureAPI", "captureWidth", "embedQuality"}},
+		{"negative render scale", OpenConfig{VideoSource: "/dev/video0", RenderScale: -1}, []string{"renderScale"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkValidation(t, ValidateOpenConfig(&tt.cfg), tt.fields)
+		})
+	}
+}
@@ -0,0 +1,1609 @@
+// Package homesecurity detects and tracks humans and animals in video
+// sources, producing an event each time the tracked entities change.
+//
+// DetectionConfig describes the model and the tracking, and is shared by
+// all the sessions, while OpenConfig describes a single session, that is
+// started with LaunchVideoDetection. BlobList and PerformBlob can be used
+// on their own, to track the entities found by other means.
+package homesecurity
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nfnt/resize"
+
+	"gocv.io/x/gocv"
+)
+
+// VideoEvent represents the event payload to be serialized
+type VideoEvent struct {
+	// Unique ID of the event, also part of the snapshot file name
+	CorrelationID string
+
+	// Time of the frame the event refers to, see TimestampSource
+	Timestamp time.Time
+
+	VideoSource  string
+	SourceLabel  string
+	Blobs        []Blob
+	SnapshotPath string
+	AsciiImage   string
+
+	// Base64 JPEG or PNG of the snapshot, if embedded
+	SnapshotData string
+
+	// Paths of all the snapshots of a burst, oldest first
+	SnapshotPaths []string
+
+	// Set on the event notifying that the detection has been paused
+	Paused bool
+
+	// Set on the event notifying that a paused detection has been resumed
+	Resumed bool
+
+	// Set on the event notifying that the camera looks covered or defocused
+	Tampered bool
+
+	// Set on the keepalive events sent while nothing happens
+	Idle bool
+
+	// Set on the events periodically sending the current blobs
+	// again, even if nothing changed
+	StateRefresh bool
+
+	// Set on the event notifying that the detection failed, and is
+	// being restarted or, if SourceEnded, has ended
+	Error string
+
+	// Set on the event notifying that a source of a multi-source
+	// session ended, while the other ones keep running
+	SourceEnded bool
+
+	// Set on the event notifying that the number of entities of
+	// CountAlertClass rose to its CountAlerts threshold
+	CountAlert      bool
+	CountAlertClass string
+	CountAlertCount int
+
+	// Zones entered and exited by blobs since the previous event
+	ZoneEnter []ZoneTransition
+	ZoneExit  []ZoneTransition
+
+	// Fraction of the frames sent by the video source that
+	// inference can't keep up with
+	DropRatio float64
+
+	// Set if more than BurstThreshold entities appeared at once
+	// since the previous event
+	Burst bool
+
+	// With per-blob granularity, whether the event notifies that DeltaBlob
+	// has been added or removed, see DeltaAdded and DeltaRemoved
+	DeltaType string
+	DeltaBlob Blob
+
+	// Position of the per-blob event among the ones of the same change:
+	// only the first one carries SnapshotData and AsciiImage
+	DeltaIndex int
+
+	// Changes since the previous event, only set if delta events are enabled
+	Added   []Blob
+	Removed []Blob
+	Updated []Blob
+
+	// Maximum number of concurrent blobs seen since the instance was opened,
+	// both overall and per category
+	PeakBlobs           uint64
+	PeakBlobsByCategory map[CategoryID]uint64
+
+	// Median number of blobs of the recent events,
+	// both overall and per category
+	SmoothedBlobs           uint64
+	SmoothedBlobsByCategory map[CategoryID]uint64
+}
+
+// Types of the per-blob events
+const (
+	DeltaAdded   = "added"
+	DeltaRemoved = "removed"
+)
+
+// splitDelta returns an event for each blob added or removed since the
+// previous event, sharing everything else with the given one but the
+// embedded images, which are only kept by the first event
+func splitDelta(evt VideoEvent, delta BlobDelta) []VideoEvent {
+	var events []VideoEvent
+	add := func(deltaType string, blob Blob) {
+		e := evt
+		e.DeltaType, e.DeltaBlob, e.DeltaIndex = deltaType, blob, len(events)
+		if e.DeltaIndex > 0 {
+			e.SnapshotData, e.AsciiImage = "", ""
+		}
+		events = append(events, e)
+	}
+	for _, blob := range delta.Added {
+		add(DeltaAdded, blob)
+	}
+	for _, blob := range delta.Removed {
+		add(DeltaRemoved, blob)
+	}
+	return events
+}
+
+// ErrDeviceClosed is sent once the video source has no more frames
+var ErrDeviceClosed = errors.New("device has been closed")
+
+const defaultTrailLength = 20
+
+// RenderChan receives the frames to be shown, with the blobs drawn on them
+type RenderChan chan gocv.Mat
+
+// DetectionChan receives the events of a detection session
+type DetectionChan chan VideoEvent
+
+// ErrorChan receives the error ending a detection session,
+// ErrDeviceClosed once the video source has no more frames
+type ErrorChan chan error
+
+// SizeConfidencePoint is a breakpoint of a SizeConfidenceCurve
+type SizeConfidencePoint struct {
+	// Area of the box, as a fraction of the frame area
+	Area float64 `json:"area"`
+
+	MinConfidence float64 `json:"minConfidence"`
+}
+
+// DetectionConfig describes the model and how its detections are tracked
+type DetectionConfig struct {
+	Model     string `json:"model"`
+	NetConfig string `json:"netConfig"`
+
+	// (optional)
+	Backend string `json:"backend"`
+
+	// (optional)
+	Target string `json:"target"`
+
+	// (optional) Additional models run on each frame, whose detections are
+	// combined with the main model ones according to VotingMode.
+	EnsembleModels []EnsembleModel `json:"ensembleModels"`
+
+	// (optional) How the detections of the ensemble models are combined,
+	// between { and, or, confidence-avg }. Defaults to and.
+	VotingMode string `json:"votingMode"`
+
+	// (optional) Number of times loading the model is retried, in case its
+	// files are not available yet.
+	ModelLoadRetries int `json:"modelLoadRetries"`
+
+	// (optional) URL of an HTTP service running the inference in place of
+	// Model, for hosts where OpenCV DNN can't run. Each frame is POSTed as
+	// a JPEG, see remoteDetector for the format of the answer.
+	InferenceServer string `json:"inferenceServer"`
+
+	// (optional) Timeout of each request to InferenceServer. Defaults to 5000.
+	InferenceTimeoutMillis int `json:"inferenceTimeoutMillis"`
+
+	// (optional) Minimum confidence for new detected blobs.
+	MinConfidence float64 `json:"minConfidence"`
+
+	// (optional) At each refresh cycle, blobs are discarded if their confidence goes
+	// below this value.
+	MemoryMinConfidence float64 `json:"memoryMinConfidence"`
+
+	// (optional) At each refresh cycle, the confidence of each blob is reduced by
+	// this factor.
+	MemoryDecayFactor float64 `json:"memoryDecayFactor"`
+
+	// (optional) Decay factors overriding MemoryDecayFactor for some
+	// categories, eg: { "Animal": 0.99 } for entities detected on and off.
+	MemoryDecayFactorByClass map[string]float64 `json:"memoryDecayFactorByClass"`
+
+	// (optional) While searching for near blobs, this is the minimum value required
+	// to consider two blob similars.
+	MemoryNearnessThreshold float64 `json:"memoryNearnessThreshold"`
+
+	// (optional) While merging a new blob with a new one, the new blob should surpass
+	// the condidence of the known blob by this threshold, in order to override
+	// its confidence and class values.
+	MemoryClassSwitchThreshold float64 `json:"memoryClassSwitchThreshold"`
+
+	// (optional) Minimum confidence the new blob must have, regardless of
+	// MemoryClassSwitchThreshold, to switch the class of the known one.
+	MinClassSwitchConfidence float64 `json:"minClassSwitchConfidence"`
+
+	// (optional) Collapses all the near rectangles in a single one
+	MemoryCollapseMultiple bool `json:"memoryCollapseMultiple"`
+
+	// (optional) Number of decimal places of the confidence percentages
+	// shown in annotations and string fields.
+	ConfidenceDecimals int `json:"confidenceDecimals"`
+
+	// (optional) Maximum number of detections kept for each frame, or tile,
+	// the most confident ones, bounding the cost of NMS and tracking.
+	MaxRawDetections int `json:"maxRawDetections"`
+
+	// (optional) How new blobs are matched with the known ones, between
+	// { nearness, hybrid }. Nearness uses MemoryNearnessThreshold, while
+	// hybrid uses the IoU of overlapping boxes and the distance of the
+	// centers of the other ones, up to MaxMatchDistance. Defaults to nearness.
+	MatchStrategy string `json:"matchStrategy"`
+
+	// (optional) Maximum distance, in pixels, between the centers of two
+	// boxes matched by the hybrid strategy. Defaults to 100.
+	MaxMatchDistance int `json:"maxMatchDistance"`
+
+	// (optional) Only matches new blobs with known ones of the same
+	// category, so that overlapping entities of different categories,
+	// like a person walking a dog, are tracked separately.
+	MergeSameClassOnly bool `json:"mergeSameClassOnly"`
+
+	// (optional) Number of consecutive refresh cycles in which a new blob must
+	// be detected before being confirmed and able to trigger events.
+	MinConsecutiveFrames int `json:"minConsecutiveFrames"`
+
+	// (optional) Number of refresh cycles a blob whose confidence decayed
+	// below MemoryMinConfidence is kept, moving at its last velocity, before
+	// being retired, so that briefly occluded entities keep their ID.
+	RetirementGraceFrames int `json:"retirementGraceFrames"`
+
+	// (optional) Makes the minimum confidence of new blobs depend on their
+	// size, interpolating linearly between breakpoints sorted by area.
+	// Overrides MinConfidence.
+	SizeConfidenceCurve []SizeConfidencePoint `json:"sizeConfidenceCurve"`
+
+	// (optional) Blobs tracked for longer than this are retired regardless
+	// of their confidence, to prevent ghost tracks from sticking.
+	MaxBlobAgeSeconds float64 `json:"maxBlobAgeSeconds"`
+
+	// (optional) Non-human blobs that stay stationary for this long, with no
+	// human around, are flagged as abandoned.
+	AbandonedSeconds float64 `json:"abandonedSeconds"`
+
+	// (optional) Radius, in pixels, within which a blob is considered
+	// stationary. Defaults to 20.
+	AbandonedRadius int `json:"abandonedRadius"`
+
+	// (optional) If set, events in which more than this many entities
+	// appeared in a single frame are flagged as bursts.
+	BurstThreshold int `json:"burstThreshold"`
+
+	// (optional) Also counts as a change a known blob moving farther than
+	// PositionChangeThreshold since the previous event, so that entities
+	// walking across the frame keep producing events.
+	EmitOnMovement bool `json:"emitOnMovement"`
+
+	// (optional) Distance, in pixels, the center of a blob must move by
+	// to trigger an event with EmitOnMovement. Defaults to 50.
+	PositionChangeThreshold float64 `json:"positionChangeThreshold"`
+
+	// (optional) Number of entities of each category, eg: { "Human": 3 },
+	// at which an event flagged as a count alert is sent. A category alerts
+	// again only after its count has dropped below the threshold.
+	CountAlerts map[string]int `json:"countAlerts"`
+
+	// (optional) Named polygons, in pixels, whose entering and leaving by
+	// the center of an entity is reported in the events.
+	Zones map[string][]image.Point `json:"zones"`
+
+	// (optional) Camera calibration used to estimate the distance of humans
+	// from the camera, as EstimatedDistanceMeters.
+	Calibration *CameraCalibration `json:"calibration"`
+
+	// (optional) Names given to categories in events, eg: { "Human": "intruder" }.
+	// Only affects what consumers see, not the detection logic.
+	ClassAliases map[string]string `json:"classAliases"`
+
+	// (optional) Among detections of different categories overlapping more
+	// than NmsThreshold, only keeps the highest-confidence one.
+	CrossClassNms bool `json:"crossClassNms"`
+
+	// (optional) Intersection over union above which two detections are
+	// considered overlapping. Defaults to 0.5.
+	NmsThreshold float64 `json:"nmsThreshold"`
+
+	// (optional) Number of class scores attached to each blob, the first
+	// being its own class, followed by the runner-up ones. Defaults to 1.
+	TopClasses int `json:"topClasses"`
+
+	// (optional) Tiled inference: the frame is split in this many rows and
+	// columns of overlapping tiles, each one fed to the network on its own.
+	// Improves the recall of small objects in high resolution frames,
+	// at the cost of a forward pass per tile.
+	TileRows int `json:"tileRows"`
+	TileCols int `json:"tileCols"`
+
+	// (optional) Areas of the frame, in pixels, where known static objects
+	// cause false positives. Detections overlapping any of them more than
+	// IgnoreThreshold are dropped.
+	IgnoreRegions []BlobPosition `json:"ignoreRegions"`
+
+	// (optional) Intersection over union with an ignore region above which
+	// a detection is dropped. Defaults to 0.5.
+	IgnoreThreshold float64 `json:"ignoreThreshold"`
+
+	// (optional) Records the confidence of each blob after each decay, and
+	// logs it when the blob is retired. Useful to tune the memory parameters.
+	DebugDecay bool `json:"debugDecay"`
+
+	// (optional) Runs the detection only once every DetectionInterval frames,
+	// following the detected blobs with OpenCV trackers in between.
+	InterpolateWithTracker bool `json:"interpolateWithTracker"`
+
+	// (optional) Number of recent frames whose detections are cached, keyed
+	// by a hash of their pixels, so that repeated frames skip the inference.
+	DetectionCacheSize int `json:"detectionCacheSize"`
+
+	// (optional) Number of frames between two detections, when interpolating
+	// with trackers. Defaults to 5.
+	DetectionInterval int `json:"detectionInterval"`
+
+	// (optional) Only detect persons, skipping any other category.
+	PersonOnly bool `json:"personOnly"`
+
+	// (optional) Equalizes the luminance of frames before running the detection,
+	// improving the recall in low-light conditions.
+	AutoContrast bool `json:"autoContrast"`
+
+	// (optional) Format of the model outputs, between { ssd, boxes-scores }.
+	// ssd is a single 1x1xNx7 output, boxes-scores are two separate outputs
+	// with the boxes and the class scores. Defaults to ssd.
+	ModelKind string `json:"modelKind"`
+
+	// (optional) Names of the output layers to fetch: the boxes and scores
+	// ones, in this order, for boxes-scores models. Defaults to the
+	// default output of the model.
+	OutputLayers []string `json:"outputLayers"`
+
+	// (optional) Input normalization preset expected by the model, between
+	// { mobilenet, 0-1, imagenet, custom }. Defaults to mobilenet.
+	Normalization string `json:"normalization"`
+
+	// (optional) Overrides the scale factor of the normalization preset.
+	InputScale float64 `json:"inputScale"`
+
+	// (optional) Overrides the per-channel mean of the normalization preset.
+	InputMean []float64 `json:"inputMean"`
+
+	// (optional) Overrides whether the normalization preset swaps the red
+	// and blue channels. Caffe models usually expect BGR frames, so they
+	// need this to be false: a wrong value silently ruins the accuracy.
+	SwapRB *bool `json:"swapRB"`
+
+	// (optional) Center-crops frames to the input aspect ratio, instead of
+	// stretching them, before resizing them for the network.
+	CropInput bool `json:"cropInput"`
+}
+
+// LaunchVideoDetection starts the detection loop in a new goroutine, as
+// Detector.Run does, also sending the frames to be shown.
+// While paused, frames are still read but no detection is performed.
+// The loop is added to wg, and stops once ctx is done.
+func LaunchVideoDetection(ctx context.Context, cfg *DetectionConfig, oCfg *OpenConfig, pause *PauseSwitch, wg *sync.WaitGroup) (DetectionChan, RenderChan, ErrorChan) {
+	d := NewDetector(WithDetectionConfig(cfg), WithOpenConfig(oCfg), WithPauseSwitch(pause), WithWaitGroup(wg))
+	return d.launch(ctx)
+}
+
+// runDetection runs the detection loop until the source ends, the
+// detection fails, or ctx is done
+func runDetection(ctx context.Context, cfg *DetectionConfig, oCfg *OpenConfig, pause *PauseSwitch, detectionChan DetectionChan, renderChan RenderChan, errorChan ErrorChan) {
+	// open capture device (webcam, file, or synthetic source)
+	capture, err := openSource(oCfg)
+	if err != nil {
+		select {
+		case <-ctx.Done():
+		case errorChan <- err:
+		}
+		return
+	}
+	// capture may be wrapped below, always close the outermost source
+	defer func() { capture.Close() }()
+
+	// the positions of file frames are counted from the time the file
+	// is opened, live sources use the wall clock
+	var mediaStart time.Time
+	if oCfg.TimestampSource == "media" && isVideoFile(oCfg.VideoSource) {
+		mediaStart = time.Now()
+	}
+
+	cameraFPS := nominalFPS(capture)
+	if cameraFPS > 0 {
+		fmt.Printf("video source %v sends %.1f fps\n", oCfg.VideoSource, cameraFPS)
+	}
+
+	img := gocv.NewMat()
+	defer img.Close()
+
+	var det detector
+	if pattern, ok := capture.(boxSource); ok {
+		det = newTestPatternDetector(pattern)
+	} else {
+		if len(cfg.InferenceServer) > 0 {
+			det = newRemoteDetector(cfg)
+		} else if len(cfg.EnsembleModels) > 0 {
+			det, err = newEnsembleDetector(cfg)
+		} else {
+			det, err = newNetDetector(cfg)
+		}
+		if err != nil {
+			select {
+			case <-ctx.Done():
+			case errorChan <- err:
+			}
+			return
+		}
+	}
+	if cfg.DetectionCacheSize > 0 {
+		det = newCachingDetector(det, cfg.DetectionCacheSize)
+	}
+	if cfg.InterpolateWithTracker {
+		det = newTrackingDetector(det, cfg.DetectionInterval)
+	}
+	defer det.Close()
+
+	// synthetic sources are not released, as their detector is bound to them
+	if oCfg.BurstFrames > 0 && !isTestPattern(oCfg.VideoSource) {
+		open := func() (frameSource, error) { return openSource(oCfg) }
+		interval := time.Duration(oCfg.PollIntervalMillis) * time.Millisecond
+		capture = newBurstSource(capture, open, oCfg.BurstFrames, interval, oCfg.WarmupFrames, ctx.Done())
+	}
+
+	if err := warmUp(capture, &img, oCfg.WarmupFrames); err != nil {
+		select {
+		case <-ctx.Done():
+		case errorChan <- err:
+		}
+		return
+	}
+
+	if oCfg.FrameQueueDepth > 0 {
+		capture = newQueuedSource(capture, oCfg.FrameQueueDepth, ctx.Done())
+	}
+
+	var frames *frameRing
+	preRoll := time.Duration(oCfg.SnapshotPreRollMillis) * time.Millisecond
+	burstSpacing := time.Duration(oCfg.SnapshotBurstSpacingMillis) * time.Millisecond
+	burstCount := oCfg.SnapshotBurstCount
+	if burstCount < 1 {
+		burstCount = 1
+	}
+	// the ring covers the pre-roll and the whole burst before it
+	ringWindow := preRoll + time.Duration(burstCount-1)*burstSpacing
+	if ringWindow > 0 && (len(oCfg.SnapshotPath) > 0 || oCfg.EmbedSnapshot) {
+		frames = newFrameRing(ringWindow)
+		defer frames.Close()
+	}
+
+	var (
+		blobList    BlobList
+		lastEmitted []Blob
+		paused      bool
+		burst       bool
+		zoneEnter   []ZoneTransition
+		zoneExit    []ZoneTransition
+		fps         fpsMeter
+		started     bool
+		dims        dimsGate
+	)
+	startupGrace := time.Duration(oCfg.StartupGraceSeconds * float64(time.Second))
+	debounce := eventDebouncer{
+		interval:    time.Duration(oCfg.DebounceMillis) * time.Millisecond,
+		sensitivity: oCfg.ChangeSensitivity,
+		immediate:   oCfg.immediateChangeMagnitude(),
+	}
+	if oCfg.ShowTrails {
+		blobList.trailLength = oCfg.TrailLength
+		if blobList.trailLength == 0 {
+			blobList.trailLength = defaultTrailLength
+		}
+	}
+	// a single frame can't be confirmed by the following ones
+	trackCfg := cfg
+	if oCfg.SingleShot && cfg.MinConsecutiveFrames > 0 {
+		c := *cfg
+		c.MinConsecutiveFrames = 0
+		trackCfg = &c
+	}
+	var ptz *ptzSuppressor
+	if oCfg.PtzMotionThreshold > 0 {
+		ptz = newPtzSuppressor(oCfg)
+		defer ptz.Close()
+	}
+	var tamper *tamperDetector
+	if oCfg.TamperDetection && !oCfg.SingleShot {
+		tamper = newTamperDetector(oCfg)
+		defer tamper.Close()
+	}
+	// a single shot ends after its frame, even if no detection ran on it
+	endSingleShot := func() {
+		select {
+		case <-ctx.Done():
+		case errorChan <- ErrDeviceClosed:
+		}
+	}
+	alerter := newCountAlerter(cfg)
+	var dups *duplicateFilter
+	if oCfg.SkipDuplicateFrames {
+		dups = &duplicateFilter{}
+	}
+	var best *bestFrame
+	if oCfg.BestFrameWindowSeconds > 0 {
+		best = newBestFrame(time.Duration(oCfg.BestFrameWindowSeconds * float64(time.Second)))
+		defer best.Close()
+	}
+
+	// snapshots are throttled independently of events
+	minSnapshotInterval := time.Duration(oCfg.MinSnapshotIntervalMillis) * time.Millisecond
+	var lastSnapshot time.Time
+
+	// without events for this long, the current state is sent again
+	stateRefresh := time.Duration(oCfg.StateRefreshSeconds * float64(time.Second))
+	lastEvent := time.Now()
+
+	// Completes the event with what happened since the previous one,
+	// stores its snapshots, and sends it. Returns whether blobs have been
+	// drawn on the current frame, and false if the detection must stop.
+	publish := func(videoEv VideoEvent, shots []snapshotFrame) (bool, bool) {
+		videoEv.Burst = burst
+		videoEv.ZoneEnter, videoEv.ZoneExit = zoneEnter, zoneExit
+		burst = false
+		zoneEnter, zoneExit = nil, nil
+		delta := diffBlobs(lastEmitted, videoEv.Blobs)
+		if oCfg.DeltaEvents {
+			videoEv.Added = delta.Added
+			videoEv.Removed = delta.Removed
+			videoEv.Updated = delta.Updated
+			cfg.nameClasses(videoEv.Added)
+			cfg.nameClasses(videoEv.Removed)
+			cfg.nameClasses(videoEv.Updated)
+		}
+		lastEmitted = videoEv.Blobs
+
+		drawn := false
+		if time.Since(lastSnapshot) < minSnapshotInterval {
+			shots = nil
+		} else if len(shots) > 0 && (len(oCfg.SnapshotPath) > 0 || oCfg.EmbedSnapshot) {
+			lastSnapshot = time.Now()
+		}
+		for i, shot := range shots {
+			if len(oCfg.SnapshotPath) == 0 && !oCfg.EmbedSnapshot {
+				break
+			}
+			// burst frames are told apart by an index suffix
+			id := videoEv.CorrelationID
+			if len(shots) > 1 {
+				id = fmt.Sprintf("%s-%d", id, i+1)
+			}
+			snapshotPath, snapshotData, err := StoreSnapshot(cfg, oCfg, shot.frame, shot.annotate, videoEv.Blobs, id)
+			if err != nil {
+				select {
+				case <-ctx.Done():
+				case errorChan <- fmt.Errorf("failed to store snapshot: %s", err.Error()):
+				}
+				return false, false
+			}
+			// unless working on a copy, blobs have been drawn on the frame
+			drawn = drawn || (shot.annotate && !oCfg.BlurHumans)
+			if oCfg.IncludeSnapshotPath {
+				// the last one is the snapshot of the detection itself
+				videoEv.SnapshotPath = snapshotPath
+				if len(shots) > 1 && len(snapshotPath) > 0 {
+					videoEv.SnapshotPaths = append(videoEv.SnapshotPaths, snapshotPath)
+				}
+			}
+			videoEv.SnapshotData = snapshotData
+		}
+		fitSnapshotData(&videoEv)
+
+		events := []VideoEvent{videoEv}
+		if oCfg.EventGranularity == "per-blob" {
+			if split := splitDelta(videoEv, delta); len(split) > 0 {
+				events = split
+			}
+		}
+		for _, ev := range events {
+			select {
+			case <-ctx.Done():
+				return false, false
+			case detectionChan <- ev:
+			}
+		}
+		lastEvent = time.Now()
+		return drawn, true
+	}
+
+	// Ends the current frame, whether the detection ran on it or not: sends
+	// the best frame and the state refresh once due, then renders the frame.
+	// Returns false if the detection must stop.
+	endFrame := func(frameTime time.Time, blobsDrawn bool) bool {
+		if best.Due(time.Now()) {
+			videoEv, frame := best.Take()
+			if _, ok := publish(videoEv, []snapshotFrame{{frame: frame, annotate: true}}); !ok {
+				return false
+			}
+		}
+		// refreshes tell nothing new, they are not
+		// completed like the other events
+		if stateRefresh > 0 && time.Since(lastEvent) >= stateRefresh {
+			videoEv := VideoEvent{
+				CorrelationID: NewCorrelationID(),
+				Timestamp:     frameTime,
+				VideoSource:   oCfg.VideoSource,
+				SourceLabel:   oCfg.SourceLabel,
+				Blobs:         blobList.Blobs(),
+				DropRatio:     dropRatio(cameraFPS, fps.FPS()),
+				StateRefresh:  true,
+			}
+			cfg.nameClasses(videoEv.Blobs)
+			select {
+			case <-ctx.Done():
+				return false
+			case detectionChan <- videoEv:
+			}
+			lastEvent = time.Now()
+		}
+
+		// a single shot ends right after its event
+		if oCfg.SingleShot {
+			endSingleShot()
+			return false
+		}
+
+		if oCfg.ShowWindow {
+			if !blobsDrawn {
+				DrawBlobs(cfg, oCfg, &img, blobList.Blobs())
+			}
+			if oCfg.ShowTrails {
+				DrawTrails(&img, blobList.Blobs())
+			}
+			select {
+			case <-ctx.Done():
+				return false
+			case renderChan <- img:
+			}
+		}
+		return true
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		if ok := capture.Read(&img); !ok {
+			// don't lose the best frame of the last window
+			if best.Open() {
+				videoEv, frame := best.Take()
+				if _, ok := publish(videoEv, []snapshotFrame{{frame: frame, annotate: true}}); !ok {
+					return
+				}
+			}
+			// a single shot must produce its event
+			err := ErrDeviceClosed
+			if oCfg.SingleShot {
+				err = fmt.Errorf("failed to read the frame of the single shot")
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case errorChan <- err:
+				return
+			}
+		}
+		// empty frames are 0x0 ones, held back by the gate as well
+		if !dims.Ready(&img) {
+			continue
+		}
+		if !started {
+			// the blobs are tracked during the grace period, and
+			// the ones still there when it ends get reported
+			started = true
+			debounce.holdUntil = blobList.clock().Add(startupGrace)
+		}
+		if frames != nil {
+			frames.Push(&img, time.Now())
+		}
+		frameTime := frameTimestamp(capture, mediaStart)
+
+		if pause.Paused() {
+			// notify the pause once, then just keep reading frames
+			// to avoid buffers building up
+			if !paused {
+				paused = true
+				videoEv := VideoEvent{
+					Timestamp:   frameTime,
+					VideoSource: oCfg.VideoSource,
+					SourceLabel: oCfg.SourceLabel,
+					Paused:      true,
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case detectionChan <- videoEv:
+				}
+			}
+			if oCfg.ShowWindow {
+				select {
+				case <-ctx.Done():
+					return
+				case renderChan <- img:
+				}
+			}
+			if oCfg.SingleShot {
+				endSingleShot()
+				return
+			}
+			continue
+		}
+		if paused {
+			paused = false
+			videoEv := VideoEvent{
+				Timestamp:   frameTime,
+				VideoSource: oCfg.VideoSource,
+				SourceLabel: oCfg.SourceLabel,
+				Resumed:     true,
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case detectionChan <- videoEv:
+			}
+		}
+
+		// while the camera moves the whole frame changes, and so would the
+		// detections: just keep reading frames until it settles
+		if ptz != nil && ptz.Moving(&img, time.Now()) {
+			if oCfg.ShowWindow {
+				select {
+				case <-ctx.Done():
+					return
+				case renderChan <- img:
+				}
+			}
+			if oCfg.SingleShot {
+				endSingleShot()
+				return
+			}
+			continue
+		}
+
+		if tamper != nil && tamper.Check(&img, time.Now()) {
+			videoEv := VideoEvent{
+				CorrelationID: NewCorrelationID(),
+				Timestamp:     frameTime,
+				VideoSource:   oCfg.VideoSource,
+				SourceLabel:   oCfg.SourceLabel,
+				Tampered:      true,
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case detectionChan <- videoEv:
+			}
+		}
+
+		// a repeated frame would produce the same detections, and a skipped
+		// one none: the tracked blobs are left as they are
+		if dups != nil && dups.Duplicate(&img) {
+			if !endFrame(frameTime, false) {
+				return
+			}
+			continue
+		}
+
+		detectStart := time.Now()
+		blobs, err := det.Detect(&img)
+		if err == errFrameSkipped {
+			if !endFrame(frameTime, false) {
+				return
+			}
+			continue
+		}
+		if err != nil {
+			select {
+			case <-ctx.Done():
+			case errorChan <- fmt.Errorf("failed to run the detection: %s", err.Error()):
+			}
+			return
+		}
+		fps.Add(time.Since(detectStart))
+		if fps.samples == fpsLogFrames {
+			fmt.Printf("model runs at %.1f fps, video source sends %.1f fps, dropping %.0f%% of frames\n",
+				fps.FPS(), cameraFPS, 100*dropRatio(cameraFPS, fps.FPS()))
+		}
+		blobsDrawn := false
+
+		changed := blobList.Update(blobs, trackCfg)
+		// kept until the next event, as it might be debounced
+		if cfg.BurstThreshold > 0 && blobList.Added() > cfg.BurstThreshold {
+			burst = true
+		}
+		enter, exit := blobList.ZoneTransitions()
+		zoneEnter = append(zoneEnter, enter...)
+		zoneExit = append(zoneExit, exit...)
+		current := blobList.Blobs()
+		for _, alert := range alerter.Check(current) {
+			videoEv := VideoEvent{
+				CorrelationID:   NewCorrelationID(),
+				Timestamp:       frameTime,
+				VideoSource:     oCfg.VideoSource,
+				SourceLabel:     oCfg.SourceLabel,
+				Blobs:           append([]Blob(nil), current...),
+				CountAlert:      true,
+				CountAlertClass: cfg.ClassName(alert.category),
+				CountAlertCount: alert.count,
+			}
+			cfg.nameClasses(videoEv.Blobs)
+			select {
+			case <-ctx.Done():
+				return
+			case detectionChan <- videoEv:
+			}
+		}
+		delta := diffBlobs(lastEmitted, current)
+		var moved []Blob
+		if cfg.EmitOnMovement {
+			moved = movedBlobs(lastEmitted, current, cfg.positionChangeThreshold())
+		}
+		// keep collecting candidates until the best frame window elapses
+		var changes map[CategoryID]int
+		if changed || len(moved) > 0 || oCfg.EmitEveryFrame || oCfg.SingleShot || best.Open() {
+			changes = categoryChanges(delta)
+			for _, blob := range moved {
+				changes[blob.Category]++
+			}
+			if len(changes) == 0 {
+				changes[Unknown] = 0
+			}
+		}
+		// events only sent because every frame is carry no snapshot, as
+		// the ones of unchanged scenes would be written at the frame rate
+		routine := oCfg.EmitEveryFrame && !changed && len(moved) == 0 && len(delta.Added) == 0 &&
+			len(delta.Removed) == 0 && !oCfg.SingleShot && !best.Open()
+		if debounce.Ready(changes, blobList.clock()) {
+			videoEv := VideoEvent{
+				CorrelationID: NewCorrelationID(),
+				Timestamp:     frameTime,
+				VideoSource:   oCfg.VideoSource,
+				SourceLabel:   oCfg.SourceLabel,
+				Blobs:         current,
+				DropRatio:     dropRatio(cameraFPS, fps.FPS()),
+			}
+			cfg.nameClasses(videoEv.Blobs)
+
+			// computed before any annotation is drawn on the frame
+			for i := range videoEv.Blobs {
+				if videoEv.Blobs[i].Category == Human {
+					videoEv.Blobs[i].DominantColor = DominantColor(&img, videoEv.Blobs[i].Position)
+					if cfg.Calibration != nil {
+						videoEv.Blobs[i].EstimatedDistanceMeters = cfg.Calibration.Distance(videoEv.Blobs[i].Position)
+					}
+				}
+			}
+
+			if oCfg.IncludeAsciiImage {
+				aImg, err := renderAscii(&img, oCfg.AsciiColor, debugLogger(oCfg.Debug))
+				if err == nil {
+					videoEv.AsciiImage = aImg
+				} else {
+					fmt.Printf("failed to generate ASCII image: %s", err.Error())
+				}
+			}
+
+			if routine {
+				if _, ok := publish(videoEv, nil); !ok {
+					return
+				}
+			} else if best != nil {
+				best.Offer(videoEv, &img, time.Now())
+			} else {
+				// the burst ends with the usual snapshot
+				now := time.Now()
+				var shots []snapshotFrame
+				for _, at := range burstTimes(now, preRoll, burstSpacing, burstCount) {
+					if at.Equal(now) || frames == nil {
+						shots = append(shots, snapshotFrame{frame: &img, annotate: true})
+					} else {
+						// blobs are not drawn on past frames,
+						// as their positions refer to the current one
+						shots = append(shots, snapshotFrame{frame: frames.At(at)})
+					}
+				}
+				drawn, ok := publish(videoEv, shots)
+				if !ok {
+					return
+				}
+				blobsDrawn = drawn
+			}
+		}
+		if !endFrame(frameTime, blobsDrawn) {
+			return
+		}
+	}
+}
+
+// burstTimes returns the times of the frames of a snapshot burst, spaced
+// apart and ending preRoll before now, from the oldest one
+func burstTimes(now time.Time, preRoll, spacing time.Duration, count int) []time.Time {
+	var times []time.Time
+	for i := count - 1; i >= 0; i-- {
+		times = append(times, now.Add(-preRoll-time.Duration(i)*spacing))
+	}
+	return times
+}
+
+// minConfidenceForArea evaluates the size confidence curve
+// for a box area expressed as a fraction of the frame area
+func (cfg *DetectionConfig) minConfidenceForArea(area float64) float64 {
+	curve := cfg.SizeConfidenceCurve
+	if area <= curve[0].Area {
+		return curve[0].MinConfidence
+	}
+	for i := 1; i < len(curve); i++ {
+		if area <= curve[i].Area {
+			prev, next := curve[i-1], curve[i]
+			ratio := (area - prev.Area) / (next.Area - prev.Area)
+			return prev.MinConfidence + ratio*(next.MinConfidence-prev.MinConfidence)
+		}
+	}
+	return curve[len(curve)-1].MinConfidence
+}
+
+// personClassID is the COCO class id of persons
+const personClassID = 1
+
+const defaultNmsThreshold = 0.5
+
+const defaultIgnoreThreshold = 0.5
+
+const defaultPositionChangeThreshold = 50
+
+// Returns the distance, in pixels, a blob must move by to trigger an event
+func (cfg *DetectionConfig) positionChangeThreshold() float64 {
+	if cfg.PositionChangeThreshold == 0 {
+		return defaultPositionChangeThreshold
+	}
+	return cfg.PositionChangeThreshold
+}
+
+// Returns the decay factor of the blobs of the category
+func (cfg *DetectionConfig) decayFactor(c CategoryID) float64 {
+	for name, factor := range cfg.MemoryDecayFactorByClass {
+		if strings.EqualFold(name, c.String()) {
+			return factor
+		}
+	}
+	return cfg.MemoryDecayFactor
+}
+
+// Returns the name of the category seen by event consumers
+func (cfg *DetectionConfig) ClassName(c CategoryID) string {
+	for name, alias := range cfg.ClassAliases {
+		if strings.EqualFold(name, c.String()) {
+			return alias
+		}
+	}
+	return c.String()
+}
+
+// FormatConfidence formats a confidence as a percentage, with
+// ConfidenceDecimals decimal places, eg: 82%
+func (cfg *DetectionConfig) FormatConfidence(confidence float64) string {
+	return strconv.FormatFloat(confidence*100, 'f', cfg.ConfidenceDecimals, 64) + "%"
+}
+
+// Returns true if the name is either the alias or the
+// original name of the category, ignoring the case
+func (cfg *DetectionConfig) MatchesClass(c CategoryID, name string) bool {
+	return strings.EqualFold(cfg.ClassName(c), name) || strings.EqualFold(c.String(), name)
+}
+
+// Returns true if the category matches a field argument, that is a
+// comma-separated list of class names, each one optionally negated by a
+// leading "!", eg: "human,animal" or "!animal". Unknown names never match.
+func (cfg *DetectionConfig) MatchesClassList(c CategoryID, arg string) bool {
+	included, hasIncluded := false, false
+	for _, name := range strings.Split(arg, ",") {
+		name = strings.TrimSpace(name)
+		if strings.HasPrefix(name, "!") {
+			if cfg.MatchesClass(c, strings.TrimPrefix(name, "!")) {
+				return false
+			}
+			continue
+		}
+		hasIncluded = true
+		if cfg.MatchesClass(c, name) {
+			included = true
+		}
+	}
+	return included || !hasIncluded
+}
+
+// Sets the consumer-facing class name of the blobs
+func (cfg *DetectionConfig) nameClasses(blobs []Blob) {
+	for i := range blobs {
+		blobs[i].Class = cfg.ClassName(blobs[i].Category)
+	}
+}
+
+// Returns true if the position overlaps any of the ignore regions
+func (cfg *DetectionConfig) ignored(pos BlobPosition) bool {
+	threshold := cfg.IgnoreThreshold
+	if threshold == 0 {
+		threshold = defaultIgnoreThreshold
+	}
+	for _, r := range cfg.IgnoreRegions {
+		if pos.IoU(r) > threshold {
+			return true
+		}
+	}
+	return false
+}
+
+// PerformBlob analyzes the results from the detector network,
+// which produces an output blob with a shape 1x1xNx7
+// where N is the number of blobs, and each blob
+// is a vector of float values
+// [batchId, classId, confidence, left, top, right, bottom]
+// Coordinates are normalized to the area of the frame fed to the network.
+// Outputs of any other shape or type are reported as errors.
+func PerformBlob(frame *gocv.Mat, area image.Rectangle, results gocv.Mat, cfg *DetectionConfig) ([]Blob, error) {
+	if results.Type() != gocv.MatTypeCV32F {
+		return nil, fmt.Errorf("malformed network output: expected float values, got type %v", results.Type())
+	}
+	if results.Total()%detectionStride != 0 {
+		return nil, fmt.Errorf("malformed network output: %d values are not a multiple of %d", results.Total(), detectionStride)
+	}
+
+	// fraction of the frame covered by the area
+	areaFraction := float64(area.Dx()*area.Dy()) / float64(frame.Cols()*frame.Rows())
+
+	var (
+		blobs      []Blob
+		candidates []scoredPosition
+	)
+	for i := 0; i < results.Total(); i += detectionStride {
+		confidence := results.GetFloatAt(0, i+2)
+		if cfg.TopClasses > 1 {
+			// any detection may be the runner-up class of a blob
+			if c := ParseClassID(int(results.GetFloatAt(0, i+1))); c.Known() {
+				candidates = append(candidates, scoredPosition{
+					ClassScore: ClassScore{Category: c, Confidence: float64(confidence)},
+					pos:        resultPosition(results, i, area),
+				})
+			}
+		}
+		minConfidence := cfg.MinConfidence
+		if len(cfg.SizeConfidenceCurve) > 0 {
+			// coordinates are normalized, so is the area
+			w := results.GetFloatAt(0, i+5) - results.GetFloatAt(0, i+3)
+			h := results.GetFloatAt(0, i+6) - results.GetFloatAt(0, i+4)
+			minConfidence = cfg.minConfidenceForArea(float64(w*h) * areaFraction)
+		}
+		if float64(confidence) > minConfidence {
+			classId := int(results.GetFloatAt(0, i+1))
+
+			var c CategoryID
+			if cfg.PersonOnly {
+				// fast path, no need to look up category ranges
+				if classId != personClassID {
+					continue
+				}
+				c = Human
+			} else {
+				c = ParseClassID(classId)
+				if !c.Known() {
+					continue
+				}
+			}
+
+			pos := resultPosition(results, i, area)
+			if cfg.ignored(pos) {
+				continue
+			}
+			blobs = append(blobs, Blob{
+				Category:   c,
+				Confidence: float64(confidence),
+				Position:   pos,
+			})
+		}
+	}
+	if cfg.MaxRawDetections > 0 && len(blobs) > cfg.MaxRawDetections {
+		sort.SliceStable(blobs, func(i, j int) bool {
+			return blobs[i].Confidence > blobs[j].Confidence
+		})
+		blobs = blobs[:cfg.MaxRawDetections]
+	}
+	for i := range blobs {
+		blobs[i].Scores = topScores(blobs[i], candidates, cfg.TopClasses)
+	}
+	if cfg.CrossClassNms {
+		threshold := cfg.NmsThreshold
+		if threshold == 0 {
+			threshold = defaultNmsThreshold
+		}
+		blobs = suppressOverlaps(blobs, threshold)
+	}
+	return blobs, nil
+}
+
+// number of values of each detection in the network output
+const detectionStride = 7
+
+// Returns the position of the i-th result, in pixels of the frame
+func resultPosition(results gocv.Mat, i int, area image.Rectangle) BlobPosition {
+	return BlobPosition{
+		Left:   area.Min.X + int(results.GetFloatAt(0, i+3)*float32(area.Dx())),
+		Top:    area.Min.Y + int(results.GetFloatAt(0, i+4)*float32(area.Dy())),
+		Right:  area.Min.X + int(results.GetFloatAt(0, i+5)*float32(area.Dx())),
+		Bottom: area.Min.Y + int(results.GetFloatAt(0, i+6)*float32(area.Dy())),
+	}
+}
+
+type scoredPosition struct {
+	ClassScore
+	pos BlobPosition
+}
+
+// Returns the k best class scores of the blob. SSD models report a single
+// class per detection, so the runner-up classes are the ones detected over
+// the same box, that is overlapping more than defaultNmsThreshold.
+func topScores(blob Blob, candidates []scoredPosition, k int) []ClassScore {
+	if k < 1 {
+		k = 1
+	}
+	scores := []ClassScore{{Category: blob.Category, Confidence: blob.Confidence}}
+	best := make(map[CategoryID]int)
+	for _, c := range candidates {
+		if c.Category == blob.Category || blob.Position.IoU(c.pos) <= defaultNmsThreshold {
+			continue
+		}
+		if i, ok := best[c.Category]; ok {
+			if c.Confidence > scores[i].Confidence {
+				scores[i].Confidence = c.Confidence
+			}
+			continue
+		}
+		best[c.Category] = len(scores)
+		scores = append(scores, c.ClassScore)
+	}
+	sort.SliceStable(scores[1:], func(i, j int) bool {
+		return scores[i+1].Confidence > scores[j+1].Confidence
+	})
+	if len(scores) > k {
+		scores = scores[:k]
+	}
+	return scores
+}
+
+func GenerateAsciiImage(img *gocv.Mat) (string, error) {
+	return asciiImage(img, false, false)
+}
+
+// renderAscii generates the ASCII image of the events, replaced by tests
+var renderAscii = asciiImage
+
+// asciiImage generates the ASCII image from the YUV conversion of the frame,
+// falling back to the RGBA one of an 8-bit copy for the Mat types, like
+// 16-bit or float ones, the conversions don't support.
+// If ansi is true, each character is colored as its pixel.
+func asciiImage(img *gocv.Mat, ansi bool, debug debugLogger) (string, error) {
+	var goImg image.Image
+	goImg, err := img.ToImageYUV()
+	if err != nil {
+		debug.Printf("YUV conversion failed, falling back to RGBA: %s", err.Error())
+		eightBit := gocv.NewMat()
+		defer eightBit.Close()
+		gocv.Normalize(*img, &eightBit, 0, 255, gocv.NormMinMax)
+		eightBit.ConvertTo(&eightBit, gocv.MatTypeCV8U)
+		if goImg, err = eightBit.ToImage(); err != nil {
+			return "", err
+		}
+	}
+	scaled, w, h := ScaleImage(goImg, 80)
+	if ansi {
+		return string(convert2AnsiAscii(scaled, w, h)), nil
+	}
+	return string(Convert2Ascii(scaled, w, h)), nil
+}
+
+// labels are never shrunk below this font scale, they get truncated instead
+const minLabelScale = 0.5
+
+// fitLabel returns the text and font scale to be used to draw a label
+// no wider than width, as measured by textWidth: the font is shrunk first,
+// then the text is truncated. The text is empty if not even its first
+// letter fits, so that no label overflows the box.
+func fitLabel(text string, width int, scale float64, textWidth func(text string, scale float64) int) (string, float64) {
+	if len(text) == 0 || width <= 0 {
+		return "", scale
+	}
+	size := textWidth(text, scale)
+	if size <= width {
+		return text, scale
+	}
+	if fitScale := scale * float64(width) / float64(size); fitScale >= minLabelScale {
+		return text, fitScale
+	}
+	for n := len(text) - 1; n > 0; n-- {
+		truncated := text[:n] + "."
+		if textWidth(truncated, minLabelScale) <= width {
+			return truncated, minLabelScale
+		}
+	}
+	if textWidth(text[:1], minLabelScale) <= width {
+		return text[:1], minLabelScale
+	}
+	return "", minLabelScale
+}
+
+var fontFaces = map[string]gocv.HersheyFont{
+	"plain":   gocv.FontHersheyPlain,
+	"simplex": gocv.FontHersheySimplex,
+	"duplex":  gocv.FontHersheyDuplex,
+	"complex": gocv.FontHersheyComplex,
+	"triplex": gocv.FontHersheyTriplex,
+}
+
+// Returns the font, scale and thickness of the annotations
+func (oCfg *OpenConfig) annotationFont() (gocv.HersheyFont, float64, int) {
+	font, ok := fontFaces[oCfg.FontFace]
+	if !ok {
+		font = gocv.FontHersheyPlain
+	}
+	scale := oCfg.FontScale
+	if scale == 0 {
+		scale = 1.0
+	}
+	thickness := oCfg.FontThickness
+	if thickness == 0 {
+		thickness = 2
+	}
+	return font, scale, thickness
+}
+
+// DrawBlobs draws the box of each blob, along with a summary
+// of all of them, using the annotation font of the config
+func DrawBlobs(cfg *DetectionConfig, oCfg *OpenConfig, frame *gocv.Mat, blobs []Blob) {
+	font, fontScale, thickness := oCfg.annotationFont()
+	// box labels are thinner, as they are smaller
+	labelThickness := maxInt(1, thickness/2)
+	textWidth := func(text string, scale float64) int {
+		return gocv.GetTextSize(text, font, scale, labelThickness).X
+	}
+	for i, d := range blobs {
+		status := fmt.Sprintf("type: %v, confidence: %v", d.Category.String(), cfg.FormatConfidence(d.Confidence))
+		gocv.PutText(frame, status, image.Pt(10, int(20*fontScale)*(len(blobs)-i)), font, fontScale, d.Color(), thickness)
+		gocv.Rectangle(frame, image.Rect(d.Position.Left, d.Position.Top, d.Position.Right, d.Position.Bottom), d.Color(), thickness)
+
+		// label the box itself, fitting it to the box width
+		label, scale := fitLabel(d.Category.String(), d.Position.Right-d.Position.Left, fontScale, textWidth)
+		if len(label) > 0 {
+			gocv.PutText(frame, label, image.Pt(d.Position.Left+2, d.Position.Top+int(16*scale)), font, scale, d.Color(), labelThickness)
+		}
+	}
+}
+
+// BlurHumans blurs the head region, that is the top third of the box,
+// of each human blob
+func BlurHumans(frame *gocv.Mat, blobs []Blob) {
+	bounds := image.Rect(0, 0, frame.Cols(), frame.Rows())
+	for _, d := range blobs {
+		if d.Category != Human {
+			continue
+		}
+		height := (d.Position.Bottom - d.Position.Top) / 3
+		head := image.Rect(d.Position.Left, d.Position.Top, d.Position.Right, d.Position.Top+height).Intersect(bounds)
+		if head.Empty() {
+			continue
+		}
+		// kernel size must be odd
+		k := maxInt(head.Dx()/4, 3) | 1
+		region := frame.Region(head)
+		gocv.GaussianBlur(region, &region, image.Pt(k, k), 0, 0, gocv.BorderDefault)
+		region.Close()
+	}
+}
+
+// DrawTrails draws the recent path of each blob, fading out the older segments
+func DrawTrails(frame *gocv.Mat, blobs []Blob) {
+	for _, d := range blobs {
+		trail := d.Trail()
+		c := d.Color()
+		for i := 1; i < len(trail); i++ {
+			fade := float64(i) / float64(len(trail)-1)
+			faded := color.RGBA{
+				R: uint8(float64(c.R) * fade),
+				G: uint8(float64(c.G) * fade),
+				B: uint8(float64(c.B) * fade),
+			}
+			gocv.Line(frame, image.Pt(trail[i-1].x, trail[i-1].y), image.Pt(trail[i].x, trail[i].y), faded, 2)
+		}
+	}
+}
+
+// snapshotFrame is a frame to store as snapshot, and whether
+// the blobs positions refer to it, so that they can be drawn
+type snapshotFrame struct {
+	frame    *gocv.Mat
+	annotate bool
+}
+
+// default padding around blobs when cropping snapshots
+const defaultCropPadding = 20
+
+// CropRect returns the area containing all the blobs, each one padded
+// according to its category, clamped to the frame bounds
+func CropRect(oCfg *OpenConfig, blobs []Blob, bounds image.Rectangle) image.Rectangle {
+	var crop image.Rectangle
+	for _, b := range blobs {
+		padding := oCfg.CropPadding
+		if padding == 0 {
+			padding = defaultCropPadding
+		}
+		for name, p := range oCfg.CropPaddingByClass {
+			if strings.EqualFold(name, b.Category.String()) {
+				padding = p
+			}
+		}
+		box := image.Rect(b.Position.Left, b.Position.Top, b.Position.Right, b.Position.Bottom).Inset(-padding)
+		crop = crop.Union(box)
+	}
+	return crop.Intersect(bounds)
+}
+
+// maximum size of an encoded event embedding a snapshot, that is the
+// default event size of the plugin framework, leaving room for the
+// smoothed counts added by the plugin
+const maxEmbeddingEventSize = 256*1024 - 4*1024
+
+// Drops the embedded snapshot if the encoded event would not fit in
+// maxEmbeddingEventSize, as the whole event has to
+func fitSnapshotData(videoEv *VideoEvent) {
+	if len(videoEv.SnapshotData) == 0 {
+		return
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(videoEv); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to measure event, skipping embedded snapshot: %s\n", err.Error())
+		videoEv.SnapshotData = ""
+	} else if buf.Len() > maxEmbeddingEventSize {
+		fmt.Fprintf(os.Stderr, "snapshot too big to be embedded (event of %d bytes), skipping it\n", buf.Len())
+		videoEv.SnapshotData = ""
+	}
+}
+
+// StoreSnapshot writes the snapshot of a frame for the given blobs,
+// optionally annotated, and returns its path. If embedding snapshots,
+// it also returns the base64 image of the snapshot.
+func StoreSnapshot(cfg *DetectionConfig, oCfg *OpenConfig, frame *gocv.Mat, annotate bool, blobs []Blob, id string) (string, string, error) {
+	snapshot := frame
+	if oCfg.BlurHumans {
+		// blur a copy, leaving the detection pipeline untouched
+		blurred := frame.Clone()
+		defer blurred.Close()
+		BlurHumans(&blurred, blobs)
+		snapshot = &blurred
+	}
+	if annotate {
+		DrawBlobs(cfg, oCfg, snapshot, blobs)
+	}
+	if oCfg.CropSnapshots && len(blobs) > 0 {
+		rect := CropRect(oCfg, blobs, image.Rect(0, 0, snapshot.Cols(), snapshot.Rows()))
+		if !rect.Empty() {
+			cropped := snapshot.Region(rect)
+			defer cropped.Close()
+			snapshot = &cropped
+		}
+	}
+
+	var data string
+	if oCfg.EmbedSnapshot {
+		var err error
+		if data, err = EncodeSnapshot(oCfg, snapshot); err != nil {
+			return "", "", err
+		}
+	}
+
+	if len(oCfg.SnapshotPath) == 0 {
+		return "", data, nil
+	}
+	dir := SnapshotDir(oCfg, blobs, id)
+	path := dir + "/" + GetImageFileName(oCfg, blobs, id)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", "", err
+	}
+	if oCfg.SnapshotPalette {
+		if err := writePalettedPNG(path, snapshot, oCfg.paletteSize()); err != nil {
+			return "", "", fmt.Errorf("could not write image %s: %s", path, err.Error())
+		}
+	} else if !gocv.IMWrite(path, *snapshot) {
+		return "", "", fmt.Errorf("could not write image %s", path)
+	}
+	return path, data, nil
+}
+
+const defaultEmbedQuality = 95
+
+// EncodeSnapshot returns the frame as a base64 image, in the
+// embedded snapshot format of the open config
+func EncodeSnapshot(oCfg *OpenConfig, frame *gocv.Mat) (string, error) {
+	var (
+		buf *gocv.NativeByteBuffer
+		err error
+	)
+	if oCfg.EmbedFormat == "png" {
+		buf, err = gocv.IMEncode(gocv.PNGFileExt, *frame)
+	} else {
+		quality := oCfg.EmbedQuality
+		if quality == 0 {
+			quality = defaultEmbedQuality
+		}
+		buf, err = gocv.IMEncodeWithParams(gocv.JPEGFileExt, *frame, []int{gocv.IMWriteJpegQuality, quality})
+	}
+	if err != nil {
+		return "", err
+	}
+	defer buf.Close()
+	return base64.StdEncoding.EncodeToString(buf.GetBytes()), nil
+}
+
+// PrepareSnapshotPath makes sure that the snapshot folder exists
+// and is writable, creating it if needed. For templates, only the
+// folder preceding the first token is checked.
+func PrepareSnapshotPath(path string) error {
+	path = templateRoot(path)
+	if err := os.MkdirAll(path, os.ModePerm); err != nil {
+		return fmt.Errorf("snapshotPath: cannot create folder: %s", err.Error())
+	}
+	f, err := os.CreateTemp(path, ".write-check-*")
+	if err != nil {
+		return fmt.Errorf("snapshotPath: folder is not writable: %s", err.Error())
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// SnapshotDir returns the folder where to store the snapshot of the given
+// blobs, expanding the tokens of SnapshotPath
+func SnapshotDir(oCfg *OpenConfig, blobs []Blob, id string) string {
+	vars := snapshotVars(oCfg, blobs, id)
+	dir := expandPathTemplate(oCfg.SnapshotPath, vars)
+	if !oCfg.SnapshotByCategory || len(vars.Class) == 0 {
+		return dir
+	}
+	return filepath.Join(dir, vars.Class)
+}
+
+const defaultSnapshotName = "Falco-{time}-{source}-{id}.png"
+
+// GetImageFileName returns the file name of the snapshot of the given
+// blobs, expanding the tokens of SnapshotName. The source and the ID
+// keep apart the snapshots taken at the same time by different sources.
+func GetImageFileName(oCfg *OpenConfig, blobs []Blob, id string) string {
+	name := oCfg.SnapshotName
+	if len(name) == 0 {
+		name = defaultSnapshotName
+	}
+	return expandPathTemplate(name, snapshotVars(oCfg, blobs, id))
+}
+
+// snapshotVars returns the values of the path tokens for the snapshot
+// of the given blobs; the class of the snapshot is the one of the
+// highest-confidence blob
+func snapshotVars(oCfg *OpenConfig, blobs []Blob, id string) pathVars {
+	source := oCfg.SourceLabel
+	if len(source) == 0 {
+		source = oCfg.VideoSource
+	}
+	class := ""
+	if len(blobs) > 0 {
+		best := blobs[0]
+		for _, b := range blobs[1:] {
+			if b.Confidence > best.Confidence {
+				best = b
+			}
+		}
+		class = strings.ToLower(best.Category.String())
+	}
+	return pathVars{
+		Source: source,
+		Class:  class,
+		ID:     id,
+		Time:   time.Now(),
+	}
+}
+
+// NewCorrelationID returns a random UUID (version 4)
+func NewCorrelationID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// only happens if the system entropy source is broken
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// ShowFrame shows the frame in the window, resized by the given scale
+func ShowFrame(window *gocv.Window, img gocv.Mat, scale float64) {
+	if scale <= 0 || scale == 1 {
+		window.IMShow(img)
+		return
+	}
+	resized := gocv.NewMat()
+	defer resized.Close()
+	ResizeFrame(img, &resized, scale)
+	window.IMShow(resized)
+}
+
+// ResizeFrame resizes the frame by the given scale, picking
+// the interpolation that looks best in each direction
+func ResizeFrame(img gocv.Mat, dst *gocv.Mat, scale float64) {
+	interpolation := gocv.InterpolationLinear
+	if scale < 1 {
+		interpolation = gocv.InterpolationArea
+	}
+	gocv.Resize(img, dst, image.Point{}, scale, scale, interpolation)
+}
+
+func ScaleImage(img image.Image, w int) (image.Image, int, int) {
+	sz := img.Bounds()
+	h := (sz.Max.Y * w * 10) / (sz.Max.X * 16)
+	img = resize.Resize(uint(w), uint(h), img, resize.Lanczos3)
+	return img, w, h
+}
+
+const asciiChars = "@%#*+=-:. "
+
+// asciiChar returns the character of the pixel, according to its luminance
+func asciiChar(c color.Color) byte {
+	y := color.GrayModel.Convert(c).(color.Gray).Y
+	return asciiChars[int(y)*(len(asciiChars)-1)/255]
+}
+
+func Convert2Ascii(img image.Image, w, h int) []byte {
+	buf := new(bytes.Buffer)
+
+	for i := 0; i < h; i++ {
+		for j := 0; j < w; j++ {
+			_ = buf.WriteByte(asciiChar(img.At(j, i)))
+		}
+		_ = buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// convert2AnsiAscii is like Convert2Ascii, but each character is
+// preceded by the ANSI truecolor escape sequence of its pixel
+func convert2AnsiAscii(img image.Image, w, h int) []byte {
+	buf := new(bytes.Buffer)
+
+	for i := 0; i < h; i++ {
+		for j := 0; j < w; j++ {
+			c := img.At(j, i)
+			r, g, b, _ := c.RGBA()
+			fmt.Fprintf(buf, "\x1b[38;2;%d;%d;%dm%c", r>>8, g>>8, b>>8, asciiChar(c))
+		}
+		_, _ = buf.WriteString("\x1b[0m\n")
+	}
+	return buf.Bytes()
+}
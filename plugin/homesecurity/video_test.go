@@ -0,0 +1,1041 @@
+package homesecurity
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// runTestPattern runs the pipeline on the synthetic source until n events
+// are received, and returns them
+func runTestPattern(t *testing.T, cfg *DetectionConfig, oCfg *OpenConfig, n int) []VideoEvent {
+	t.Helper()
+	oCfg.VideoSource = testPatternSource
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	d := NewDetector(WithDetectionConfig(cfg), WithOpenConfig(oCfg))
+	detectionc, errorc := d.Run(ctx)
+	// wait for the loop to end, the channels get closed then
+	defer func() {
+		cancel()
+		for range detectionc {
+		}
+	}()
+
+	var events []VideoEvent
+	for len(events) < n {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("got %d events, want %d", len(events), n)
+		case err := <-errorc:
+			t.Fatalf("detection ended: %v", err)
+		case evt := <-detectionc:
+			events = append(events, evt)
+		}
+	}
+	return events
+}
+
+func TestTestPatternPipeline(t *testing.T) {
+	events := runTestPattern(t, testTrackConfig(), &OpenConfig{EmitEveryFrame: true}, 5)
+	prev := -1
+	for i, evt := range events {
+		if len(evt.Blobs) != 1 {
+			t.Fatalf("event %d: got %d blobs, want 1", i, len(evt.Blobs))
+		}
+		left := evt.Blobs[0].Position.Left
+		if left <= prev {
+			t.Errorf("event %d: blob at %d, not past %d", i, left, prev)
+		}
+		prev = left
+	}
+}
+
+func TestEmitEveryFrameSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	oCfg := &OpenConfig{EmitEveryFrame: true, SnapshotPath: dir, IncludeSnapshotPath: true}
+	events := runTestPattern(t, testTrackConfig(), oCfg, 5)
+	// only the event of the box appearing has a snapshot
+	for i, evt := range events {
+		if has := len(evt.SnapshotPath) > 0; has != (i == 0) {
+			t.Errorf("event %d: got snapshot %q", i, evt.SnapshotPath)
+		}
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.png")); len(files) != 1 {
+		t.Errorf("got snapshots %v, want a single one", files)
+	}
+}
+
+func TestSnapshotBurstFiles(t *testing.T) {
+	dir := t.TempDir()
+	oCfg := &OpenConfig{SnapshotPath: dir, IncludeSnapshotPath: true, SnapshotBurstCount: 3, SnapshotBurstSpacingMillis: 50}
+	evt := runTestPattern(t, testTrackConfig(), oCfg, 1)[0]
+	if len(evt.SnapshotPaths) != 3 {
+		t.Fatalf("got snapshots %v, want 3", evt.SnapshotPaths)
+	}
+	for i, path := range evt.SnapshotPaths {
+		if suffix := fmt.Sprintf("-%d.png", i+1); !strings.HasSuffix(path, suffix) {
+			t.Errorf("snapshot %s has no %s suffix", path, suffix)
+		}
+		if _, err := os.Stat(path); err != nil {
+			t.Error(err)
+		}
+	}
+	if evt.SnapshotPath != evt.SnapshotPaths[2] {
+		t.Errorf("got snapshot %s, want the last of the burst", evt.SnapshotPath)
+	}
+}
+
+func TestMinSnapshotInterval(t *testing.T) {
+	dir := t.TempDir()
+	cfg := testTrackConfig()
+	// the box moves at each frame, and so each frame is an event
+	cfg.EmitOnMovement = true
+	cfg.PositionChangeThreshold = 1
+	oCfg := &OpenConfig{SnapshotPath: dir, IncludeSnapshotPath: true, MinSnapshotIntervalMillis: 60000}
+	events := runTestPattern(t, cfg, oCfg, 5)
+	for i, evt := range events {
+		if has := len(evt.SnapshotPath) > 0; has != (i == 0) {
+			t.Errorf("event %d: got snapshot %q", i, evt.SnapshotPath)
+		}
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.png")); len(files) != 1 {
+		t.Errorf("got snapshots %v, want a single one", files)
+	}
+}
+
+func TestIncludeAsciiImage(t *testing.T) {
+	defer func(render func(*gocv.Mat, bool, debugLogger) (string, error)) {
+		renderAscii = render
+	}(renderAscii)
+	var calls int32
+	renderAscii = func(img *gocv.Mat, ansi bool, debug debugLogger) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		return asciiImage(img, ansi, debug)
+	}
+
+	tests := []struct {
+		include bool
+		want    bool
+	}{
+		{false, false},
+		{true, true},
+	}
+	for _, tt := range tests {
+		atomic.StoreInt32(&calls, 0)
+		events := runTestPattern(t, testTrackConfig(), &OpenConfig{EmitEveryFrame: true, IncludeAsciiImage: tt.include}, 2)
+		if got := atomic.LoadInt32(&calls) > 0; got != tt.want {
+			t.Errorf("include %v: ASCII image generated %v, want %v", tt.include, got, tt.want)
+		}
+		for _, evt := range events {
+			if got := len(evt.AsciiImage) > 0; got != tt.want {
+				t.Errorf("include %v: event has ASCII image %v, want %v", tt.include, got, tt.want)
+			}
+		}
+	}
+}
+
+// testResults returns a network output holding the given detections, as
+// [batchId, classId, confidence, left, top, right, bottom] values
+func testResults(detections ...[detectionStride]float32) gocv.Mat {
+	results := gocv.NewMatWithSize(1, len(detections)*detectionStride, gocv.MatTypeCV32F)
+	for i, det := range detections {
+		for j, v := range det {
+			results.SetFloatAt(0, i*detectionStride+j, v)
+		}
+	}
+	return results
+}
+
+func TestPerformBlobPersonOnly(t *testing.T) {
+	frame := gocv.NewMatWithSize(300, 400, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+	results := testResults(
+		[detectionStride]float32{0, personClassID, 0.9, 0.1, 0.1, 0.3, 0.6},
+		[detectionStride]float32{0, 18, 0.9, 0.5, 0.5, 0.7, 0.8}, // dog
+		[detectionStride]float32{0, 3, 0.9, 0.6, 0.1, 0.9, 0.4},  // car
+	)
+	defer results.Close()
+
+	tests := []struct {
+		personOnly bool
+		want       []CategoryID
+	}{
+		{false, []CategoryID{Human, Animal}},
+		{true, []CategoryID{Human}},
+	}
+	for _, tt := range tests {
+		cfg := &DetectionConfig{MinConfidence: 0.5, PersonOnly: tt.personOnly}
+		blobs, err := PerformBlob(&frame, image.Rect(0, 0, 400, 300), results, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(blobs) != len(tt.want) {
+			t.Fatalf("personOnly %v: got %d blobs, want %d", tt.personOnly, len(blobs), len(tt.want))
+		}
+		for i, c := range tt.want {
+			if blobs[i].Category != c {
+				t.Errorf("personOnly %v: blob %d is %s, want %s", tt.personOnly, i, blobs[i].Category, c)
+			}
+		}
+	}
+}
+
+func TestPerformBlobIgnoreRegions(t *testing.T) {
+	frame := gocv.NewMatWithSize(300, 400, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+	results := testResults(
+		[detectionStride]float32{0, 3, 0.9, 0.6, 0.1, 0.9, 0.4},  // parked car
+		[detectionStride]float32{0, 3, 0.9, 0.3, 0.1, 0.55, 0.4}, // car next to it
+	)
+	defer results.Close()
+
+	cfg := &DetectionConfig{
+		MinConfidence: 0.5,
+		IgnoreRegions: []BlobPosition{{Left: 240, Top: 30, Right: 360, Bottom: 120}},
+	}
+	blobs, err := PerformBlob(&frame, image.Rect(0, 0, 400, 300), results, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blobs) != 1 {
+		t.Fatalf("got %d blobs, want 1", len(blobs))
+	}
+	if pos := blobs[0].Position; pos.Left != 120 || pos.Right != 220 {
+		t.Errorf("got blob at %+v, want the one outside the ignore region", pos)
+	}
+}
+
+func TestMaxRawDetections(t *testing.T) {
+	frame := gocv.NewMatWithSize(300, 400, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+	// a grid of people not overlapping each other, from the least confident
+	var detections [][detectionStride]float32
+	for i := 0; i < 40; i++ {
+		left, top := float32(i%10)*0.1, float32(i/10)*0.25
+		detections = append(detections, [detectionStride]float32{0, 1, 0.55 + float32(i)*0.01, left, top, left + 0.05, top + 0.2})
+	}
+	results := testResults(detections...)
+	defer results.Close()
+
+	tests := []struct {
+		max, want int
+	}{
+		{0, 40},
+		{5, 5},
+		{100, 40},
+	}
+	for _, tt := range tests {
+		cfg := &DetectionConfig{MinConfidence: 0.5, MaxRawDetections: tt.max}
+		blobs, err := PerformBlob(&frame, image.Rect(0, 0, 400, 300), results, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(blobs) != tt.want {
+			t.Fatalf("max %d: got %d blobs, want %d", tt.max, len(blobs), tt.want)
+		}
+		for _, blob := range blobs {
+			if min := 0.55 + float64(40-tt.want)*0.01; blob.Confidence < min-0.001 {
+				t.Errorf("max %d: kept a blob with confidence %f, below the top ones", tt.max, blob.Confidence)
+			}
+		}
+	}
+}
+
+func TestPerformBlobMalformedOutput(t *testing.T) {
+	frame := gocv.NewMatWithSize(300, 400, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+	tests := []struct {
+		total     int
+		typ       gocv.MatType
+		malformed bool
+	}{
+		{detectionStride * 2, gocv.MatTypeCV32F, false},
+		{detectionStride + 3, gocv.MatTypeCV32F, true},
+		{detectionStride - 1, gocv.MatTypeCV32F, true},
+		{detectionStride * 2, gocv.MatTypeCV8U, true},
+	}
+	for _, tt := range tests {
+		results := gocv.NewMatWithSize(1, tt.total, tt.typ)
+		_, err := PerformBlob(&frame, image.Rect(0, 0, 400, 300), results, &DetectionConfig{MinConfidence: 0.5})
+		results.Close()
+		if malformed := err != nil && strings.Contains(err.Error(), "malformed network output"); malformed != tt.malformed {
+			t.Errorf("%d values: got error %v, want malformed %v", tt.total, err, tt.malformed)
+		}
+	}
+}
+
+func BenchmarkPerformBlob(b *testing.B) {
+	frame := gocv.NewMatWithSize(300, 400, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+	// a crowded scene, as returned by SSD models
+	var detections [][detectionStride]float32
+	for i := 0; i < 100; i++ {
+		detections = append(detections, [detectionStride]float32{0, float32(1 + i%90), 0.9, 0.1, 0.1, 0.3, 0.6})
+	}
+	results := testResults(detections...)
+	defer results.Close()
+
+	for _, personOnly := range []bool{false, true} {
+		name := "all"
+		if personOnly {
+			name = "personOnly"
+		}
+		cfg := &DetectionConfig{MinConfidence: 0.5, PersonOnly: personOnly}
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := PerformBlob(&frame, image.Rect(0, 0, 400, 300), results, cfg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestFitLabel(t *testing.T) {
+	// each letter is 10 pixels wide at scale 1
+	textWidth := func(text string, scale float64) int {
+		return int(float64(10*len(text)) * scale)
+	}
+	tests := []struct {
+		text  string
+		width int
+		label string
+		scale float64
+	}{
+		{"Human", 60, "Human", 1},
+		{"Human", 50, "Human", 1},
+		{"Human", 40, "Human", 0.8},
+		{"Human", 25, "Human", 0.5},
+		{"Human", 20, "Hum.", 0.5},
+		{"Human", 10, "H.", 0.5},
+		{"Human", 5, "H", 0.5},
+		{"Human", 4, "", 0.5},
+		{"Human", 0, "", 1},
+		{"", 50, "", 1},
+	}
+	for _, tt := range tests {
+		label, scale := fitLabel(tt.text, tt.width, 1, textWidth)
+		if label != tt.label || scale != tt.scale {
+			t.Errorf("%q in %d pixels: got %q at %.2f, want %q at %.2f", tt.text, tt.width, label, scale, tt.label, tt.scale)
+		}
+		if len(label) > 0 && textWidth(label, scale) > tt.width {
+			t.Errorf("%q in %d pixels: %q overflows", tt.text, tt.width, label)
+		}
+	}
+}
+
+func TestClassAliases(t *testing.T) {
+	cfg := testTrackConfig()
+	cfg.ClassAliases = map[string]string{"Human": "intruder", "animal": "pet"}
+	var list BlobList
+	list.Update([]Blob{testBlob(Human, 0, 0, 0.9), testBlob(Animal, 500, 0, 0.9)}, cfg)
+
+	blobs := list.Blobs()
+	cfg.nameClasses(blobs)
+	want := map[CategoryID]string{Human: "intruder", Animal: "pet"}
+	for _, blob := range blobs {
+		if blob.Class != want[blob.Category] {
+			t.Errorf("%s is named %q, want %q", blob.Category, blob.Class, want[blob.Category])
+		}
+	}
+	if name := cfg.ClassName(Vehicle); name != Vehicle.String() {
+		t.Errorf("got %q for a category without alias", name)
+	}
+
+	// tracking keeps matching the original categories
+	if list.Update([]Blob{testBlob(Human, 0, 0, 0.9), testBlob(Animal, 500, 0, 0.9)}, cfg) {
+		t.Error("same blobs have been tracked as a change")
+	}
+	for _, blob := range list.Blobs() {
+		if blob.Class != "" {
+			t.Errorf("tracked %s has been renamed %q", blob.Category, blob.Class)
+		}
+	}
+}
+
+func TestSnapshotByCategory(t *testing.T) {
+	frame := gocv.NewMatWithSize(300, 400, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+	tests := []struct {
+		name       string
+		byCategory bool
+		blobs      []Blob
+		dir        string
+	}{
+		{"disabled", false, []Blob{testBlob(Human, 10, 10, 0.9)}, ""},
+		{"human", true, []Blob{testBlob(Human, 10, 10, 0.9)}, "human"},
+		{"highest confidence", true, []Blob{testBlob(Human, 10, 10, 0.6), testBlob(Animal, 200, 10, 0.8)}, "animal"},
+		{"no blobs", true, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			oCfg := &OpenConfig{SnapshotPath: root, SnapshotByCategory: tt.byCategory}
+			path, _, err := StoreSnapshot(&DetectionConfig{}, oCfg, &frame, false, tt.blobs, "id")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dir := filepath.Join(root, tt.dir); filepath.Dir(path) != dir {
+				t.Errorf("got snapshot %s, want it in %s", path, dir)
+			}
+			if _, err := os.Stat(path); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCropRect(t *testing.T) {
+	bounds := image.Rect(0, 0, 800, 600)
+	oCfg := &OpenConfig{CropPadding: 10, CropPaddingByClass: map[string]int{"animal": 50}}
+	tests := []struct {
+		name  string
+		blobs []Blob
+		want  image.Rectangle
+	}{
+		{"default padding", []Blob{testBlob(Human, 100, 100, 0.9)}, image.Rect(90, 90, 210, 310)},
+		{"class padding", []Blob{testBlob(Animal, 100, 100, 0.9)}, image.Rect(50, 50, 250, 350)},
+		{"both", []Blob{testBlob(Human, 100, 100, 0.9), testBlob(Animal, 400, 100, 0.9)}, image.Rect(90, 50, 550, 350)},
+		{"clamped", []Blob{testBlob(Animal, 20, 380, 0.9)}, image.Rect(0, 330, 170, 600)},
+	}
+	for _, tt := range tests {
+		if got := CropRect(oCfg, tt.blobs, bounds); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeSnapshot(t *testing.T) {
+	frame := gocv.NewMatWithSize(48, 64, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+	for _, format := range []string{"", "png"} {
+		data, err := EncodeSnapshot(&OpenConfig{EmbedFormat: format}, &frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, name, err := image.Decode(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("format %q: %s", format, err.Error())
+		}
+		if size := img.Bounds().Size(); size != image.Pt(64, 48) {
+			t.Errorf("format %q: got a %s %v image, want 64x48", format, name, size)
+		}
+	}
+}
+
+func TestEmbedFormatMagic(t *testing.T) {
+	frame := gocv.NewMatWithSize(48, 64, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+	gocv.Rectangle(&frame, image.Rect(8, 8, 40, 40), color.RGBA{R: 200, G: 100, B: 50}, -1)
+	tests := []struct {
+		format  string
+		quality int
+		magic   []byte
+	}{
+		{"", 0, []byte{0xff, 0xd8, 0xff}},
+		{"jpeg", 10, []byte{0xff, 0xd8, 0xff}},
+		{"png", 0, []byte("\x89PNG\r\n\x1a\n")},
+	}
+	for _, tt := range tests {
+		data, err := EncodeSnapshot(&OpenConfig{EmbedFormat: tt.format, EmbedQuality: tt.quality}, &frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(raw, tt.magic) {
+			t.Errorf("format %q: got header % x, want % x", tt.format, raw[:len(tt.magic)], tt.magic)
+		}
+	}
+}
+
+func TestFitSnapshotData(t *testing.T) {
+	tests := []struct {
+		name  string
+		blobs int
+		data  int
+		kept  bool
+	}{
+		{"small", 1, 1024, true},
+		{"snapshot too big", 1, maxEmbeddingEventSize, false},
+		{"rest of the event too big", 5000, 100 * 1024, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev := VideoEvent{
+				Blobs:        make([]Blob, tt.blobs),
+				SnapshotData: strings.Repeat("A", tt.data),
+			}
+			for i := range ev.Blobs {
+				ev.Blobs[i] = testBlob(Human, i, i, 0.9)
+				ev.Blobs[i].Class = "Human"
+			}
+			fitSnapshotData(&ev)
+			if kept := len(ev.SnapshotData) > 0; kept != tt.kept {
+				t.Errorf("got snapshot kept %v, want %v", kept, tt.kept)
+			}
+		})
+	}
+}
+
+func TestCorrelationID(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	id := NewCorrelationID()
+	if !uuid.MatchString(id) {
+		t.Errorf("%s is not a version 4 UUID", id)
+	}
+	if other := NewCorrelationID(); other == id {
+		t.Errorf("got the same ID twice: %s", id)
+	}
+
+	tests := []struct {
+		name string
+		oCfg OpenConfig
+		want string
+	}{
+		{"default name", OpenConfig{VideoSource: "cam"}, "-cam-" + id + ".png"},
+		{"template", OpenConfig{SnapshotName: "{id}.jpg"}, id + ".jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if name := GetImageFileName(&tt.oCfg, nil, id); !strings.HasSuffix(name, tt.want) {
+				t.Errorf("got %s, want it to end with %s", name, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapshotName(t *testing.T) {
+	humans := []Blob{testBlob(Human, 0, 0, 0.9)}
+	tests := []struct {
+		name            string
+		oCfg            OpenConfig
+		other           OpenConfig
+		want, wantOther string
+	}{
+		{"sources", OpenConfig{VideoSource: "rtsp://cam1/live"}, OpenConfig{VideoSource: "rtsp://cam2/live"}, "-rtsp___cam1_live-1.png", "-rtsp___cam2_live-1.png"},
+		{"labels", OpenConfig{VideoSource: "/dev/video0", SourceLabel: "door"}, OpenConfig{VideoSource: "/dev/video0", SourceLabel: "garden"}, "-door-1.png", "-garden-1.png"},
+		{"template", OpenConfig{VideoSource: "a", SnapshotName: "{source}-{class}-{id}.jpg"}, OpenConfig{VideoSource: "b", SnapshotName: "{source}-{class}-{id}.jpg"}, "a-human-1.jpg", "b-human-1.jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// detections of both sources at the same time, with the same ID
+			name, other := GetImageFileName(&tt.oCfg, humans, "1"), GetImageFileName(&tt.other, humans, "1")
+			if name == other {
+				t.Errorf("got %s for both sources", name)
+			}
+			if !strings.HasSuffix(name, tt.want) || !strings.HasSuffix(other, tt.wantOther) {
+				t.Errorf("got %s and %s, want them to end with %s and %s", name, other, tt.want, tt.wantOther)
+			}
+		})
+	}
+}
+
+func TestPrepareSnapshotPath(t *testing.T) {
+	root := t.TempDir()
+	file := filepath.Join(root, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		path string
+		ok   bool
+	}{
+		{"existing", root, true},
+		{"missing", filepath.Join(root, "a", "b"), true},
+		{"template", filepath.Join(root, "c", "{class}"), true},
+		{"under a file", filepath.Join(file, "snapshots"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := PrepareSnapshotPath(tt.path)
+			if (err == nil) != tt.ok {
+				t.Fatalf("got error %v, want success %v", err, tt.ok)
+			}
+			if err != nil && !strings.HasPrefix(err.Error(), "snapshotPath: ") {
+				t.Errorf("unclear error: %s", err.Error())
+			}
+			if tt.ok {
+				if info, err := os.Stat(templateRoot(tt.path)); err != nil || !info.IsDir() {
+					t.Errorf("folder not created: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestTopScores(t *testing.T) {
+	blob := testBlob(Human, 0, 0, 0.6)
+	over := func(c CategoryID, confidence float64, left int) scoredPosition {
+		return scoredPosition{ClassScore{c, confidence}, testBlob(c, left, 0, confidence).Position}
+	}
+	tests := []struct {
+		name       string
+		candidates []scoredPosition
+		k          int
+		want       []ClassScore
+	}{
+		{"single class", nil, 3, []ClassScore{{Human, 0.6}}},
+		{"best of each class", []scoredPosition{over(Animal, 0.1, 0), over(Animal, 0.3, 5), over(Human, 0.9, 0)}, 3,
+			[]ClassScore{{Human, 0.6}, {Animal, 0.3}}},
+		{"other box", []scoredPosition{over(Animal, 0.3, 80)}, 3, []ClassScore{{Human, 0.6}}},
+		{"top k", []scoredPosition{over(Animal, 0.3, 0), over(Vehicle, 0.2, 0)}, 2,
+			[]ClassScore{{Human, 0.6}, {Animal, 0.3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := topScores(blob, tt.candidates, tt.k)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPerformBlobCrossClassNms(t *testing.T) {
+	frame := gocv.NewMatWithSize(300, 400, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+	// a dog box almost exactly over a person box
+	results := testResults(
+		[detectionStride]float32{0, 18, 0.7, 0.1, 0.1, 0.4, 0.8},
+		[detectionStride]float32{0, personClassID, 0.9, 0.11, 0.1, 0.41, 0.8},
+	)
+	defer results.Close()
+
+	tests := []struct {
+		nms  bool
+		want []CategoryID
+	}{
+		{false, []CategoryID{Animal, Human}},
+		{true, []CategoryID{Human}},
+	}
+	for _, tt := range tests {
+		cfg := &DetectionConfig{MinConfidence: 0.5, CrossClassNms: tt.nms}
+		blobs, err := PerformBlob(&frame, image.Rect(0, 0, 400, 300), results, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(blobs) != len(tt.want) {
+			t.Fatalf("crossClassNms %v: got %d blobs, want %d", tt.nms, len(blobs), len(tt.want))
+		}
+		for i, c := range tt.want {
+			if blobs[i].Category != c {
+				t.Errorf("crossClassNms %v: blob %d is %s, want %s", tt.nms, i, blobs[i].Category, c)
+			}
+		}
+	}
+}
+
+func TestMinConfidenceForArea(t *testing.T) {
+	cfg := &DetectionConfig{SizeConfidenceCurve: []SizeConfidencePoint{
+		{Area: 0.01, MinConfidence: 0.4},
+		{Area: 0.25, MinConfidence: 0.6},
+		{Area: 0.75, MinConfidence: 0.9},
+	}}
+	tests := []struct {
+		area float64
+		want float64
+	}{
+		{0.001, 0.4},
+		{0.01, 0.4},
+		{0.13, 0.5},
+		{0.25, 0.6},
+		{0.5, 0.75},
+		{0.75, 0.9},
+		{1, 0.9},
+	}
+	for _, tt := range tests {
+		if got := cfg.minConfidenceForArea(tt.area); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("area %v: got %v, want %v", tt.area, got, tt.want)
+		}
+	}
+}
+
+// regionBytes returns a copy of the pixels of a region of the frame
+func regionBytes(frame gocv.Mat, rect image.Rectangle) []byte {
+	region := frame.Region(rect)
+	defer region.Close()
+	clone := region.Clone()
+	defer clone.Close()
+	return clone.ToBytes()
+}
+
+func TestBlurHumans(t *testing.T) {
+	// a checkerboard, so that blurring changes every region
+	frame := gocv.NewMatWithSize(300, 400, gocv.MatTypeCV8UC3)
+	defer frame.Close()
+	for y := 0; y < 300; y++ {
+		for x := 0; x < 400; x++ {
+			if (x/4+y/4)%2 == 0 {
+				frame.SetUCharAt(y, x*3, 255)
+			}
+		}
+	}
+	human := testBlob(Human, 20, 30, 0.9)
+	animal := testBlob(Animal, 250, 30, 0.9)
+	head := image.Rect(20, 30, 120, 30+200/3)
+	body := image.Rect(20, 30+200/3+10, 120, 230)
+	animalBox := image.Rect(250, 30, 350, 230)
+
+	blurred := frame.Clone()
+	defer blurred.Close()
+	BlurHumans(&blurred, []Blob{human, animal})
+
+	if bytes.Equal(regionBytes(frame, head), regionBytes(blurred, head)) {
+		t.Error("head of the human not blurred")
+	}
+	if !bytes.Equal(regionBytes(frame, body), regionBytes(blurred, body)) {
+		t.Error("body of the human blurred")
+	}
+	if !bytes.Equal(regionBytes(frame, animalBox), regionBytes(blurred, animalBox)) {
+		t.Error("animal blurred")
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	var pause PauseSwitch
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	d := NewDetector(WithDetectionConfig(testTrackConfig()), WithOpenConfig(&OpenConfig{VideoSource: testPatternSource, EmitEveryFrame: true}), WithPauseSwitch(&pause))
+	detectionc, _ := d.Run(ctx)
+	defer func() {
+		cancel()
+		for range detectionc {
+		}
+	}()
+	next := func() VideoEvent {
+		select {
+		case <-ctx.Done():
+			t.Fatal("no event received")
+		case evt := <-detectionc:
+			return evt
+		}
+		return VideoEvent{}
+	}
+
+	next()
+	pause.Pause()
+	// events already on their way are discarded
+	for evt := next(); !evt.Paused; evt = next() {
+	}
+	select {
+	case evt := <-detectionc:
+		t.Fatalf("got %+v while paused", evt)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	pause.Resume()
+	if evt := next(); !evt.Resumed {
+		t.Fatalf("got %+v, want the resume event", evt)
+	}
+	if evt := next(); len(evt.Blobs) != 1 {
+		t.Errorf("got %d blobs once resumed, want 1", len(evt.Blobs))
+	}
+}
+
+func TestResizeFrame(t *testing.T) {
+	img := gocv.NewMatWithSize(300, 400, gocv.MatTypeCV8UC3)
+	defer img.Close()
+	tests := []struct {
+		scale float64
+		want  image.Point
+	}{
+		{0.5, image.Pt(200, 150)},
+		{1, image.Pt(400, 300)},
+		{2, image.Pt(800, 600)},
+		{1.5, image.Pt(600, 450)},
+	}
+	for _, tt := range tests {
+		resized := gocv.NewMat()
+		ResizeFrame(img, &resized, tt.scale)
+		if got := image.Pt(resized.Cols(), resized.Rows()); got != tt.want {
+			t.Errorf("scale %v: got %v, want %v", tt.scale, got, tt.want)
+		}
+		resized.Close()
+	}
+}
+
+func TestSingleShot(t *testing.T) {
+	tests := []struct {
+		name   string
+		paused bool
+		oCfg   OpenConfig
+		want   VideoEvent
+	}{
+		{"entities", false, OpenConfig{}, VideoEvent{Blobs: make([]Blob, 1)}},
+		{"paused", true, OpenConfig{}, VideoEvent{Paused: true}},
+		{"tamper ignored", false, OpenConfig{TamperDetection: true, TamperLuminance: 255, TamperSeconds: 0.001}, VideoEvent{Blobs: make([]Blob, 1)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pause PauseSwitch
+			if tt.paused {
+				pause.Pause()
+			}
+			oCfg := tt.oCfg
+			oCfg.VideoSource = testPatternSource
+			oCfg.SingleShot = true
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			d := NewDetector(WithDetectionConfig(testTrackConfig()), WithOpenConfig(&oCfg), WithPauseSwitch(&pause))
+			detectionc, errorc := d.Run(ctx)
+
+			var events []VideoEvent
+			var err error
+			for err == nil {
+				select {
+				case <-ctx.Done():
+					t.Fatal("the single shot did not end")
+				case evt := <-detectionc:
+					events = append(events, evt)
+				case err = <-errorc:
+				}
+			}
+			if err != ErrDeviceClosed {
+				t.Errorf("got error %v, want ErrDeviceClosed", err)
+			}
+			if len(events) != 1 {
+				t.Fatalf("got %d events, want 1", len(events))
+			}
+			evt := events[0]
+			if evt.Paused != tt.want.Paused || evt.Tampered || len(evt.Blobs) != len(tt.want.Blobs) {
+				t.Errorf("got %+v, want %+v", evt, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitDelta(t *testing.T) {
+	h, a := testBlob(Human, 0, 0, 0.9), testBlob(Animal, 200, 0, 0.9)
+	evt := VideoEvent{Blobs: []Blob{h}, SnapshotData: "data", AsciiImage: "ascii"}
+	tests := []struct {
+		name  string
+		delta BlobDelta
+		types []string
+	}{
+		{"none", BlobDelta{}, nil},
+		{"added", BlobDelta{Added: []Blob{h}}, []string{DeltaAdded}},
+		{"both", BlobDelta{Added: []Blob{h, a}, Removed: []Blob{a}}, []string{DeltaAdded, DeltaAdded, DeltaRemoved}},
+	}
+	for _, tt := range tests {
+		events := splitDelta(evt, tt.delta)
+		if len(events) != len(tt.types) {
+			t.Fatalf("%s: got %d events, want %d", tt.name, len(events), len(tt.types))
+		}
+		for i, e := range events {
+			if e.DeltaType != tt.types[i] || e.DeltaIndex != i || len(e.Blobs) != 1 {
+				t.Errorf("%s: event %d is %s at %d with %d blobs, want %s at %d", tt.name, i, e.DeltaType, e.DeltaIndex, len(e.Blobs), tt.types[i], i)
+			}
+			// the images are sent once for the whole change
+			if embedded := len(e.SnapshotData) > 0 && len(e.AsciiImage) > 0; embedded != (i == 0) {
+				t.Errorf("%s: event %d has embedded images %v", tt.name, i, embedded)
+			}
+		}
+	}
+}
+
+func TestAnnotationFont(t *testing.T) {
+	tests := []struct {
+		oCfg      OpenConfig
+		font      gocv.HersheyFont
+		scale     float64
+		thickness int
+	}{
+		{OpenConfig{}, gocv.FontHersheyPlain, 1, 2},
+		{OpenConfig{FontFace: "duplex", FontScale: 3, FontThickness: 6}, gocv.FontHersheyDuplex, 3, 6},
+	}
+	for _, tt := range tests {
+		font, scale, thickness := tt.oCfg.annotationFont()
+		if font != tt.font || scale != tt.scale || thickness != tt.thickness {
+			t.Errorf("%+v: got %v, %v, %d, want %v, %v, %d", tt.oCfg, font, scale, thickness, tt.font, tt.scale, tt.thickness)
+		}
+	}
+
+	// thicker annotations cover more of the frame
+	drawn := func(oCfg *OpenConfig) int {
+		frame := gocv.NewMatWithSize(300, 400, gocv.MatTypeCV8UC3)
+		defer frame.Close()
+		DrawBlobs(&DetectionConfig{}, oCfg, &frame, []Blob{testBlob(Human, 100, 50, 0.9)})
+		gray := gocv.NewMat()
+		defer gray.Close()
+		gocv.CvtColor(frame, &gray, gocv.ColorBGRToGray)
+		return gocv.CountNonZero(gray)
+	}
+	if thin, thick := drawn(&OpenConfig{FontThickness: 1}), drawn(&OpenConfig{FontThickness: 6}); thick <= thin {
+		t.Errorf("got %d pixels drawn with thickness 6, not more than %d with thickness 1", thick, thin)
+	}
+}
+
+func TestFormatConfidence(t *testing.T) {
+	tests := []struct {
+		confidence float64
+		decimals   int
+		want       string
+	}{
+		{0, 0, "0%"},
+		{1, 0, "100%"},
+		{0.005, 0, "0%"},
+		{0.005, 1, "0.5%"},
+		{0.8234123, 0, "82%"},
+		{0.8234123, 2, "82.34%"},
+		{0.995, 0, "100%"},
+	}
+	for _, tt := range tests {
+		cfg := &DetectionConfig{ConfidenceDecimals: tt.decimals}
+		if got := cfg.FormatConfidence(tt.confidence); got != tt.want {
+			t.Errorf("%v with %d decimals: got %s, want %s", tt.confidence, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func TestAsciiImageFallback(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  gocv.MatType
+	}{
+		{"8-bit", gocv.MatTypeCV8UC3},
+		// not supported by the YUV conversion
+		{"16-bit", gocv.MatTypeCV16UC3},
+		{"float", gocv.MatTypeCV32FC1},
+	}
+	for _, tt := range tests {
+		img := gocv.NewMatWithSizeFromScalar(gocv.NewScalar(100, 50, 25, 0), 60, 80, tt.typ)
+		gocv.Rectangle(&img, image.Rect(10, 10, 40, 40), color.RGBA{R: 255, G: 255, B: 255}, -1)
+		ascii, err := asciiImage(&img, false, false)
+		img.Close()
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		} else if len(ascii) == 0 {
+			t.Errorf("%s: no ASCII image", tt.name)
+		}
+	}
+}
+
+func TestAsciiColor(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	img.Set(1, 0, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+	tests := []struct {
+		name string
+		got  []byte
+		want string
+	}{
+		{"plain", Convert2Ascii(img, 2, 1), "# \n"},
+		{"ansi", convert2AnsiAscii(img, 2, 1), "\x1b[38;2;255;0;0m#\x1b[38;2;255;255;255m \x1b[0m\n"},
+	}
+	for _, tt := range tests {
+		if string(tt.got) != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestStateRefresh(t *testing.T) {
+	const interval = 200 * time.Millisecond
+	// the box moves, but stays a single blob, so that no change is sent
+	events := runTestPattern(t, testTrackConfig(), &OpenConfig{StateRefreshSeconds: interval.Seconds()}, 4)
+	if events[0].StateRefresh {
+		t.Error("got a state refresh as first event")
+	}
+	for i, evt := range events[1:] {
+		if !evt.StateRefresh || len(evt.Blobs) != 1 {
+			t.Errorf("event %d: got refresh %v with %d blobs, want a refresh with 1 blob", i+1, evt.StateRefresh, len(evt.Blobs))
+		}
+		// frames are read every 33ms
+		if gap := evt.Timestamp.Sub(events[i].Timestamp); gap < interval-40*time.Millisecond || gap > interval+100*time.Millisecond {
+			t.Errorf("event %d: sent %s after the previous one, want about %s", i+1, gap, interval)
+		}
+	}
+}
+
+// skippingDetector skips all the frames after the first ones
+type skippingDetector struct {
+	detector
+	detect int
+}
+
+func (d *skippingDetector) Detect(img *gocv.Mat) ([]Blob, error) {
+	if d.detect == 0 {
+		return nil, errFrameSkipped
+	}
+	d.detect--
+	return d.detector.Detect(img)
+}
+
+func TestSkippedFrames(t *testing.T) {
+	tests := []struct {
+		name   string
+		detect int
+		oCfg   OpenConfig
+		// the refresh flags of the events sent before the error
+		want    []bool
+		wantErr error
+	}{
+		{"state refresh", 1, OpenConfig{StateRefreshSeconds: 0.2}, []bool{false, true, true}, nil},
+		{"single shot", 0, OpenConfig{SingleShot: true}, nil, ErrDeviceClosed},
+	}
+	defer func(orig func(boxSource) detector) { newTestPatternDetector = orig }(newTestPatternDetector)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestPatternDetector = func(pattern boxSource) detector {
+				return &skippingDetector{detector: &testPatternDetector{pattern: pattern}, detect: tt.detect}
+			}
+			oCfg := tt.oCfg
+			oCfg.VideoSource = testPatternSource
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			d := NewDetector(WithDetectionConfig(testTrackConfig()), WithOpenConfig(&oCfg))
+			detectionc, errorc := d.Run(ctx)
+			defer func() {
+				cancel()
+				for range detectionc {
+				}
+			}()
+
+			var refreshes []bool
+			var err error
+			for err == nil && (tt.wantErr != nil || len(refreshes) < len(tt.want)) {
+				select {
+				case <-ctx.Done():
+					t.Fatalf("got %d events, want %d", len(refreshes), len(tt.want))
+				case evt := <-detectionc:
+					refreshes = append(refreshes, evt.StateRefresh)
+					if len(evt.Blobs) != 1 {
+						t.Errorf("event %d: got %d blobs, want the tracked one", len(refreshes)-1, len(evt.Blobs))
+					}
+				case err = <-errorc:
+				}
+			}
+			if err != tt.wantErr {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(refreshes, tt.want) {
+				t.Errorf("got refresh flags %v, want %v", refreshes, tt.want)
+			}
+		})
+	}
+}
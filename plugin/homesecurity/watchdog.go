@@ -0,0 +1,72 @@
+package homesecurity
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"time"
+)
+
+// delay before the first restart of a panicked detection, doubled
+// at each following restart up to maxRestartBackoff
+const (
+	restartBackoff    = time.Second
+	maxRestartBackoff = 30 * time.Second
+)
+
+// superviseDetection runs the detection, recovering it from panics, as a
+// bad frame or model output deep in OpenCV would otherwise kill the whole
+// process. A panicked detection is restarted up to MaxRestarts times, each
+// restart being notified by an event; afterwards, the panic is sent as an
+// error.
+func superviseDetection(ctx context.Context, oCfg *OpenConfig, detectionChan DetectionChan, errorChan ErrorChan, run func()) {
+	backoff := restartBackoff
+	for restarts := 0; ; restarts++ {
+		err := recoverDetection(run)
+		if err == nil {
+			return
+		}
+		if restarts >= oCfg.MaxRestarts {
+			select {
+			case <-ctx.Done():
+			case errorChan <- err:
+			}
+			return
+		}
+
+		videoEv := VideoEvent{
+			CorrelationID: NewCorrelationID(),
+			Timestamp:     time.Now(),
+			VideoSource:   oCfg.VideoSource,
+			SourceLabel:   oCfg.SourceLabel,
+			Error:         err.Error(),
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case detectionChan <- videoEv:
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxRestartBackoff {
+			backoff = maxRestartBackoff
+		}
+	}
+}
+
+// recoverDetection runs the detection, returning its panic as an error,
+// while its stack trace is logged
+func recoverDetection(run func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Fprintf(os.Stderr, "detection panicked: %v\n%s", r, debug.Stack())
+			err = fmt.Errorf("detection panicked: %v", r)
+		}
+	}()
+	run()
+	return nil
+}
@@ -0,0 +1,67 @@
+package homesecurity
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSuperviseDetection(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxRestarts int
+		panics      int
+		wantEvents  int
+		wantErr     bool
+	}{
+		{"no panic", 0, 0, 0, false},
+		{"panic without restarts", 0, 1, 0, true},
+		{"restarted", 1, 1, 1, false},
+		{"restarts exhausted", 1, 2, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oCfg := &OpenConfig{VideoSource: "/dev/video0", MaxRestarts: tt.maxRestarts}
+			detectionChan := make(DetectionChan)
+			errorChan := make(ErrorChan)
+			runs := 0
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				superviseDetection(context.Background(), oCfg, detectionChan, errorChan, func() {
+					if runs++; runs <= tt.panics {
+						panic("boom")
+					}
+				})
+			}()
+
+			var (
+				events int
+				err    error
+			)
+			timeout := time.After(restartBackoff + 5*time.Second)
+		loop:
+			for {
+				select {
+				case evt := <-detectionChan:
+					events++
+					if !strings.Contains(evt.Error, "boom") || evt.VideoSource != oCfg.VideoSource {
+						t.Errorf("got restart event %+v", evt)
+					}
+				case err = <-errorChan:
+				case <-done:
+					break loop
+				case <-timeout:
+					t.Fatal("detection not ended")
+				}
+			}
+			if events != tt.wantEvents {
+				t.Errorf("got %d restart events, want %d", events, tt.wantEvents)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package homesecurity
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+
+	"gocv.io/x/gocv"
+)
+
+const windowName = "Falco Home Security"
+
+var errNoDisplay = errors.New("no display available")
+
+// openWindow opens the GUI window. OpenCV aborts the whole process when
+// no display is available, so that case is detected beforehand.
+func openWindow() (window *gocv.Window, err error) {
+	if runtime.GOOS == "linux" && len(os.Getenv("DISPLAY")) == 0 && len(os.Getenv("WAYLAND_DISPLAY")) == 0 {
+		return nil, errNoDisplay
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			window, err = nil, fmt.Errorf("failed to create window: %v", r)
+		}
+	}()
+	window = gocv.NewWindow(windowName)
+	if !window.IsOpen() {
+		return nil, fmt.Errorf("failed to create window")
+	}
+	return window, nil
+}
+
+// createWindow opens the GUI window, replaced by tests
+var createWindow = openWindow
+
+// OpenWindowOrHeadless opens the GUI window if requested by the config,
+// falling back to headless mode, with a warning, if that's not possible
+func OpenWindowOrHeadless(cfg *OpenConfig) *gocv.Window {
+	if !cfg.ShowWindow {
+		return nil
+	}
+	window, err := createWindow()
+	if err != nil {
+		fmt.Printf("cannot show window, running headless: %s\n", err.Error())
+		cfg.ShowWindow = false
+		return nil
+	}
+	return window
+}
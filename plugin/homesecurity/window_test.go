@@ -0,0 +1,46 @@
+package homesecurity
+
+import (
+	"errors"
+	"runtime"
+	"testing"
+
+	"gocv.io/x/gocv"
+)
+
+func TestOpenWindowOrHeadless(t *testing.T) {
+	defer func(create func() (*gocv.Window, error)) {
+		createWindow = create
+	}(createWindow)
+	createWindow = func() (*gocv.Window, error) {
+		return nil, errors.New("no window for tests")
+	}
+
+	tests := []struct {
+		name string
+		show bool
+	}{
+		{"headless", false},
+		{"failing window", true},
+	}
+	for _, tt := range tests {
+		cfg := &OpenConfig{ShowWindow: tt.show}
+		if window := OpenWindowOrHeadless(cfg); window != nil {
+			t.Errorf("%s: got a window", tt.name)
+		}
+		if cfg.ShowWindow {
+			t.Errorf("%s: still showing the window", tt.name)
+		}
+	}
+}
+
+func TestOpenWindowWithoutDisplay(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("displays are only checked on linux")
+	}
+	t.Setenv("DISPLAY", "")
+	t.Setenv("WAYLAND_DISPLAY", "")
+	if _, err := openWindow(); err != errNoDisplay {
+		t.Errorf("got error %v, want %v", err, errNoDisplay)
+	}
+}
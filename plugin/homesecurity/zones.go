@@ -0,0 +1,75 @@
+package homesecurity
+
+import (
+	"image"
+	"sort"
+)
+
+// ZoneTransition records a blob entering or leaving a named zone
+type ZoneTransition struct {
+	Zone   string
+	BlobID uint64
+}
+
+// Returns true if the point lies inside the polygon, using ray casting
+func pointInPolygon(p image.Point, poly []image.Point) bool {
+	inside := false
+	for i, j := 0, len(poly)-1; i < len(poly); j, i = i, i+1 {
+		a, b := poly[i], poly[j]
+		if (a.Y > p.Y) != (b.Y > p.Y) &&
+			p.X < a.X+(p.Y-a.Y)*(b.X-a.X)/(b.Y-a.Y) {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// Updates the zones occupied by the center of each confirmed blob, and
+// returns the transitions since the previous update. Blobs that are no
+// longer tracked leave all their zones.
+func (b *BlobList) updateZones(zones map[string][]image.Point) (enter, exit []ZoneTransition) {
+	occupied := make(map[uint64]map[string]bool)
+	for _, blob := range b.blobs {
+		if !blob.confirmed {
+			continue
+		}
+		c := blob.Position.Center()
+		for name, poly := range zones {
+			if pointInPolygon(image.Pt(c.x, c.y), poly) {
+				if occupied[blob.ID] == nil {
+					occupied[blob.ID] = make(map[string]bool)
+				}
+				occupied[blob.ID][name] = true
+			}
+		}
+	}
+
+	for id, names := range occupied {
+		for name := range names {
+			if !b.zones[id][name] {
+				enter = append(enter, ZoneTransition{Zone: name, BlobID: id})
+			}
+		}
+	}
+	for id, names := range b.zones {
+		for name := range names {
+			if !occupied[id][name] {
+				exit = append(exit, ZoneTransition{Zone: name, BlobID: id})
+			}
+		}
+	}
+	b.zones = occupied
+	sortTransitions(enter)
+	sortTransitions(exit)
+	return enter, exit
+}
+
+// sorts transitions by blob and zone, for stable events
+func sortTransitions(t []ZoneTransition) {
+	sort.Slice(t, func(i, j int) bool {
+		if t[i].BlobID != t[j].BlobID {
+			return t[i].BlobID < t[j].BlobID
+		}
+		return t[i].Zone < t[j].Zone
+	})
+}
@@ -0,0 +1,58 @@
+package homesecurity
+
+import (
+	"fmt"
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestPointInPolygon(t *testing.T) {
+	triangle := []image.Point{{0, 0}, {100, 0}, {0, 100}}
+	tests := []struct {
+		p    image.Point
+		want bool
+	}{
+		{image.Pt(10, 10), true},
+		{image.Pt(60, 60), false},
+		{image.Pt(-1, 10), false},
+	}
+	for _, tt := range tests {
+		if got := pointInPolygon(tt.p, triangle); got != tt.want {
+			t.Errorf("%v: got %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestZoneTransitions(t *testing.T) {
+	cfg := testTrackConfig()
+	cfg.Zones = map[string][]image.Point{
+		"porch":    {{0, 0}, {200, 0}, {200, 400}, {0, 400}},
+		"driveway": {{200, 0}, {400, 0}, {400, 400}, {200, 400}},
+	}
+	var list BlobList
+	var got []string
+	record := func() {
+		enter, exit := list.ZoneTransitions()
+		for _, z := range exit {
+			got = append(got, fmt.Sprintf("exit %s %d", z.Zone, z.BlobID))
+		}
+		for _, z := range enter {
+			got = append(got, fmt.Sprintf("enter %s %d", z.Zone, z.BlobID))
+		}
+	}
+
+	// walks from the porch to the driveway, then goes away
+	for left := 100; left <= 250; left += 10 {
+		list.Update([]Blob{testBlob(Human, left, 100, 0.9)}, cfg)
+		record()
+	}
+	for i := 0; i < 20; i++ {
+		list.Update(nil, cfg)
+		record()
+	}
+	want := []string{"enter porch 1", "exit porch 1", "enter driveway 1", "exit driveway 1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got transitions %v, want %v", got, want)
+	}
+}
@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
 	"encoding/gob"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/FedeDP/falco-home-security/plugin/homesecurity"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk/plugins/extractor"
@@ -16,26 +19,52 @@ import (
 	"gocv.io/x/gocv"
 )
 
-type OpenConfig struct {
-	VideoSource  string `json:"videoSource"`
-	ShowWindow   bool   `json:"showWindow"`
-	SnapshotPath string `json:"snapshotPath"`
-}
+// maximum number of per-blob events returned by a single NextBatch
+const perBlobBatchSize = 16
 
 type VideoPlugin struct {
 	plugins.BasePlugin
-	cfg *DetectionConfig
+	cfg *homesecurity.DetectionConfig
+
+	// labels of the sources of the currently open instances
+	mu        sync.Mutex
+	instances map[*VideoInstance][]string
 }
 
 type VideoInstance struct {
 	source.BaseInstance
-	cfg        *OpenConfig
-	detectionc DetectionChan
-	errorc     ErrorChan
-	quitc      QuitChan
-	renderc    RenderChan
+	plugin     *VideoPlugin
+	cfg        *homesecurity.OpenConfig
+	detectionc homesecurity.DetectionChan
+	errorc     homesecurity.ErrorChan
+	cancel     context.CancelFunc
+	pause      *homesecurity.PauseSwitch
+	renderc    homesecurity.RenderChan
 	window     *gocv.Window
 	wg         *sync.WaitGroup
+	outputs    []homesecurity.EventOutput
+	closeOnce  sync.Once
+
+	// open config of each video source, see ExpandSources
+	sources []*homesecurity.OpenConfig
+
+	// blob counts of each video source
+	counts map[sourceKey]*sourceCounts
+}
+
+// sourceKey identifies a video source of an instance
+type sourceKey struct {
+	source, label string
+}
+
+// sourceCounts holds the blob counts of a video source
+type sourceCounts struct {
+	// high-water marks of the concurrent blob counts
+	peak           uint64
+	peakByCategory map[homesecurity.CategoryID]uint64
+
+	// blob counts of the recent events
+	smoother *homesecurity.CountSmoother
 }
 
 func init() {
@@ -63,7 +92,7 @@ func (m *VideoPlugin) Info() *plugins.Info {
 // Init initializes this plugin with a given config string, which is unused
 // in this example. This method is mandatory for source plugins.
 func (m *VideoPlugin) Init(config string) error {
-	cfg := DetectionConfig{
+	cfg := homesecurity.DetectionConfig{
 		Model:                      "",
 		NetConfig:                  "",
 		Backend:                    "",
@@ -88,22 +117,36 @@ func (m *VideoPlugin) Init(config string) error {
 		return err
 	}
 
-	if len(cfg.Model) == 0 || len(cfg.NetConfig) == 0 {
-		println("init mandatory")
-		return fmt.Errorf("model and netConfig are mandatory init config parameters")
+	if err := homesecurity.ValidateDetectionConfig(&cfg); err != nil {
+		println("init: " + err.Error())
+		return err
+	}
+
+	// load the models right away, so that issues are detected early
+	if err := homesecurity.LoadNets(&cfg); err != nil {
+		println("init: " + err.Error())
+		return err
 	}
 
 	m.cfg = &cfg
+	m.instances = make(map[*VideoInstance][]string)
 	return nil
 }
 
+// Destroy releases the resources allocated by Init
+func (m *VideoPlugin) Destroy() {
+	homesecurity.ReleaseNets()
+}
+
 // Open opens the plugin source and starts a new capture session (e.g. stream
 // of events), creating a new plugin instance.
 func (m *VideoPlugin) Open(params string) (source.Instance, error) {
-	cfg := OpenConfig{
-		VideoSource:  "",
-		ShowWindow:   false,
-		SnapshotPath: "",
+	cfg := homesecurity.OpenConfig{
+		VideoSource:         "",
+		ShowWindow:          false,
+		SnapshotPath:        "",
+		IncludeAsciiImage:   true,
+		IncludeSnapshotPath: true,
 	}
 
 	if len(params) == 0 {
@@ -115,44 +158,206 @@ func (m *VideoPlugin) Open(params string) (source.Instance, error) {
 		return nil, err
 	}
 
-	if len(cfg.VideoSource) == 0 {
-		return nil, fmt.Errorf("videoSource is a mandatory open config parameters")
+	if err := homesecurity.ValidateOpenConfig(&cfg); err != nil {
+		return nil, err
+	}
+
+	sources, err := homesecurity.ExpandSources(&cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	var window *gocv.Window
-	if cfg.ShowWindow {
-		window = gocv.NewWindow("Falco Home Security")
+	labels := make([]string, 0, len(sources))
+	for _, sCfg := range sources {
+		labels = append(labels, sCfg.SourceLabel)
+	}
+	if err := m.checkLabels(labels); err != nil {
+		return nil, err
 	}
 
+	if len(cfg.SnapshotPath) > 0 {
+		if err := homesecurity.PrepareSnapshotPath(cfg.SnapshotPath); err != nil {
+			return nil, err
+		}
+	}
+
+	// Override event buffer, before anything that would need to be
+	// released on failure is started
+	batchSize := int64(1)
+	if cfg.EventGranularity == "per-blob" {
+		batchSize = perBlobBatchSize
+	}
+	// a keepalive is sent for each source at once
+	if cfg.IdleKeepalive && int64(len(sources)) > batchSize {
+		batchSize = int64(len(sources))
+	}
+	events, err := sdk.NewEventWriters(batchSize, int64(sdk.DefaultEvtSize))
+	if err != nil {
+		return nil, err
+	}
+
+	outputs, err := homesecurity.OpenEventOutputs(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	window := homesecurity.OpenWindowOrHeadless(&cfg)
+
 	var wg sync.WaitGroup
-	quitc := make(QuitChan, 1)
-	detectionc, renderc, errorc := LaunchVideoDetection(m.cfg, &cfg, quitc, &wg)
+	pause := &homesecurity.PauseSwitch{}
+	ctx, cancel := context.WithCancel(context.Background())
+	detectionc, renderc, errorc := homesecurity.LaunchSources(ctx, m.cfg, sources, pause, &wg)
+	if len(cfg.PauseFile) > 0 {
+		homesecurity.WatchPauseFile(ctx, cfg.PauseFile, pause, &wg)
+	}
 	instance := &VideoInstance{
+		plugin:     m,
 		cfg:        &cfg,
 		detectionc: detectionc,
 		renderc:    renderc,
 		errorc:     errorc,
-		quitc:      quitc,
+		cancel:     cancel,
+		pause:      pause,
 		window:     window,
 		wg:         &wg,
+		outputs:    outputs,
+		sources:    sources,
+		counts:     make(map[sourceKey]*sourceCounts),
 	}
 
-	// Override event buffer
-	events, err := sdk.NewEventWriters(1, int64(sdk.DefaultEvtSize))
-	if err != nil {
-		return nil, err
-	}
 	instance.SetEvents(events)
 
+	m.mu.Lock()
+	m.instances[instance] = labels
+	m.mu.Unlock()
 	return instance, err
 }
 
+// Checks that the labels of the sources of a new instance allow to
+// distinguish them from the ones of the instances already open
+func (m *VideoPlugin) checkLabels(labels []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.instances) == 0 {
+		return nil
+	}
+	for _, label := range labels {
+		if len(label) == 0 {
+			return fmt.Errorf("sourceLabel is mandatory when opening multiple instances")
+		}
+		for _, open := range m.instances {
+			for _, l := range open {
+				if l == label {
+					return fmt.Errorf("sourceLabel %q is already used by another instance", label)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the blob counts of the source of the event
+func (m *VideoInstance) countsOf(evt *homesecurity.VideoEvent) *sourceCounts {
+	key := sourceKey{evt.VideoSource, evt.SourceLabel}
+	counts, ok := m.counts[key]
+	if !ok {
+		counts = &sourceCounts{
+			peakByCategory: make(map[homesecurity.CategoryID]uint64),
+			smoother:       homesecurity.NewCountSmoother(m.cfg.SmoothingWindow),
+		}
+		m.counts[key] = counts
+	}
+	return counts
+}
+
+// Updates the peak blob counts of the source of a new event with
+// the ones of the event, and stamps them onto the event.
+func (m *VideoInstance) updatePeaks(evt *homesecurity.VideoEvent) {
+	source := m.countsOf(evt)
+	counts := make(map[homesecurity.CategoryID]uint64)
+	for _, blob := range evt.Blobs {
+		counts[blob.Category]++
+	}
+	for c, n := range counts {
+		if n > source.peakByCategory[c] {
+			source.peakByCategory[c] = n
+		}
+	}
+	if n := uint64(len(evt.Blobs)); n > source.peak {
+		source.peak = n
+	}
+
+	evt.PeakBlobs = source.peak
+	evt.PeakBlobsByCategory = make(map[homesecurity.CategoryID]uint64, len(source.peakByCategory))
+	for c, n := range source.peakByCategory {
+		evt.PeakBlobsByCategory[c] = n
+	}
+}
+
+// Pause suspends the detection, without releasing the video source.
+// Frames are still read, but no event nor snapshot is produced.
+func (m *VideoInstance) Pause() {
+	m.pause.Pause()
+}
+
+// Resume restarts a paused detection
+func (m *VideoInstance) Resume() {
+	m.pause.Resume()
+}
+
+// Close stops the detection, waiting for it to release the video
+// sources, and closes the outputs. Calling it again has no effect.
 func (m *VideoInstance) Close() {
-	m.quitc <- true
-	close(m.quitc)
-	if m.cfg.ShowWindow {
+	m.closeOnce.Do(m.close)
+}
+
+func (m *VideoInstance) close() {
+	m.plugin.mu.Lock()
+	delete(m.plugin.instances, m)
+	m.plugin.mu.Unlock()
+
+	m.cancel()
+	m.wg.Wait()
+	if m.window != nil {
 		m.window.Close()
 	}
+	for _, o := range m.outputs {
+		if err := o.Close(); err != nil {
+			fmt.Printf("failed to close event output: %s", err.Error())
+		}
+	}
+}
+
+// Encodes the event, and sends it to the additional outputs
+func (m *VideoInstance) writeEvent(evt sdk.EventWriter, payload *homesecurity.VideoEvent) error {
+	m.updatePeaks(payload)
+	// pause, resume, tamper, keepalive, restart and end notifications
+	// carry no blobs, they would drag the counts down, while state
+	// refreshes, count alerts and the per-blob events following the
+	// first one of a change repeat blobs already counted
+	blobless := payload.Paused || payload.Resumed || payload.Tampered || payload.Idle || len(payload.Error) > 0 || payload.SourceEnded
+	repeated := payload.StateRefresh || payload.CountAlert || payload.DeltaIndex > 0
+	smoother := m.countsOf(payload).smoother
+	if !blobless && !repeated {
+		smoother.Add(payload.Blobs)
+	}
+	payload.SmoothedBlobs = smoother.Total()
+	payload.SmoothedBlobsByCategory = smoother.ByCategory()
+	encoder := gob.NewEncoder(evt.Writer())
+	if err := encoder.Encode(payload); err != nil {
+		return err
+	}
+	ts := payload.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	evt.SetTimestamp(uint64(ts.UnixNano()))
+	for _, o := range m.outputs {
+		if err := o.Write(payload); err != nil {
+			fmt.Printf("failed to write event output: %s", err.Error())
+		}
+	}
+	return nil
 }
 
 // NextBatch produces a batch of new events, and is called repeatedly by the
@@ -160,32 +365,60 @@ func (m *VideoInstance) Close() {
 // The batch has a maximum size that dependes on the size of the underlying
 // reusable memory buffer. A batch can be smaller than the maximum size.
 func (m *VideoInstance) NextBatch(pState sdk.PluginState, evts sdk.EventWriters) (int, error) {
-	evt := evts.Get(0)
-	writer := evt.Writer()
 	timeout := time.After(time.Millisecond * 1000)
 	for {
 		select {
 		case payload := <-m.detectionc:
-			encoder := gob.NewEncoder(writer)
-			if err := encoder.Encode(&payload); err != nil {
+			if err := m.writeEvent(evts.Get(0), &payload); err != nil {
 				return 0, err
 			}
-			evt.SetTimestamp(uint64(time.Now().UnixNano()))
-			return 1, nil
+			// per-blob events of the same change are sent back to back,
+			// batch the ones already available
+			n := 1
+			for more := true; more && n < evts.Len(); {
+				select {
+				case payload := <-m.detectionc:
+					if err := m.writeEvent(evts.Get(n), &payload); err != nil {
+						return 0, err
+					}
+					n++
+				default:
+					more = false
+				}
+			}
+			return n, nil
 		case err := <-m.errorc:
-			if err == errDeviceClosed {
+			if err == homesecurity.ErrDeviceClosed {
 				return 0, sdk.ErrEOF
 			}
 			return 0, err
 		case img := <-m.renderc:
 			if m.cfg.ShowWindow {
-				m.window.IMShow(img)
+				homesecurity.ShowFrame(m.window, img, m.cfg.RenderScale)
 				if m.window.WaitKey(1) >= 0 || m.window.GetWindowProperty(gocv.WindowPropertyVisible) == 0 {
 					return 0, sdk.ErrEOF
 				}
 			}
 		case <-timeout:
-			return 0, sdk.ErrTimeout
+			// nothing is sent while paused, but the pause event
+			if !m.cfg.IdleKeepalive || m.pause.Paused() {
+				return 0, sdk.ErrTimeout
+			}
+			// one for each source
+			n := 0
+			for ; n < len(m.sources) && n < evts.Len(); n++ {
+				keepalive := homesecurity.VideoEvent{
+					CorrelationID: homesecurity.NewCorrelationID(),
+					Timestamp:     time.Now(),
+					VideoSource:   m.sources[n].VideoSource,
+					SourceLabel:   m.sources[n].SourceLabel,
+					Idle:          true,
+				}
+				if err := m.writeEvent(evts.Get(n), &keepalive); err != nil {
+					return 0, err
+				}
+			}
+			return n, nil
 		}
 	}
 }
@@ -193,7 +426,7 @@ func (m *VideoInstance) NextBatch(pState sdk.PluginState, evts sdk.EventWriters)
 // String produces a string representation of an event data produced by the
 // event source of this plugin. This method is mandatory for source plugins.
 func (m *VideoPlugin) String(in io.ReadSeeker) (string, error) {
-	var payload VideoEvent
+	var payload homesecurity.VideoEvent
 	encoder := gob.NewDecoder(in)
 	if err := encoder.Decode(&payload); err != nil {
 		return "", err
@@ -211,7 +444,7 @@ func (m *VideoPlugin) Fields() []sdk.FieldEntry {
 			Type:    "uint64",
 			Name:    "video.entities",
 			Display: "Count of the entities detected in the scene",
-			Desc:    "Number of entities in the scene, use video.entities[<type>] to count a specific entity type between { human, animal }",
+			Desc:    "Number of entities in the scene, use video.entities[<type>] to count a specific entity type between { human, animal }, video.entities[human,animal] to sum multiple types, or video.entities[!animal] to exclude a type",
 		},
 		{
 			Type:    "string",
@@ -225,6 +458,150 @@ func (m *VideoPlugin) Fields() []sdk.FieldEntry {
 			Display: "Fullpath to last snapshot stored, if any",
 			Desc:    "Fullpath to last snapshot stored, if any",
 		},
+		{
+			Type:    "uint64",
+			Name:    "video.peak",
+			Display: "Peak count of the entities detected in the scene",
+			Desc:    "Maximum number of concurrent entities seen since the video source was opened, use video.peak[<type>] to get the peak of a specific entity type between { human, animal }, video.peak[human,animal] to sum the peaks of multiple types, or video.peak[!animal] to exclude a type",
+		},
+		{
+			Type:    "string",
+			Name:    "video.decaytrace",
+			Display: "Confidence decay trace of the entities",
+			Desc:    "Confidence of each entity after each decay, oldest first, as in 'id: c1 c2 ...; id: ...'. Only available if debugDecay is enabled.",
+		},
+		{
+			Type:    "string",
+			Name:    "video.label",
+			Display: "Label of the video source",
+			Desc:    "Label of the video source, as configured by the sourceLabel open parameter.",
+		},
+		{
+			Type:    "string",
+			Name:    "video.color",
+			Display: "Dominant color of the main human",
+			Desc:    "Name of the dominant color inside the box of the highest-confidence human, eg: red, blue, black.",
+		},
+		{
+			Type:    "uint64",
+			Name:    "video.paused",
+			Display: "Whether the detection has been paused",
+			Desc:    "1 on the event notifying that the detection has been paused, 0 otherwise. Use the pauseFile open parameter to pause the detection.",
+		},
+		{
+			Type:    "uint64",
+			Name:    "video.abandoned",
+			Display: "Count of the abandoned entities",
+			Desc:    "Number of non-human entities that have been stationary for abandonedSeconds with no human around.",
+		},
+		{
+			Type:    "uint64",
+			Name:    "video.burst",
+			Display: "Burst of entities",
+			Desc:    "1 if more than burstThreshold entities appeared at once since the previous event, 0 otherwise.",
+		},
+		{
+			Type:    "string",
+			Name:    "video.zone",
+			Display: "Zone transitions",
+			Desc:    "Zones entered and exited since the previous event, as a comma-separated list of enter:<zone> and exit:<zone> items.",
+		},
+		{
+			Type:    "string",
+			Name:    "video.id",
+			Display: "Event ID",
+			Desc:    "Unique ID of the event, also part of the name of its snapshot file.",
+		},
+		{
+			Type:    "string",
+			Name:    "video.class",
+			Display: "Top class",
+			Desc:    "Class of the highest-confidence entity, with its confidence, eg: Human (60%).",
+		},
+		{
+			Type:    "string",
+			Name:    "video.class2",
+			Display: "Runner-up class",
+			Desc:    "Second best class of the highest-confidence entity, with its confidence, eg: Animal (30%); empty unless topClasses is at least 2.",
+		},
+		{
+			Type:    "uint64",
+			Name:    "video.smoothed",
+			Display: "Smoothed count of the entities",
+			Desc:    "Median number of entities detected in the last smoothingWindow events, use video.smoothed[<type>] for a specific entity type between { human, animal }, video.smoothed[human,animal] to sum the medians of multiple types, or video.smoothed[!animal] to exclude a type",
+		},
+		{
+			Type:    "uint64",
+			Name:    "video.dropratio",
+			Display: "Dropped frames percentage",
+			Desc:    "Percentage of the frames sent by the video source that inference can't keep up with, as measured when the event was emitted.",
+		},
+		{
+			Type:    "uint64",
+			Name:    "video.tampered",
+			Display: "Whether the camera has been tampered",
+			Desc:    "1 on the event notifying that the camera looks covered or defocused, 0 otherwise.",
+		},
+		{
+			Type:    "string",
+			Name:    "video.delta",
+			Display: "Type of the per-blob event",
+			Desc:    "With per-blob event granularity, added or removed on the events notifying a single entity change, empty otherwise.",
+		},
+		{
+			Type:    "string",
+			Name:    "video.delta.class",
+			Display: "Class of the entity of the per-blob event",
+			Desc:    "With per-blob event granularity, class of the entity added or removed, empty otherwise.",
+		},
+		{
+			Type:    "uint64",
+			Name:    "video.idle",
+			Display: "Whether the event is a keepalive",
+			Desc:    "1 on the keepalive events sent by idleKeepalive while nothing happens, 0 otherwise.",
+		},
+		{
+			Type:    "uint64",
+			Name:    "video.distance",
+			Display: "Distance of the closest human",
+			Desc:    "Estimated distance from the camera of the closest human, in centimeters, eg: video.distance < 300 for a human within 3 meters; 0 if there is no human or the camera is not calibrated.",
+		},
+		{
+			Type:    "uint64",
+			Name:    "video.lastseen",
+			Display: "Oldest last detection of the entities",
+			Desc:    "Time, in nanoseconds since the epoch, of the least recent detection among the entities in the scene; 0 if there are none. Useful to spot entities held by the memory long after they left.",
+		},
+		{
+			Type:    "uint64",
+			Name:    "video.refresh",
+			Display: "Whether the event is a state refresh",
+			Desc:    "1 on the events periodically sent by stateRefreshSeconds with the current entities, 0 otherwise.",
+		},
+		{
+			Type:    "string",
+			Name:    "video.error",
+			Display: "Error of the detection",
+			Desc:    "On the event notifying that the detection failed, and is being restarted as allowed by maxRestarts or, with sourcesFile, has ended for that source, the failure; empty otherwise.",
+		},
+		{
+			Type:    "string",
+			Name:    "video.countalert",
+			Display: "Class of the count alert",
+			Desc:    "On the event notifying that the number of entities of a class rose to its countAlerts threshold, the class; empty otherwise. Use video.entities[<class>] for the count.",
+		},
+		{
+			Type:    "uint64",
+			Name:    "video.ended",
+			Display: "Whether a source has ended",
+			Desc:    "With sourcesFile, 1 on the event notifying that one of the sources ended, while the other ones keep running, with video.error set if it failed; 0 otherwise.",
+		},
+		{
+			Type:    "uint64",
+			Name:    "video.resumed",
+			Display: "Whether the detection has been resumed",
+			Desc:    "1 on the event notifying that a paused detection has been resumed, 0 otherwise.",
+		},
 	}
 }
 
@@ -232,7 +609,7 @@ func (m *VideoPlugin) Fields() []sdk.FieldEntry {
 // capabilities. If the Extract method is defined, the framework expects
 // a Fields method to be specified too.
 func (m *VideoPlugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) error {
-	var payload VideoEvent
+	var payload homesecurity.VideoEvent
 	encoder := gob.NewDecoder(evt.Reader())
 	if err := encoder.Decode(&payload); err != nil {
 		return err
@@ -244,7 +621,7 @@ func (m *VideoPlugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) error
 		if len(req.Arg()) > 0 {
 			count = 0
 			for _, blob := range payload.Blobs {
-				if strings.EqualFold(blob.Category.String(), req.Arg()) {
+				if m.cfg.MatchesClassList(blob.Category, req.Arg()) {
 					count++
 				}
 			}
@@ -254,6 +631,161 @@ func (m *VideoPlugin) Extract(req sdk.ExtractRequest, evt sdk.EventReader) error
 		req.SetValue(payload.VideoSource)
 	case 2: // video.snapshot
 		req.SetValue(payload.SnapshotPath)
+	case 3: // video.peak
+		peak := payload.PeakBlobs
+		if len(req.Arg()) > 0 {
+			peak = 0
+			for c, n := range payload.PeakBlobsByCategory {
+				if m.cfg.MatchesClassList(c, req.Arg()) {
+					peak += n
+				}
+			}
+		}
+		req.SetValue(peak)
+	case 4: // video.decaytrace
+		var traces []string
+		for _, blob := range payload.Blobs {
+			trace := fmt.Sprintf("%d:", blob.ID)
+			for _, c := range blob.DecayTrace {
+				trace += fmt.Sprintf(" %.3f", c)
+			}
+			traces = append(traces, trace)
+		}
+		req.SetValue(strings.Join(traces, "; "))
+	case 5: // video.label
+		req.SetValue(payload.SourceLabel)
+	case 6: // video.color
+		// blobs are sorted by descending confidence
+		color := ""
+		for _, blob := range payload.Blobs {
+			if blob.Category == homesecurity.Human {
+				color = blob.DominantColor
+				break
+			}
+		}
+		req.SetValue(color)
+	case 7: // video.paused
+		paused := uint64(0)
+		if payload.Paused {
+			paused = 1
+		}
+		req.SetValue(paused)
+	case 8: // video.abandoned
+		count := uint64(0)
+		for _, blob := range payload.Blobs {
+			if blob.Abandoned {
+				count++
+			}
+		}
+		req.SetValue(count)
+	case 9: // video.burst
+		burst := uint64(0)
+		if payload.Burst {
+			burst = 1
+		}
+		req.SetValue(burst)
+	case 10: // video.zone
+		var zones []string
+		for _, t := range payload.ZoneEnter {
+			zones = append(zones, "enter:"+t.Zone)
+		}
+		for _, t := range payload.ZoneExit {
+			zones = append(zones, "exit:"+t.Zone)
+		}
+		req.SetValue(strings.Join(zones, ","))
+	case 11: // video.id
+		req.SetValue(payload.CorrelationID)
+	case 12, 13: // video.class, video.class2
+		rank := int(req.FieldID() - 12)
+		class := ""
+		// blobs are sorted by descending confidence
+		if len(payload.Blobs) > 0 {
+			blob := payload.Blobs[0]
+			scores := blob.Scores
+			if len(scores) == 0 {
+				scores = []homesecurity.ClassScore{{Category: blob.Category, Confidence: blob.Confidence}}
+			}
+			if rank < len(scores) {
+				class = fmt.Sprintf("%s (%s)", m.cfg.ClassName(scores[rank].Category), m.cfg.FormatConfidence(scores[rank].Confidence))
+			}
+		}
+		req.SetValue(class)
+	case 14: // video.smoothed
+		count := payload.SmoothedBlobs
+		if len(req.Arg()) > 0 {
+			count = 0
+			for c, n := range payload.SmoothedBlobsByCategory {
+				if m.cfg.MatchesClassList(c, req.Arg()) {
+					count += n
+				}
+			}
+		}
+		req.SetValue(count)
+	case 15: // video.dropratio
+		req.SetValue(uint64(math.Round(payload.DropRatio * 100)))
+	case 16: // video.tampered
+		tampered := uint64(0)
+		if payload.Tampered {
+			tampered = 1
+		}
+		req.SetValue(tampered)
+	case 17: // video.delta
+		req.SetValue(payload.DeltaType)
+	case 18: // video.delta.class
+		class := ""
+		if len(payload.DeltaType) > 0 {
+			class = payload.DeltaBlob.Class
+		}
+		req.SetValue(class)
+	case 19: // video.idle
+		idle := uint64(0)
+		if payload.Idle {
+			idle = 1
+		}
+		req.SetValue(idle)
+	case 20: // video.distance
+		distance := 0.0
+		for _, blob := range payload.Blobs {
+			d := blob.EstimatedDistanceMeters
+			if blob.Category == homesecurity.Human && d > 0 && (distance == 0 || d < distance) {
+				distance = d
+			}
+		}
+		req.SetValue(uint64(math.Round(distance * 100)))
+	case 21: // video.lastseen
+		var oldest time.Time
+		for _, blob := range payload.Blobs {
+			if oldest.IsZero() || blob.LastSeen.Before(oldest) {
+				oldest = blob.LastSeen
+			}
+		}
+		lastSeen := uint64(0)
+		if !oldest.IsZero() {
+			lastSeen = uint64(oldest.UnixNano())
+		}
+		req.SetValue(lastSeen)
+	case 22: // video.refresh
+		refresh := uint64(0)
+		if payload.StateRefresh {
+			refresh = 1
+		}
+		req.SetValue(refresh)
+	case 23: // video.error
+		req.SetValue(payload.Error)
+	case 24: // video.countalert
+		req.SetValue(payload.CountAlertClass)
+	case 25: // video.ended
+		ended := uint64(0)
+		if payload.SourceEnded {
+			ended = 1
+		}
+		req.SetValue(ended)
+	case 26: // video.resumed
+		resumed := uint64(0)
+		if payload.Resumed {
+			resumed = 1
+		}
+		req.SetValue(resumed)
 	default:
 		return fmt.Errorf("unsupported field: %s", req.Field())
 	}
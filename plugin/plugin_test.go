@@ -0,0 +1,477 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/FedeDP/falco-home-security/plugin/homesecurity"
+	"github.com/falcosecurity/plugin-sdk-go/pkg/sdk"
+)
+
+// testEvent is an event of the framework, backed by memory
+type testEvent struct {
+	data bytes.Buffer
+	ts   uint64
+}
+
+func (e *testEvent) Writer() io.Writer {
+	e.data.Reset()
+	return &e.data
+}
+
+func (e *testEvent) SetTimestamp(value uint64) {
+	e.ts = value
+}
+
+func (e *testEvent) EventNum() uint64 {
+	return 1
+}
+
+func (e *testEvent) Timestamp() uint64 {
+	return e.ts
+}
+
+func (e *testEvent) Reader() io.ReadSeeker {
+	return bytes.NewReader(e.data.Bytes())
+}
+
+// testEvents is a list of events of the framework, backed by memory
+type testEvents []testEvent
+
+func (e testEvents) Get(i int) sdk.EventWriter {
+	return &e[i]
+}
+
+func (e testEvents) Len() int {
+	return len(e)
+}
+
+func (e testEvents) ArrayPtr() unsafe.Pointer {
+	return nil
+}
+
+func (e testEvents) Free() {}
+
+// testRequest is an extraction request storing the extracted value
+type testRequest struct {
+	id    uint64
+	arg   string
+	value interface{}
+}
+
+func (r *testRequest) FieldID() uint64 {
+	return r.id
+}
+
+func (r *testRequest) FieldType() uint32 {
+	return sdk.ParamTypeUint64
+}
+
+func (r *testRequest) Field() string {
+	return "video.test"
+}
+
+func (r *testRequest) Arg() string {
+	return r.arg
+}
+
+func (r *testRequest) SetValue(v interface{}) {
+	r.value = v
+}
+
+func (r *testRequest) SetPtr(unsafe.Pointer) {}
+
+// extract returns the value of a field for the given event
+func extract(t *testing.T, m *VideoPlugin, id uint64, arg string, payload homesecurity.VideoEvent) interface{} {
+	t.Helper()
+	var evt testEvent
+	if err := gob.NewEncoder(evt.Writer()).Encode(&payload); err != nil {
+		t.Fatal(err)
+	}
+	req := &testRequest{id: id, arg: arg}
+	if err := m.Extract(req, &evt); err != nil {
+		t.Fatal(err)
+	}
+	return req.value
+}
+
+// blobs returns a blob for each category
+func blobs(categories ...homesecurity.CategoryID) []homesecurity.Blob {
+	var list []homesecurity.Blob
+	for i, c := range categories {
+		list = append(list, homesecurity.Blob{ID: uint64(i + 1), Category: c, Confidence: 0.9})
+	}
+	return list
+}
+
+func newTestInstance() *VideoInstance {
+	cfg := &homesecurity.OpenConfig{}
+	return &VideoInstance{
+		plugin:  &VideoPlugin{cfg: &homesecurity.DetectionConfig{}, instances: make(map[*VideoInstance][]string)},
+		cfg:     cfg,
+		sources: []*homesecurity.OpenConfig{cfg},
+		counts:  make(map[sourceKey]*sourceCounts),
+	}
+}
+
+func TestUpdatePeaks(t *testing.T) {
+	h, a := homesecurity.Human, homesecurity.Animal
+	tests := []struct {
+		blobs   []homesecurity.Blob
+		peak    uint64
+		humans  uint64
+		animals uint64
+	}{
+		{blobs(h), 1, 1, 0},
+		{blobs(h, h, a), 3, 2, 1},
+		{blobs(a), 3, 2, 1},
+		{nil, 3, 2, 1},
+		{blobs(a, a), 3, 2, 2},
+	}
+	m := newTestInstance()
+	for i, tt := range tests {
+		evt := homesecurity.VideoEvent{Blobs: tt.blobs}
+		m.updatePeaks(&evt)
+		if evt.PeakBlobs != tt.peak || evt.PeakBlobsByCategory[h] != tt.humans || evt.PeakBlobsByCategory[a] != tt.animals {
+			t.Errorf("event %d: got peaks %d, %v, want %d, %d humans, %d animals", i, evt.PeakBlobs, evt.PeakBlobsByCategory, tt.peak, tt.humans, tt.animals)
+		}
+		if got := extract(t, m.plugin, 3, "human", evt); got != tt.humans {
+			t.Errorf("event %d: video.peak[human] = %v, want %d", i, got, tt.humans)
+		}
+	}
+}
+
+func TestSourceLabel(t *testing.T) {
+	m := newTestInstance().plugin
+	evt := homesecurity.VideoEvent{SourceLabel: "front-door"}
+	if got := extract(t, m, 5, "", evt); got != "front-door" {
+		t.Errorf("video.label = %v, want front-door", got)
+	}
+
+	tests := []struct {
+		open   []string
+		labels []string
+		ok     bool
+	}{
+		{nil, []string{""}, true},
+		{[]string{""}, []string{""}, false},
+		{[]string{"front-door"}, []string{"garage"}, true},
+		{[]string{"front-door"}, []string{"front-door"}, false},
+		// each source of a sources file
+		{[]string{"front-door"}, []string{"garage", "porch"}, true},
+		{[]string{"front-door"}, []string{"garage", ""}, false},
+		{[]string{"front-door"}, []string{"garage", "front-door"}, false},
+	}
+	for _, tt := range tests {
+		m.instances = make(map[*VideoInstance][]string)
+		for _, l := range tt.open {
+			m.instances[&VideoInstance{}] = []string{l}
+		}
+		if err := m.checkLabels(tt.labels); (err == nil) != tt.ok {
+			t.Errorf("labels %q with %q open: got error %v, want success %v", tt.labels, tt.open, err, tt.ok)
+		}
+	}
+}
+
+func TestPauseEvents(t *testing.T) {
+	h := homesecurity.Human
+	m := newTestInstance()
+	m.pause = &homesecurity.PauseSwitch{}
+	tests := []struct {
+		evt    homesecurity.VideoEvent
+		field  uint64
+		value  uint64
+		smooth uint64
+	}{
+		{homesecurity.VideoEvent{Blobs: blobs(h, h)}, 7, 0, 2},
+		{homesecurity.VideoEvent{Paused: true}, 7, 1, 2},
+		{homesecurity.VideoEvent{Resumed: true}, 26, 1, 2},
+		{homesecurity.VideoEvent{Blobs: blobs(h, h)}, 26, 0, 2},
+	}
+	for i, tt := range tests {
+		var evt testEvent
+		if err := m.writeEvent(&evt, &tt.evt); err != nil {
+			t.Fatal(err)
+		}
+		if tt.evt.SmoothedBlobs != tt.smooth {
+			t.Errorf("event %d: got smoothed count %d, want %d", i, tt.evt.SmoothedBlobs, tt.smooth)
+		}
+		if got := extract(t, m.plugin, tt.field, "", tt.evt); got != tt.value {
+			t.Errorf("event %d: field %d = %v, want %d", i, tt.field, got, tt.value)
+		}
+	}
+}
+
+func TestCorrelationIDField(t *testing.T) {
+	m := newTestInstance().plugin
+	id := homesecurity.NewCorrelationID()
+	if got := extract(t, m, 11, "", homesecurity.VideoEvent{CorrelationID: id}); got != id {
+		t.Errorf("video.id = %v, want %s", got, id)
+	}
+}
+
+func TestClassFields(t *testing.T) {
+	m := newTestInstance().plugin
+	blob := homesecurity.Blob{Category: homesecurity.Human, Confidence: 0.6}
+	ranked := blob
+	ranked.Scores = []homesecurity.ClassScore{{Category: homesecurity.Human, Confidence: 0.6}, {Category: homesecurity.Animal, Confidence: 0.3}}
+	tests := []struct {
+		name          string
+		blobs         []homesecurity.Blob
+		class, class2 string
+	}{
+		{"no blobs", nil, "", ""},
+		{"single class", []homesecurity.Blob{blob}, "Human (60%)", ""},
+		{"runner-up", []homesecurity.Blob{ranked}, "Human (60%)", "Animal (30%)"},
+	}
+	for _, tt := range tests {
+		evt := homesecurity.VideoEvent{Blobs: tt.blobs}
+		if got := extract(t, m, 12, "", evt); got != tt.class {
+			t.Errorf("%s: video.class = %v, want %q", tt.name, got, tt.class)
+		}
+		if got := extract(t, m, 13, "", evt); got != tt.class2 {
+			t.Errorf("%s: video.class2 = %v, want %q", tt.name, got, tt.class2)
+		}
+	}
+}
+
+func TestSmoothedField(t *testing.T) {
+	m := newTestInstance().plugin
+	evt := homesecurity.VideoEvent{
+		SmoothedBlobs:           3,
+		SmoothedBlobsByCategory: map[homesecurity.CategoryID]uint64{homesecurity.Human: 2, homesecurity.Animal: 1},
+	}
+	tests := []struct {
+		arg  string
+		want uint64
+	}{
+		{"", 3},
+		{"human", 2},
+		{"human,animal", 3},
+		{"!animal", 2},
+		{"vehicle", 0},
+	}
+	for _, tt := range tests {
+		if got := extract(t, m, 14, tt.arg, evt); got != tt.want {
+			t.Errorf("video.smoothed[%s] = %v, want %d", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestClassListArgs(t *testing.T) {
+	h, a := homesecurity.Human, homesecurity.Animal
+	m := newTestInstance().plugin
+	evt := homesecurity.VideoEvent{
+		Blobs:               blobs(h, h, a),
+		PeakBlobs:           5,
+		PeakBlobsByCategory: map[homesecurity.CategoryID]uint64{h: 3, a: 2},
+	}
+	tests := []struct {
+		arg            string
+		entities, peak uint64
+	}{
+		{"", 3, 5},
+		{"human", 2, 3},
+		{"human,animal", 3, 5},
+		{"!animal", 2, 3},
+		{"human,!human", 0, 0},
+		{"vehicle", 0, 0},
+	}
+	for _, tt := range tests {
+		if got := extract(t, m, 0, tt.arg, evt); got != tt.entities {
+			t.Errorf("video.entities[%s] = %v, want %d", tt.arg, got, tt.entities)
+		}
+		if got := extract(t, m, 3, tt.arg, evt); got != tt.peak {
+			t.Errorf("video.peak[%s] = %v, want %d", tt.arg, got, tt.peak)
+		}
+	}
+}
+
+func TestWriteEventSmoothing(t *testing.T) {
+	h, a := homesecurity.Human, homesecurity.Animal
+	tests := []struct {
+		name     string
+		evt      homesecurity.VideoEvent
+		smoothed uint64
+	}{
+		{"empty", homesecurity.VideoEvent{}, 0},
+		{"empty", homesecurity.VideoEvent{}, 0},
+		{"first per-blob", homesecurity.VideoEvent{Blobs: blobs(h, h, a), DeltaType: homesecurity.DeltaAdded}, 0},
+		{"second per-blob", homesecurity.VideoEvent{Blobs: blobs(h, h, a), DeltaType: homesecurity.DeltaAdded, DeltaIndex: 1}, 0},
+		{"state refresh", homesecurity.VideoEvent{Blobs: blobs(h, h, a), StateRefresh: true}, 0},
+		{"count alert", homesecurity.VideoEvent{Blobs: blobs(h, h, a), CountAlert: true}, 0},
+		{"change", homesecurity.VideoEvent{Blobs: blobs(h, h, a)}, 3},
+	}
+	m := newTestInstance()
+	m.cfg.SmoothingWindow = 3
+	for i, tt := range tests {
+		if err := m.writeEvent(&testEvent{}, &tt.evt); err != nil {
+			t.Fatal(err)
+		}
+		if tt.evt.SmoothedBlobs != tt.smoothed {
+			t.Errorf("event %d, %s: got smoothed %d, want %d", i, tt.name, tt.evt.SmoothedBlobs, tt.smoothed)
+		}
+	}
+}
+
+func TestIdleKeepalive(t *testing.T) {
+	tests := []struct {
+		keepalive bool
+		paused    bool
+		sources   []string
+		n         int
+		err       error
+	}{
+		{false, false, nil, 0, sdk.ErrTimeout},
+		{true, false, nil, 1, nil},
+		// nothing is sent while paused
+		{true, true, nil, 0, sdk.ErrTimeout},
+		// one for each source of a sources file
+		{true, false, []string{"garage", "porch"}, 2, nil},
+	}
+	for _, tt := range tests {
+		// silent sources
+		m := newTestInstance()
+		m.cfg.IdleKeepalive = tt.keepalive
+		m.pause = &homesecurity.PauseSwitch{}
+		if tt.paused {
+			m.pause.Pause()
+		}
+		if len(tt.sources) > 0 {
+			m.sources = nil
+			for _, label := range tt.sources {
+				m.sources = append(m.sources, &homesecurity.OpenConfig{VideoSource: "rtsp://" + label, SourceLabel: label})
+			}
+		}
+		evts := make(testEvents, len(m.sources))
+		start := time.Now()
+		n, err := m.NextBatch(nil, evts)
+		if elapsed := time.Since(start); elapsed < time.Second {
+			t.Errorf("keepalive %v: returned after %s, before the timeout", tt.keepalive, elapsed)
+		}
+		if n != tt.n || err != tt.err {
+			t.Fatalf("keepalive %v, paused %v: got %d events, %v, want %d, %v", tt.keepalive, tt.paused, n, err, tt.n, tt.err)
+		}
+		for i := 0; i < n; i++ {
+			var payload homesecurity.VideoEvent
+			if err := gob.NewDecoder(&evts[i].data).Decode(&payload); err != nil {
+				t.Fatal(err)
+			}
+			if !payload.Idle || len(payload.Blobs) > 0 {
+				t.Errorf("got %+v, want a keepalive", payload)
+			}
+			if payload.VideoSource != m.sources[i].VideoSource || payload.SourceLabel != m.sources[i].SourceLabel {
+				t.Errorf("got a keepalive of %s, %s, want %s, %s", payload.VideoSource, payload.SourceLabel, m.sources[i].VideoSource, m.sources[i].SourceLabel)
+			}
+		}
+	}
+}
+
+func TestDistanceField(t *testing.T) {
+	h, a := homesecurity.Human, homesecurity.Animal
+	tests := []struct {
+		distances []float64
+		want      uint64
+	}{
+		{nil, 0},
+		{[]float64{5, 2.5}, 250},
+		// humans whose distance is unknown are ignored
+		{[]float64{0, 3.2}, 320},
+	}
+	m := newTestInstance().plugin
+	for _, tt := range tests {
+		var evt homesecurity.VideoEvent
+		for _, d := range tt.distances {
+			evt.Blobs = append(evt.Blobs, homesecurity.Blob{Category: h, EstimatedDistanceMeters: d})
+		}
+		// animals are not measured
+		evt.Blobs = append(evt.Blobs, homesecurity.Blob{Category: a, EstimatedDistanceMeters: 1})
+		if got := extract(t, m, 20, "", evt); got != tt.want {
+			t.Errorf("distances %v: video.distance = %v, want %d", tt.distances, got, tt.want)
+		}
+	}
+}
+
+func TestPerSourceCounts(t *testing.T) {
+	h := homesecurity.Human
+	tests := []struct {
+		label          string
+		blobs          []homesecurity.Blob
+		peak, smoothed uint64
+	}{
+		{"garage", blobs(h, h, h), 3, 3},
+		{"porch", blobs(h), 1, 1},
+		{"porch", blobs(h), 1, 1},
+		{"garage", blobs(h, h, h), 3, 3},
+	}
+	m := newTestInstance()
+	for i, tt := range tests {
+		evt := homesecurity.VideoEvent{SourceLabel: tt.label, Blobs: tt.blobs}
+		if err := m.writeEvent(&testEvent{}, &evt); err != nil {
+			t.Fatal(err)
+		}
+		if evt.PeakBlobs != tt.peak || evt.SmoothedBlobs != tt.smoothed {
+			t.Errorf("event %d of %s: got peak %d, smoothed %d, want %d, %d", i, tt.label, evt.PeakBlobs, evt.SmoothedBlobs, tt.peak, tt.smoothed)
+		}
+	}
+}
+
+func TestLastSeenField(t *testing.T) {
+	h := homesecurity.Human
+	tests := []struct {
+		lastSeen []int64
+		want     uint64
+	}{
+		{nil, 0},
+		{[]int64{1002, 1000, 1001}, uint64(time.Unix(1000, 0).UnixNano())},
+	}
+	m := newTestInstance().plugin
+	for _, tt := range tests {
+		var evt homesecurity.VideoEvent
+		for _, sec := range tt.lastSeen {
+			evt.Blobs = append(evt.Blobs, homesecurity.Blob{Category: h, LastSeen: time.Unix(sec, 0)})
+		}
+		if got := extract(t, m, 21, "", evt); got != tt.want {
+			t.Errorf("last seen %v: video.lastseen = %v, want %d", tt.lastSeen, got, tt.want)
+		}
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	tests := []struct {
+		name   string
+		params string
+	}{
+		{"running", `{"videoSource": "testpattern"}`},
+		{"queued frames", `{"videoSource": "testpattern", "frameQueueDepth": 2}`},
+		{"failed source", `{"videoSource": "/nonexistent/video.mp4"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &VideoPlugin{cfg: &homesecurity.DetectionConfig{}, instances: make(map[*VideoInstance][]string)}
+			instance, err := m.Open(tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the detection is stopped without anyone reading its events
+			closed := make(chan struct{})
+			go func() {
+				defer close(closed)
+				instance.(*VideoInstance).Close()
+				instance.(*VideoInstance).Close()
+			}()
+			select {
+			case <-closed:
+			case <-time.After(5 * time.Second):
+				t.Fatal("close blocked")
+			}
+			if len(m.instances) != 0 {
+				t.Errorf("got %d open instances, want none", len(m.instances))
+			}
+		})
+	}
+}